@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"flag"
 	"os"
 	"runtime"
 	"time"
 
+	"github.com/flexshopper/redis-operator/pkg/migrate"
+	"github.com/flexshopper/redis-operator/pkg/policy"
 	"github.com/flexshopper/redis-operator/pkg/stub"
+	"github.com/flexshopper/redis-operator/pkg/webhook"
 	"github.com/operator-framework/operator-sdk/pkg/sdk"
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
 
@@ -21,13 +25,54 @@ func printVersion() {
 }
 
 func main() {
+	policyOptions := &policy.Options{}
+	policyOptions.AddFlags(flag.CommandLine)
+	webhookOptions := &webhook.Options{}
+	webhookOptions.AddFlags(flag.CommandLine)
+	migrateStorage := flag.Bool("migrate-storage", true, "rewrite the Redis objects stored in an older API version in the storage version")
+	storeDefaults := flag.Bool("store-defaults", true, "rewrite the Redis objects created before the defaulting webhook, for it to store their defaults")
+	flag.Parse()
+
 	printVersion()
 
 	sdk.ExposeMetricsPort()
 
-	resource := "cache.flexshopper.com/v1alpha1"
+	resource := "cache.flexshopper.com/v1alpha2"
 	kind := "Redis"
 	namespace := os.Getenv("WATCH_NAMESPACE")
+
+	policyLoader, err := policy.NewLoader(policyOptions, namespace)
+	if err != nil {
+		logrus.Fatalf("failed to load policy: %v", err)
+	}
+	go policyLoader.Run(make(chan struct{}))
+
+	// Redis objects are validated on every resync anyway, the operator
+	// keeps running without the webhook
+	if webhookOptions.Port != 0 {
+		webhookServer, err := webhook.NewServer(webhookOptions, namespace)
+		if err != nil {
+			logrus.Errorf("failed to set up admission webhook with error : %v", err)
+		} else {
+			go func() {
+				err := webhookServer.Run(make(chan struct{}))
+				if err != nil {
+					logrus.Errorf("failed to serve admission webhook with error : %v", err)
+				}
+			}()
+
+			if *storeDefaults {
+				go migrate.RunDefaults(namespace, make(chan struct{}))
+			}
+		}
+	}
+
+	// v1alpha1 objects are converted by the webhook, the migration waits
+	// for it to serve
+	if *migrateStorage {
+		go migrate.Run(make(chan struct{}))
+	}
+
 	resyncPeriod := time.Duration(5) * time.Second
 	logrus.Infof("Watching %s, %s, %s, %d", resource, kind, namespace, resyncPeriod)
 	sdk.Watch(resource, kind, namespace, resyncPeriod)
@@ -0,0 +1,185 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// v1alpha2SpecAnnotation keeps a v1alpha2 spec with fields v1alpha1 has no
+// room for, so that converting to v1alpha1 and back loses nothing
+const v1alpha2SpecAnnotation = "cache.flexshopper.com/v1alpha2-spec"
+
+// ConvertTo converts a Redis to v1alpha2, the version the operator works
+// with and the one stored
+func (redis *Redis) ConvertTo(dst *v1alpha2.Redis) error {
+	dst.TypeMeta = metav1.TypeMeta{
+		APIVersion: v1alpha2.SchemeGroupVersion.String(),
+		Kind:       "Redis",
+	}
+	dst.ObjectMeta = *redis.ObjectMeta.DeepCopy()
+	dst.Spec = v1alpha2.RedisSpec{}
+
+	// the fields v1alpha1 has no room for come back from the annotation,
+	// the ones it has are taken from the v1alpha1 spec
+	if data, ok := dst.Annotations[v1alpha2SpecAnnotation]; ok {
+		err := json.Unmarshal([]byte(data), &dst.Spec)
+		if err != nil {
+			return err
+		}
+
+		delete(dst.Annotations, v1alpha2SpecAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+
+	spec := &redis.Spec
+	dst.Spec.Image = spec.Image
+	dst.Spec.Version = spec.Version
+	dst.Spec.Port = spec.Port
+	dst.Spec.MaxMemory = spec.MaxMemory
+	dst.Spec.MaxMemoryEvictionPolicy = spec.MaxMemoryEvictionPolicy
+	dst.Spec.Config = copyMap(spec.Config)
+	dst.Spec.Topology.Mode = v1alpha2.RedisMode(spec.Mode)
+	dst.Spec.Topology.Replicas = spec.Replicas
+	dst.Spec.Topology.Shards = spec.Shards
+	dst.Spec.Topology.ReplicasPerShard = spec.ReplicasPerShard
+	dst.Spec.Security.PasswordSecret = spec.PasswordSecret
+	dst.Spec.Security.PasswordSecretKey = spec.PasswordSecretKey
+
+	// the timings of the sentinels are only kept in the annotation
+	sentinel := dst.Spec.Topology.Sentinel
+	dst.Spec.Topology.Sentinel = nil
+	if spec.Sentinel != nil {
+		if sentinel == nil {
+			sentinel = &v1alpha2.RedisSentinel{}
+		}
+
+		sentinel.Replicas = spec.Sentinel.Replicas
+		sentinel.Quorum = spec.Sentinel.Quorum
+		dst.Spec.Topology.Sentinel = sentinel
+	}
+
+	// these have the same fields in both versions
+	dst.Spec.Persistence = nil
+	dst.Spec.Monitoring = nil
+	err := convertJSON(spec.Persistence, &dst.Spec.Persistence)
+	if err != nil {
+		return err
+	}
+
+	err = convertJSON(spec.Monitoring, &dst.Spec.Monitoring)
+	if err != nil {
+		return err
+	}
+
+	dst.Status = v1alpha2.RedisStatus{}
+	return convertJSON(&redis.Status, &dst.Status)
+}
+
+// ConvertFrom converts a v1alpha2 Redis to v1alpha1
+func (redis *Redis) ConvertFrom(src *v1alpha2.Redis) error {
+	redis.TypeMeta = metav1.TypeMeta{
+		APIVersion: SchemeGroupVersion.String(),
+		Kind:       "Redis",
+	}
+	redis.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	delete(redis.Annotations, v1alpha2SpecAnnotation)
+
+	spec := &src.Spec
+	redis.Spec = RedisSpec{
+		Image:                   spec.Image,
+		Version:                 spec.Version,
+		Port:                    spec.Port,
+		PasswordSecret:          spec.Security.PasswordSecret,
+		PasswordSecretKey:       spec.Security.PasswordSecretKey,
+		MaxMemory:               spec.MaxMemory,
+		MaxMemoryEvictionPolicy: spec.MaxMemoryEvictionPolicy,
+		Replicas:                spec.Topology.Replicas,
+		Mode:                    RedisMode(spec.Topology.Mode),
+		Shards:                  spec.Topology.Shards,
+		ReplicasPerShard:        spec.Topology.ReplicasPerShard,
+		Config:                  copyMap(spec.Config),
+	}
+
+	err := convertJSON(spec.Topology.Sentinel, &redis.Spec.Sentinel)
+	if err != nil {
+		return err
+	}
+
+	err = convertJSON(spec.Persistence, &redis.Spec.Persistence)
+	if err != nil {
+		return err
+	}
+
+	err = convertJSON(spec.Monitoring, &redis.Spec.Monitoring)
+	if err != nil {
+		return err
+	}
+
+	redis.Status = RedisStatus{}
+	err = convertJSON(&src.Status, &redis.Status)
+	if err != nil {
+		return err
+	}
+
+	// keep the whole spec aside when converting back wouldn't give it back
+	back := &v1alpha2.Redis{}
+	err = redis.ConvertTo(back)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	backData, err := json.Marshal(&back.Spec)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(data, backData) {
+		return nil
+	}
+
+	annotations := map[string]string{}
+	for key, value := range redis.Annotations {
+		annotations[key] = value
+	}
+	annotations[v1alpha2SpecAnnotation] = string(data)
+	redis.Annotations = annotations
+	return nil
+}
+
+// convertJSON copies in to out, types of different versions with the same
+// fields. A nil in leaves out alone.
+func convertJSON(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	if string(data) == "null" {
+		return nil
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	copied := make(map[string]string, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+
+	return copied
+}
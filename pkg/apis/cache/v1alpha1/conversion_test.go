@@ -0,0 +1,48 @@
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	hub := &v1alpha2.Redis{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       "Redis",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: "default"},
+	}
+	hub.Spec.Topology.Replicas = 2
+	hub.Spec.Topology.Sentinel = &v1alpha2.RedisSentinel{Replicas: 3, DownAfterMilliseconds: 2000}
+	hub.Spec.Scheduling.NodeSelector = map[string]string{"pool": "memory"}
+	hub.SetDefaults()
+
+	redis := &Redis{}
+	err := redis.ConvertFrom(hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a v1alpha1 client edits the fields it knows
+	redis.Spec.Sentinel.Quorum = 3
+
+	back := &v1alpha2.Redis{}
+	err = redis.ConvertTo(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := hub.Spec.DeepCopy()
+	want.Topology.Sentinel.Quorum = 3
+	if !reflect.DeepEqual(&back.Spec, want) {
+		t.Errorf("got %+v, want %+v", back.Spec, *want)
+	}
+
+	if _, ok := back.Annotations[v1alpha2SpecAnnotation]; ok {
+		t.Errorf("annotation %s kept on v1alpha2", v1alpha2SpecAnnotation)
+	}
+}
@@ -0,0 +1,3 @@
+// +k8s:deepcopy-gen=package
+// +groupName=cache.flexshopper.com
+package v1alpha2
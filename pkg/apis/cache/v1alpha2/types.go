@@ -0,0 +1,500 @@
+package v1alpha2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// We'll define some default values we'll reference in SetDefaults
+const (
+	defaultMaxMemory               = "2mb"
+	defaultMaxMemoryEvictionPolicy = "allkeys-lru"
+	defaultPort                    = 6379
+	defaultImage                   = "redis:4-alpine"
+	defaultPasswordSecretKey       = "password"
+	defaultPersistenceSize         = "1Gi"
+	defaultSentinelReplicas        = 3
+	defaultSentinelDownAfter       = 5000
+	defaultSentinelFailoverTimeout = 60000
+	defaultSentinelParallelSyncs   = 1
+	defaultShards                  = 3
+	defaultExporterImage           = "oliver006/redis_exporter:v0.21.1"
+	defaultExporterPort            = 9121
+	defaultScrapeInterval          = "30s"
+	defaultMemoryOverheadPercent   = 50
+	defaultProbePeriodSeconds      = 10
+	defaultProbeTimeoutSeconds     = 5
+	defaultProbeFailureThreshold   = 3
+	defaultLivenessDelaySeconds    = 10
+	defaultReadinessPeriodSeconds  = 5
+	// redis may load its dataset for defaultStartupFailureThreshold times
+	// defaultProbePeriodSeconds before it's restarted
+	defaultStartupFailureThreshold = 30
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type RedisList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []Redis `json:"items"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type Redis struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              RedisSpec   `json:"spec"`
+	Status            RedisStatus `json:"status,omitempty"`
+}
+
+func (redis *Redis) SetDefaults() bool {
+	changed := false
+	rSpec := &redis.Spec
+
+	if rSpec.MaxMemory == "" {
+		rSpec.MaxMemory = defaultMaxMemory
+		changed = true
+	}
+
+	if rSpec.MaxMemoryEvictionPolicy == "" {
+		rSpec.MaxMemoryEvictionPolicy = defaultMaxMemoryEvictionPolicy
+		changed = true
+	}
+
+	if rSpec.Port == 0 {
+		rSpec.Port = defaultPort
+		changed = true
+	}
+
+	if rSpec.Image == "" {
+		rSpec.Image = defaultImage
+		changed = true
+	}
+
+	if rSpec.Security.PasswordSecret != "" && rSpec.Security.PasswordSecretKey == "" {
+		rSpec.Security.PasswordSecretKey = defaultPasswordSecretKey
+		changed = true
+	}
+
+	if rSpec.Persistence != nil {
+		if rSpec.Persistence.Size == "" {
+			rSpec.Persistence.Size = defaultPersistenceSize
+			changed = true
+		}
+
+		if len(rSpec.Persistence.AccessModes) == 0 {
+			rSpec.Persistence.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+			changed = true
+		}
+	}
+
+	if rSpec.Topology.Mode == "" {
+		rSpec.Topology.Mode = RedisModeStandalone
+		changed = true
+	}
+
+	if rSpec.Topology.Mode == RedisModeCluster && rSpec.Topology.Shards == 0 {
+		rSpec.Topology.Shards = defaultShards
+		changed = true
+	}
+
+	if rSpec.Monitoring != nil {
+		if rSpec.Monitoring.Image == "" {
+			rSpec.Monitoring.Image = defaultExporterImage
+			changed = true
+		}
+
+		if rSpec.Monitoring.Port == 0 {
+			rSpec.Monitoring.Port = defaultExporterPort
+			changed = true
+		}
+
+		if rSpec.Monitoring.Interval == "" {
+			rSpec.Monitoring.Interval = defaultScrapeInterval
+			changed = true
+		}
+	}
+
+	if rSpec.MemoryOverheadPercent == 0 {
+		rSpec.MemoryOverheadPercent = defaultMemoryOverheadPercent
+		changed = true
+	}
+
+	if rSpec.Probes == nil {
+		rSpec.Probes = &RedisProbes{}
+		changed = true
+	}
+
+	for _, probe := range []struct {
+		probe    **RedisProbe
+		defaults RedisProbe
+	}{
+		{&rSpec.Probes.Liveness, RedisProbe{
+			InitialDelaySeconds: defaultLivenessDelaySeconds,
+			PeriodSeconds:       defaultProbePeriodSeconds,
+			TimeoutSeconds:      defaultProbeTimeoutSeconds,
+			FailureThreshold:    defaultProbeFailureThreshold,
+		}},
+		{&rSpec.Probes.Readiness, RedisProbe{
+			PeriodSeconds:    defaultReadinessPeriodSeconds,
+			TimeoutSeconds:   defaultProbeTimeoutSeconds,
+			FailureThreshold: defaultProbeFailureThreshold,
+		}},
+		{&rSpec.Probes.Startup, RedisProbe{
+			PeriodSeconds:    defaultProbePeriodSeconds,
+			TimeoutSeconds:   defaultProbeTimeoutSeconds,
+			FailureThreshold: defaultStartupFailureThreshold,
+		}},
+	} {
+		if *probe.probe == nil {
+			*probe.probe = &RedisProbe{}
+		}
+
+		if (*probe.probe).setDefaults(probe.defaults) {
+			changed = true
+		}
+	}
+
+	if rSpec.Topology.Sentinel != nil {
+		if rSpec.Topology.Sentinel.Replicas == 0 {
+			rSpec.Topology.Sentinel.Replicas = defaultSentinelReplicas
+			changed = true
+		}
+
+		// a majority of the sentinels by default
+		if rSpec.Topology.Sentinel.Quorum == 0 {
+			rSpec.Topology.Sentinel.Quorum = rSpec.Topology.Sentinel.Replicas/2 + 1
+			changed = true
+		}
+
+		if rSpec.Topology.Sentinel.DownAfterMilliseconds == 0 {
+			rSpec.Topology.Sentinel.DownAfterMilliseconds = defaultSentinelDownAfter
+			changed = true
+		}
+
+		if rSpec.Topology.Sentinel.FailoverTimeout == 0 {
+			rSpec.Topology.Sentinel.FailoverTimeout = defaultSentinelFailoverTimeout
+			changed = true
+		}
+
+		if rSpec.Topology.Sentinel.ParallelSyncs == 0 {
+			rSpec.Topology.Sentinel.ParallelSyncs = defaultSentinelParallelSyncs
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+type RedisSpec struct {
+	// Image is the redis image, redis:4-alpine by default
+	Image string `json:"image,omitempty"`
+	// Version is the redis version the image runs, e.g. 6.2. It's read from
+	// the image tag when empty, images without a version in the tag such as
+	// redis:latest are taken to run 8.0.
+	Version                 string `json:"version,omitempty"`
+	Port                    int32  `json:"port,omitempty"`
+	MaxMemory               string `json:"maxMemory,omitempty"`
+	MaxMemoryEvictionPolicy string `json:"maxMemoryEvictionPolicy,omitempty"`
+	// Config sets redis.conf directives, e.g. "appendonly": "yes". The
+	// value holds the arguments as they'd be written in redis.conf.
+	Config map[string]string `json:"config,omitempty"`
+	// Topology is how many redis pods there are and how they relate
+	Topology RedisTopology `json:"topology,omitempty"`
+	// Persistence switches the instance to a StatefulSet keeping /data on a PVC
+	Persistence *RedisPersistence `json:"persistence,omitempty"`
+	// Security is how clients authenticate
+	Security RedisSecurity `json:"security,omitempty"`
+	// Monitoring adds a redis_exporter sidecar to every redis pod
+	Monitoring *RedisMonitoring `json:"monitoring,omitempty"`
+	// Resources of the redis container. When unset, the memory request and
+	// limit are derived from MaxMemory and MemoryOverheadPercent. A MaxMemory
+	// change that fits in the memory of the running pods doesn't restart
+	// them, lowering it keeps their memory until they restart for another
+	// change.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// MemoryOverheadPercent is the memory the container needs on top of
+	// MaxMemory for fragmentation, replication buffers and the pages copied
+	// while a fork writes a snapshot, 50 by default
+	MemoryOverheadPercent int32 `json:"memoryOverheadPercent,omitempty"`
+	// Probes tunes the timings of the health checks of the redis pods
+	Probes *RedisProbes `json:"probes,omitempty"`
+	// Scheduling places the redis pods on nodes
+	Scheduling RedisScheduling `json:"scheduling,omitempty"`
+}
+
+// RedisScheduling is copied to the pod spec of the redis pods
+type RedisScheduling struct {
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity of the redis pods. Without a podAntiAffinity, the pods of a
+	// Redis with replicas or shards prefer not to share a node.
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// TopologySpreadConstraints require Kubernetes 1.19, older API servers
+	// drop them
+	TopologySpreadConstraints []TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	PriorityClassName         string                     `json:"priorityClassName,omitempty"`
+}
+
+// TopologySpreadConstraint is the core/v1 one, which the vendored API
+// predates. A nil LabelSelector selects the pods of the Redis.
+type TopologySpreadConstraint struct {
+	MaxSkew           int32                 `json:"maxSkew"`
+	TopologyKey       string                `json:"topologyKey"`
+	WhenUnsatisfiable string                `json:"whenUnsatisfiable"`
+	LabelSelector     *metav1.LabelSelector `json:"labelSelector,omitempty"`
+}
+
+// RedisProbes are the timings of the probes of the redis container
+type RedisProbes struct {
+	// Liveness restarts a redis that stopped answering
+	Liveness *RedisProbe `json:"liveness,omitempty"`
+	// Readiness keeps a redis out of the Services while it loads its
+	// dataset or syncs with its master
+	Readiness *RedisProbe `json:"readiness,omitempty"`
+	// Startup bounds how long redis may spend loading its dataset, for
+	// InitialDelaySeconds plus PeriodSeconds times FailureThreshold. The
+	// liveness probe doesn't fail during that time.
+	Startup *RedisProbe `json:"startup,omitempty"`
+}
+
+type RedisProbe struct {
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int32 `json:"periodSeconds,omitempty"`
+	TimeoutSeconds      int32 `json:"timeoutSeconds,omitempty"`
+	FailureThreshold    int32 `json:"failureThreshold,omitempty"`
+}
+
+// setDefaults fills the timings left out, returning whether it did
+func (p *RedisProbe) setDefaults(defaults RedisProbe) bool {
+	changed := false
+
+	if p.InitialDelaySeconds == 0 && defaults.InitialDelaySeconds != 0 {
+		p.InitialDelaySeconds = defaults.InitialDelaySeconds
+		changed = true
+	}
+
+	if p.PeriodSeconds == 0 {
+		p.PeriodSeconds = defaults.PeriodSeconds
+		changed = true
+	}
+
+	if p.TimeoutSeconds == 0 {
+		p.TimeoutSeconds = defaults.TimeoutSeconds
+		changed = true
+	}
+
+	if p.FailureThreshold == 0 {
+		p.FailureThreshold = defaults.FailureThreshold
+		changed = true
+	}
+
+	return changed
+}
+
+// RedisTopology is a single master, a master with replicas optionally
+// failed over by sentinels, or a cluster of shards
+type RedisTopology struct {
+	// Mode is standalone (the default) or cluster
+	Mode RedisMode `json:"mode,omitempty"`
+	// Replicas is the number of read replicas following the master, they
+	// are served by the <name>-read Service
+	Replicas int32 `json:"replicas,omitempty"`
+	// Sentinel adds a Redis Sentinel deployment that fails the master over
+	// to a replica, it requires Replicas
+	Sentinel *RedisSentinel `json:"sentinel,omitempty"`
+	// Shards is the number of masters the slots are split over in cluster mode
+	Shards int32 `json:"shards,omitempty"`
+	// ReplicasPerShard is the number of replicas following each shard master
+	ReplicasPerShard int32 `json:"replicasPerShard,omitempty"`
+}
+
+// RedisSecurity is how clients authenticate
+type RedisSecurity struct {
+	// PasswordSecret is the name of a Secret in the same namespace holding
+	// the password clients must send with AUTH
+	PasswordSecret string `json:"passwordSecret,omitempty"`
+	// PasswordSecretKey is the key inside PasswordSecret, defaults to "password"
+	PasswordSecretKey string `json:"passwordSecretKey,omitempty"`
+}
+
+type RedisMode string
+
+const (
+	RedisModeStandalone RedisMode = "standalone"
+	RedisModeCluster    RedisMode = "cluster"
+)
+
+type RedisSentinel struct {
+	// Replicas is the number of sentinels, 3 by default
+	Replicas int32 `json:"replicas,omitempty"`
+	// Quorum is the number of sentinels that need to agree the master is
+	// down, a majority of Replicas by default
+	Quorum int32 `json:"quorum,omitempty"`
+	// DownAfterMilliseconds is how long the master may not answer before a
+	// sentinel thinks it's down, 5000 by default
+	DownAfterMilliseconds int32 `json:"downAfterMilliseconds,omitempty"`
+	// FailoverTimeout in milliseconds bounds a failover, 60000 by default
+	FailoverTimeout int32 `json:"failoverTimeout,omitempty"`
+	// ParallelSyncs is the number of replicas resyncing with a new master
+	// at once, 1 by default
+	ParallelSyncs int32 `json:"parallelSyncs,omitempty"`
+}
+
+// RedisMonitoring configures the exporter sidecar and, when the prometheus
+// operator is installed, the ServiceMonitor scraping it
+type RedisMonitoring struct {
+	// Image of the exporter, oliver006/redis_exporter by default
+	Image string `json:"image,omitempty"`
+	// Port the exporter serves /metrics on, 9121 by default
+	Port int32 `json:"port,omitempty"`
+	// Interval of the ServiceMonitor scrapes, 30s by default
+	Interval string `json:"interval,omitempty"`
+	// Labels are added to the ServiceMonitor and PrometheusRule so the
+	// Prometheus instance selects them
+	Labels map[string]string `json:"labels,omitempty"`
+	// Rules creates a PrometheusRule with the default alerts
+	Rules bool `json:"rules,omitempty"`
+}
+
+type RedisPersistence struct {
+	// StorageClassName of the claims, the cluster default when empty
+	StorageClassName *string `json:"storageClassName,omitempty"`
+	// Size of each claim as a kubernetes quantity, e.g. 10Gi
+	Size        string                              `json:"size,omitempty"`
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+}
+
+// RedisPhase sums the conditions up in a word
+type RedisPhase string
+
+const (
+	RedisPhasePending RedisPhase = "Pending"
+	RedisPhaseRunning RedisPhase = "Running"
+	// RedisPhaseErred is a spec that is invalid or breaks the policy
+	RedisPhaseErred RedisPhase = "Erred"
+)
+
+type RedisConditionType string
+
+// These are the conditions reported in RedisStatus, Ready is only true when
+// all the others are
+const (
+	RedisConfigValid RedisConditionType = "ConfigValid"
+	// RedisPolicyCompliant is False when the spec breaks the operator policy,
+	// the running children are then left as they are
+	RedisPolicyCompliant     RedisConditionType = "PolicyCompliant"
+	RedisResourcesCreated    RedisConditionType = "ResourcesCreated"
+	RedisDeploymentAvailable RedisConditionType = "DeploymentAvailable"
+	RedisReady               RedisConditionType = "Ready"
+)
+
+type RedisCondition struct {
+	Type   RedisConditionType     `json:"type"`
+	Status corev1.ConditionStatus `json:"status"`
+	// ObservedGeneration is the metadata.generation the condition was computed from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastTransitionTime only moves when Status changes
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	Reason             string      `json:"reason,omitempty"`
+	Message            string      `json:"message,omitempty"`
+}
+
+// RedisChildStatus describes one of the objects the operator manages for a Redis
+type RedisChildStatus struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	ConfigHash string `json:"configHash,omitempty"`
+	Ready      bool   `json:"ready"`
+}
+
+// RedisNodeStatus is the replication state of one redis pod
+type RedisNodeStatus struct {
+	Name string `json:"name"`
+	IP   string `json:"ip,omitempty"`
+	// Role is master or slave as reported by INFO replication
+	Role string `json:"role,omitempty"`
+	// MasterLinkStatus is up or down, only set for replicas
+	MasterLinkStatus string `json:"masterLinkStatus,omitempty"`
+	// NodeID is the cluster node ID, only set in cluster mode
+	NodeID string `json:"nodeID,omitempty"`
+	// Slots are the slot ranges served by a cluster master, e.g. 0-5460
+	Slots string `json:"slots,omitempty"`
+	// Health is connected or the failure flags (fail, pfail) other cluster
+	// nodes report for this node
+	Health string `json:"health,omitempty"`
+}
+
+// RedisClusterStatus is the cluster wide state reported by CLUSTER INFO
+type RedisClusterStatus struct {
+	// State is ok when every slot is served
+	State         string `json:"state,omitempty"`
+	SlotsAssigned int32  `json:"slotsAssigned"`
+	SlotsOk       int32  `json:"slotsOk"`
+	SlotsPFail    int32  `json:"slotsPFail"`
+	SlotsFail     int32  `json:"slotsFail"`
+	KnownNodes    int32  `json:"knownNodes"`
+	// Size is the number of masters serving at least one slot
+	Size int32 `json:"size"`
+	// Resharding is set while slots are moved to match spec.topology.shards
+	Resharding *RedisReshardStatus `json:"resharding,omitempty"`
+}
+
+// RedisReshardStatus is the progress of moving slots between shards, it
+// survives operator restarts as the slots in flight are read back from
+// the cluster
+type RedisReshardStatus struct {
+	// Shards is the shard count being resharded to
+	Shards int32 `json:"shards"`
+	// Step is PromotingReplicas, MigratingSlots or RemovingNodes
+	Step           string `json:"step"`
+	SlotsMoved     int32  `json:"slotsMoved"`
+	SlotsRemaining int32  `json:"slotsRemaining"`
+	KeysMigrated   int64  `json:"keysMigrated"`
+}
+
+// RedisHotAppliedDirective is a directive applied with CONFIG SET
+type RedisHotAppliedDirective struct {
+	Name            string      `json:"name"`
+	Value           string      `json:"value"`
+	LastAppliedTime metav1.Time `json:"lastAppliedTime"`
+}
+
+// RedisInstanceStatus is what a redis pod last reported in INFO
+type RedisInstanceStatus struct {
+	Name         string `json:"name"`
+	RedisVersion string `json:"redisVersion,omitempty"`
+	Role         string `json:"role,omitempty"`
+	UsedMemory   int64  `json:"usedMemory"`
+	// MaxMemory is 0 when unlimited or on redis older than 3.2
+	MaxMemory        int64 `json:"maxMemory"`
+	ConnectedClients int64 `json:"connectedClients"`
+	EvictedKeys      int64 `json:"evictedKeys"`
+	KeyspaceHits     int64 `json:"keyspaceHits"`
+	KeyspaceMisses   int64 `json:"keyspaceMisses"`
+	// LastBgsaveStatus is ok or err
+	LastBgsaveStatus string `json:"lastBgsaveStatus,omitempty"`
+	// StartTime is when redis started, worked out from uptime_in_seconds so
+	// that it stays put from one poll to the next
+	StartTime metav1.Time `json:"startTime,omitempty"`
+	// Error is why the last poll failed, the figures are then the previous ones
+	Error string `json:"error,omitempty"`
+}
+
+type RedisStatus struct {
+	// Phase is for kubectl get, the conditions tell the details
+	Phase              RedisPhase         `json:"phase,omitempty"`
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []RedisCondition   `json:"conditions,omitempty"`
+	Children           []RedisChildStatus `json:"children,omitempty"`
+	Nodes              []RedisNodeStatus  `json:"nodes,omitempty"`
+	// Cluster is only set in cluster mode
+	Cluster *RedisClusterStatus `json:"cluster,omitempty"`
+	// HotAppliedConfig are the directives last changed on the running pods
+	// with CONFIG SET instead of a restart
+	HotAppliedConfig []RedisHotAppliedDirective `json:"hotAppliedConfig,omitempty"`
+	// Instances are polled with INFO every infoPollInterval
+	Instances []RedisInstanceStatus `json:"instances,omitempty"`
+}
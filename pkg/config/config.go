@@ -0,0 +1,410 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flexshopper/redis-operator/pkg/memory"
+)
+
+// Directive is one line of redis.conf
+type Directive struct {
+	Name string
+	Args []string
+}
+
+func (d Directive) String() string {
+	quoted := make([]string, len(d.Args))
+	for i, arg := range d.Args {
+		quoted[i] = quoteArg(arg)
+	}
+
+	return strings.TrimSpace(d.Name + " " + strings.Join(quoted, " "))
+}
+
+// For returns the directive the way version spells it
+func (d Directive) For(version Version) Directive {
+	definition, ok := Lookup(d.Name)
+	if !ok {
+		return d
+	}
+
+	args := d.Args
+	// the client class was renamed along with the replication directives
+	if definition.Name == "client-output-buffer-limit" && len(args) > 0 {
+		args = append([]string(nil), args...)
+		if args[0] == "slave" && !version.Less(Version{Major: 5}) {
+			args[0] = "replica"
+		} else if args[0] == "replica" && version.Less(Version{Major: 5}) {
+			args[0] = "slave"
+		}
+	}
+
+	return Directive{Name: definition.NameFor(version), Args: args}
+}
+
+// canonicalName is the current name of a directive known by an older one
+func canonicalName(name string) string {
+	if definition, ok := Lookup(name); ok {
+		return definition.Name
+	}
+
+	return strings.ToLower(name)
+}
+
+// Config is an ordered set of directives, rendered as redis.conf
+type Config struct {
+	directives []Directive
+}
+
+// Set replaces every occurrence of a directive, in place of the first one
+func (c *Config) Set(name string, args ...string) {
+	c.Replace(name, []Directive{{Name: canonicalName(name), Args: args}})
+}
+
+// Replace swaps every occurrence of a directive for directives
+func (c *Config) Replace(name string, directives []Directive) {
+	name = canonicalName(name)
+
+	var replaced []Directive
+	done := false
+	for _, directive := range c.directives {
+		if directive.Name != name {
+			replaced = append(replaced, directive)
+		} else if !done {
+			replaced = append(replaced, directives...)
+			done = true
+		}
+	}
+
+	if !done {
+		replaced = append(replaced, directives...)
+	}
+
+	c.directives = replaced
+}
+
+// Add appends an occurrence of a repeatable directive
+func (c *Config) Add(name string, args ...string) {
+	c.directives = append(c.directives, Directive{Name: canonicalName(name), Args: args})
+}
+
+func (c *Config) Unset(name string) {
+	name = canonicalName(name)
+
+	var kept []Directive
+	for _, directive := range c.directives {
+		if directive.Name != name {
+			kept = append(kept, directive)
+		}
+	}
+
+	c.directives = kept
+}
+
+// Get returns every occurrence of a directive
+func (c *Config) Get(name string) []Directive {
+	name = canonicalName(name)
+
+	var found []Directive
+	for _, directive := range c.directives {
+		if directive.Name == name {
+			found = append(found, directive)
+		}
+	}
+
+	return found
+}
+
+func (c *Config) Directives() []Directive {
+	return append([]Directive(nil), c.directives...)
+}
+
+// Split separates the directives redis only reads at startup from the ones
+// CONFIG SET can change
+func (c *Config) Split() (*Config, *Config) {
+	restart, runtime := &Config{}, &Config{}
+	for _, directive := range c.directives {
+		if definition, ok := Lookup(directive.Name); ok && definition.Runtime {
+			runtime.directives = append(runtime.directives, directive)
+		} else {
+			restart.directives = append(restart.directives, directive)
+		}
+	}
+
+	return restart, runtime
+}
+
+// Settings are the directives as CONFIG SET takes them: the name version
+// knows and the arguments of every occurrence in a single value
+func (c *Config) Settings(version Version) map[string]string {
+	settings := map[string]string{}
+	for _, directive := range c.directives {
+		directive = directive.For(version)
+		value := strings.Join(directive.Args, " ")
+		if previous, ok := settings[directive.Name]; ok && value != "" {
+			value = previous + " " + value
+		}
+
+		settings[directive.Name] = value
+	}
+
+	return settings
+}
+
+// Render writes the directives grouped by section, in the order they were
+// set within a section, with the names version knows them by
+func (c *Config) Render(version Version) string {
+	bySection := map[Section][]Directive{}
+	for _, directive := range c.directives {
+		section := SectionAdvanced
+		if definition, ok := Lookup(directive.Name); ok {
+			section = definition.Section
+		}
+
+		bySection[section] = append(bySection[section], directive)
+	}
+
+	var output bytes.Buffer
+	fmt.Fprintf(&output, "# Rendered by the redis operator for redis %s, changes are overwritten\n", version)
+
+	for _, section := range sections {
+		if len(bySection[section]) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&output, "\n# %s\n", section)
+		for _, directive := range bySection[section] {
+			output.WriteString(directive.For(version).String() + "\n")
+		}
+	}
+
+	return output.String()
+}
+
+// ParseDirective checks a value against the definition of a directive and
+// splits it into the arguments of each occurrence
+func ParseDirective(name, value string) ([]Directive, error) {
+	definition, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown directive %s", name)
+	}
+
+	args, err := splitArgs(value)
+	if err != nil {
+		return nil, fmt.Errorf("directive %s: %v", definition.Name, err)
+	}
+
+	// an empty value clears a repeatable directive, e.g. save ""
+	if definition.Repeatable && len(args) == 1 && args[0] == "" {
+		return []Directive{{Name: definition.Name, Args: args}}, nil
+	}
+
+	count := len(definition.Args)
+	switch {
+	case definition.Variadic && len(args) >= count:
+	case definition.Repeatable && len(args) > 0 && len(args)%count == 0:
+	case len(args) == count:
+	default:
+		return nil, fmt.Errorf("directive %s takes %d arguments, got %d", definition.Name, count, len(args))
+	}
+
+	step := len(args)
+	if definition.Repeatable {
+		step = count
+	}
+
+	var directives []Directive
+	for start := 0; start < len(args); start += step {
+		occurrence := args[start : start+step]
+		for i, arg := range occurrence {
+			spec := definition.Args[count-1]
+			if i < count {
+				spec = definition.Args[i]
+			}
+
+			err = checkArg(spec, arg)
+			if err != nil {
+				return nil, fmt.Errorf("directive %s: %v", definition.Name, err)
+			}
+
+			// kubernetes quantities such as 512Mi are rewritten for redis.conf
+			if spec.Kind == ArgMemory {
+				occurrence[i], _ = memory.Normalize(arg)
+			}
+		}
+
+		directives = append(directives, Directive{Name: definition.Name, Args: occurrence})
+	}
+
+	return directives, nil
+}
+
+func checkArg(spec Arg, arg string) error {
+	switch spec.Kind {
+	case ArgInt:
+		if _, err := strconv.ParseInt(arg, 10, 64); err != nil {
+			return fmt.Errorf("%q is not an integer", arg)
+		}
+	case ArgYesNo:
+		if arg != "yes" && arg != "no" {
+			return fmt.Errorf("%q must be yes or no", arg)
+		}
+	case ArgMemory:
+		if _, err := memory.Parse(arg); err != nil {
+			return err
+		}
+	case ArgEnum:
+		for _, value := range spec.Values {
+			if arg == value {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%q must be one of %s", arg, strings.Join(spec.Values, ", "))
+	}
+
+	return nil
+}
+
+// splitArgs splits a value the way redis reads a config line, arguments may
+// be double quoted
+func splitArgs(value string) ([]string, error) {
+	var args []string
+	rest := strings.TrimSpace(value)
+
+	for rest != "" {
+		if rest[0] != '"' {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+
+			args = append(args, rest[:end])
+			rest = strings.TrimSpace(rest[end:])
+			continue
+		}
+
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+
+		if end >= len(rest) {
+			return nil, fmt.Errorf("unbalanced quotes in %q", value)
+		}
+
+		arg, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed quoted argument in %q", value)
+		}
+
+		args = append(args, arg)
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	// an empty value is an empty argument, e.g. notify-keyspace-events ""
+	if args == nil {
+		args = []string{""}
+	}
+
+	return args, nil
+}
+
+// quoteArg quotes an argument the way redis-server splits redis.conf lines,
+// control characters are escaped: a raw newline would start a directive of
+// its own
+func quoteArg(arg string) string {
+	needsQuotes := arg == ""
+	for i := 0; i < len(arg) && !needsQuotes; i++ {
+		needsQuotes = isControl(arg[i]) || strings.IndexByte(" \"'\\#", arg[i]) >= 0
+	}
+
+	if !needsQuotes {
+		return arg
+	}
+
+	// strconv.Quote escapes more than redis-server understands, e.g. \v or
+	// \u, only \n \r \t \a \b and \xHH are common to both
+	var quoted bytes.Buffer
+	quoted.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		switch c := arg[i]; c {
+		case '"', '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteByte(c)
+		case '\n':
+			quoted.WriteString(`\n`)
+		case '\r':
+			quoted.WriteString(`\r`)
+		case '\t':
+			quoted.WriteString(`\t`)
+		case '\a':
+			quoted.WriteString(`\a`)
+		case '\b':
+			quoted.WriteString(`\b`)
+		default:
+			if isControl(c) {
+				fmt.Fprintf(&quoted, `\x%02x`, c)
+			} else {
+				quoted.WriteByte(c)
+			}
+		}
+	}
+	quoted.WriteByte('"')
+
+	return quoted.String()
+}
+
+func isControl(c byte) bool {
+	return c < 0x20 || c == 0x7f
+}
+
+// ValidateConfig checks the directives of spec.config against version, the
+// ones managed by the operator through the spec are refused
+func ValidateConfig(config map[string]string, version Version) []string {
+	var names []string
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var validationErrors []string
+	for _, name := range names {
+		definition, known := Lookup(name)
+		if known && !definition.SupportedBy(version) {
+			validationErrors = append(validationErrors, fmt.Sprintf(
+				"config directive ( %s ) needs redis %s or later, the instance runs %s",
+				name, definition.MinVersion, version))
+			continue
+		}
+
+		if !known {
+			validationErrors = append(validationErrors, fmt.Sprintf("config directive ( %s ) is unknown", name))
+			continue
+		}
+
+		if field, managed := managedDirectives[definition.Name]; managed {
+			message := fmt.Sprintf("config directive ( %s ) is managed by the operator", name)
+			if field != "" {
+				message += ", use spec." + field
+			}
+
+			validationErrors = append(validationErrors, message)
+			continue
+		}
+
+		_, err := ParseDirective(name, config[name])
+		if err != nil {
+			validationErrors = append(validationErrors, fmt.Sprintf("config directive ( %s ) is invalid: %v", name, err))
+		}
+	}
+
+	return validationErrors
+}
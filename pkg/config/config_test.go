@@ -0,0 +1,57 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuoteArg(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{arg: "yes", want: "yes"},
+		{arg: "", want: `""`},
+		{arg: "with space", want: `"with space"`},
+		{arg: `with "quotes"`, want: `"with \"quotes\""`},
+		{arg: `back\slash`, want: `"back\\slash"`},
+		{arg: "#comment", want: `"#comment"`},
+		{arg: "it's", want: `"it's"`},
+		{arg: "tab\there", want: `"tab\there"`},
+		{arg: "s3cret\nrequirepass", want: `"s3cret\nrequirepass"`},
+		{arg: "s3cret\r\nslaveof evil 6379", want: `"s3cret\r\nslaveof evil 6379"`},
+		{arg: "bell\a", want: `"bell\a"`},
+		{arg: "nul\x00vt\x0bdel\x7f", want: `"nul\x00vt\x0bdel\x7f"`},
+		{arg: "ünïcode", want: "ünïcode"},
+	}
+
+	for _, test := range tests {
+		got := quoteArg(test.arg)
+		if got != test.want {
+			t.Errorf("%q: got %s, want %s", test.arg, got, test.want)
+		}
+
+		// the operator reads back what it renders
+		args, err := splitArgs(got)
+		if err != nil || !reflect.DeepEqual(args, []string{test.arg}) {
+			t.Errorf("%q: %s splits into %q, error %v", test.arg, got, args, err)
+		}
+	}
+}
+
+func TestDirectiveString(t *testing.T) {
+	tests := []struct {
+		directive Directive
+		want      string
+	}{
+		{directive: Directive{Name: "save", Args: []string{"900", "1"}}, want: "save 900 1"},
+		{directive: Directive{Name: "notify-keyspace-events", Args: []string{""}}, want: `notify-keyspace-events ""`},
+		{directive: Directive{Name: "pidfile", Args: []string{"/tmp/x\nrename-command CONFIG \"\""}}, want: `pidfile "/tmp/x\nrename-command CONFIG \"\""`},
+	}
+
+	for _, test := range tests {
+		if got := test.directive.String(); got != test.want {
+			t.Errorf("got %s, want %s", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package config
+
+import "strings"
+
+// Section groups directives the way redis.conf does
+type Section string
+
+const (
+	SectionNetwork      Section = "NETWORK"
+	SectionGeneral      Section = "GENERAL"
+	SectionSnapshotting Section = "SNAPSHOTTING"
+	SectionReplication  Section = "REPLICATION"
+	SectionSecurity     Section = "SECURITY"
+	SectionClients      Section = "CLIENTS"
+	SectionMemory       Section = "MEMORY MANAGEMENT"
+	SectionLazyFree     Section = "LAZY FREEING"
+	SectionAppendOnly   Section = "APPEND ONLY MODE"
+	SectionLua          Section = "LUA SCRIPTING"
+	SectionCluster      Section = "REDIS CLUSTER"
+	SectionSlowLog      Section = "SLOW LOG"
+	SectionLatency      Section = "LATENCY MONITOR"
+	SectionEvents       Section = "EVENT NOTIFICATION"
+	SectionAdvanced     Section = "ADVANCED CONFIG"
+	SectionDefrag       Section = "ACTIVE DEFRAGMENTATION"
+)
+
+// sections is the order sections are rendered in
+var sections = []Section{
+	SectionNetwork,
+	SectionGeneral,
+	SectionSnapshotting,
+	SectionReplication,
+	SectionSecurity,
+	SectionClients,
+	SectionMemory,
+	SectionLazyFree,
+	SectionAppendOnly,
+	SectionLua,
+	SectionCluster,
+	SectionSlowLog,
+	SectionLatency,
+	SectionEvents,
+	SectionAdvanced,
+	SectionDefrag,
+}
+
+// ArgKind is the type of value a directive argument takes
+type ArgKind int
+
+const (
+	ArgString ArgKind = iota
+	ArgInt
+	ArgYesNo
+	// ArgMemory is a size such as 100mb, see the units note of redis.conf
+	ArgMemory
+	// ArgEnum is one of Arg.Values
+	ArgEnum
+)
+
+type Arg struct {
+	Kind   ArgKind
+	Values []string
+}
+
+// Definition describes a directive redis.conf accepts
+type Definition struct {
+	Name    string
+	Section Section
+	// Args are the arguments of one occurrence of the directive
+	Args []Arg
+	// Variadic directives repeat their last argument, e.g. bind
+	Variadic bool
+	// Repeatable directives may appear several times, e.g. save. Their
+	// values list the arguments of every occurrence one after the other,
+	// the way CONFIG SET takes them.
+	Repeatable bool
+	// Runtime is true when CONFIG SET can change it on a running server
+	Runtime bool
+	// MinVersion is the first redis version that knows the directive
+	MinVersion string
+	// Renames are the names older versions know the directive by
+	Renames []Rename
+}
+
+// Rename is the name a directive had before a version
+type Rename struct {
+	Before string
+	Name   string
+}
+
+// NameFor is the name version knows the directive by
+func (d *Definition) NameFor(version Version) string {
+	name := d.Name
+	// the renames are listed oldest first
+	for i := len(d.Renames) - 1; i >= 0; i-- {
+		if version.Less(MustParseVersion(d.Renames[i].Before)) {
+			name = d.Renames[i].Name
+		}
+	}
+
+	return name
+}
+
+// SupportedBy tells whether version knows the directive at all
+func (d *Definition) SupportedBy(version Version) bool {
+	return d.MinVersion == "" || !version.Less(MustParseVersion(d.MinVersion))
+}
+
+var (
+	stringArg = Arg{Kind: ArgString}
+	intArg    = Arg{Kind: ArgInt}
+	yesNoArg  = Arg{Kind: ArgYesNo}
+	memoryArg = Arg{Kind: ArgMemory}
+)
+
+func enumArg(values ...string) Arg {
+	return Arg{Kind: ArgEnum, Values: values}
+}
+
+func args(a ...Arg) []Arg {
+	return a
+}
+
+var definitions = []Definition{
+	{Name: "bind", Section: SectionNetwork, Args: args(stringArg), Variadic: true},
+	{Name: "protected-mode", Section: SectionNetwork, Args: args(yesNoArg), Runtime: true, MinVersion: "3.2"},
+	{Name: "port", Section: SectionNetwork, Args: args(intArg)},
+	{Name: "tcp-backlog", Section: SectionNetwork, Args: args(intArg)},
+	{Name: "unixsocket", Section: SectionNetwork, Args: args(stringArg)},
+	{Name: "unixsocketperm", Section: SectionNetwork, Args: args(intArg)},
+	{Name: "timeout", Section: SectionNetwork, Args: args(intArg), Runtime: true},
+	{Name: "tcp-keepalive", Section: SectionNetwork, Args: args(intArg), Runtime: true},
+	{Name: "tls-port", Section: SectionNetwork, Args: args(intArg), MinVersion: "6.0"},
+	{Name: "tls-cert-file", Section: SectionNetwork, Args: args(stringArg), Runtime: true, MinVersion: "6.0"},
+	{Name: "tls-key-file", Section: SectionNetwork, Args: args(stringArg), Runtime: true, MinVersion: "6.0"},
+	{Name: "tls-ca-cert-file", Section: SectionNetwork, Args: args(stringArg), Runtime: true, MinVersion: "6.0"},
+	{Name: "tls-auth-clients", Section: SectionNetwork, Args: args(enumArg("yes", "no", "optional")), Runtime: true, MinVersion: "6.0"},
+	{Name: "tls-replication", Section: SectionNetwork, Args: args(yesNoArg), Runtime: true, MinVersion: "6.0"},
+	{Name: "tls-cluster", Section: SectionNetwork, Args: args(yesNoArg), Runtime: true, MinVersion: "6.0"},
+	{Name: "tls-protocols", Section: SectionNetwork, Args: args(stringArg), Variadic: true, Runtime: true, MinVersion: "6.0"},
+
+	{Name: "daemonize", Section: SectionGeneral, Args: args(yesNoArg)},
+	{Name: "supervised", Section: SectionGeneral, Args: args(enumArg("no", "upstart", "systemd", "auto")), MinVersion: "3.2"},
+	{Name: "pidfile", Section: SectionGeneral, Args: args(stringArg)},
+	{Name: "loglevel", Section: SectionGeneral, Args: args(enumArg("debug", "verbose", "notice", "warning")), Runtime: true},
+	{Name: "logfile", Section: SectionGeneral, Args: args(stringArg)},
+	{Name: "syslog-enabled", Section: SectionGeneral, Args: args(yesNoArg)},
+	{Name: "syslog-ident", Section: SectionGeneral, Args: args(stringArg)},
+	{Name: "syslog-facility", Section: SectionGeneral, Args: args(stringArg)},
+	{Name: "databases", Section: SectionGeneral, Args: args(intArg)},
+	{Name: "always-show-logo", Section: SectionGeneral, Args: args(yesNoArg), MinVersion: "4.0"},
+
+	{Name: "save", Section: SectionSnapshotting, Args: args(intArg, intArg), Repeatable: true, Runtime: true},
+	{Name: "stop-writes-on-bgsave-error", Section: SectionSnapshotting, Args: args(yesNoArg), Runtime: true},
+	{Name: "rdbcompression", Section: SectionSnapshotting, Args: args(yesNoArg), Runtime: true},
+	{Name: "rdbchecksum", Section: SectionSnapshotting, Args: args(yesNoArg), Runtime: true},
+	{Name: "dbfilename", Section: SectionSnapshotting, Args: args(stringArg), Runtime: true},
+	{Name: "dir", Section: SectionSnapshotting, Args: args(stringArg), Runtime: true},
+
+	{Name: "replicaof", Section: SectionReplication, Args: args(stringArg, intArg), Renames: []Rename{{Before: "5.0", Name: "slaveof"}}},
+	{Name: "masterauth", Section: SectionReplication, Args: args(stringArg), Runtime: true},
+	{Name: "replica-serve-stale-data", Section: SectionReplication, Args: args(yesNoArg), Runtime: true, Renames: []Rename{{Before: "5.0", Name: "slave-serve-stale-data"}}},
+	{Name: "replica-read-only", Section: SectionReplication, Args: args(yesNoArg), Runtime: true, Renames: []Rename{{Before: "5.0", Name: "slave-read-only"}}},
+	{Name: "repl-diskless-sync", Section: SectionReplication, Args: args(yesNoArg), Runtime: true, MinVersion: "2.8.18"},
+	{Name: "repl-diskless-load", Section: SectionReplication, Args: args(enumArg("disabled", "on-empty-db", "swapdb")), Runtime: true, MinVersion: "6.0"},
+	{Name: "replica-ignore-maxmemory", Section: SectionReplication, Args: args(yesNoArg), Runtime: true, MinVersion: "5.0"},
+	{Name: "repl-diskless-sync-delay", Section: SectionReplication, Args: args(intArg), Runtime: true, MinVersion: "2.8.18"},
+	{Name: "repl-ping-replica-period", Section: SectionReplication, Args: args(intArg), Runtime: true, Renames: []Rename{{Before: "5.0", Name: "repl-ping-slave-period"}}},
+	{Name: "repl-timeout", Section: SectionReplication, Args: args(intArg), Runtime: true},
+	{Name: "repl-disable-tcp-nodelay", Section: SectionReplication, Args: args(yesNoArg), Runtime: true},
+	{Name: "repl-backlog-size", Section: SectionReplication, Args: args(memoryArg), Runtime: true},
+	{Name: "repl-backlog-ttl", Section: SectionReplication, Args: args(intArg), Runtime: true},
+	{Name: "replica-priority", Section: SectionReplication, Args: args(intArg), Runtime: true, Renames: []Rename{{Before: "5.0", Name: "slave-priority"}}},
+	{Name: "min-replicas-to-write", Section: SectionReplication, Args: args(intArg), Runtime: true, Renames: []Rename{{Before: "5.0", Name: "min-slaves-to-write"}}},
+	{Name: "min-replicas-max-lag", Section: SectionReplication, Args: args(intArg), Runtime: true, Renames: []Rename{{Before: "5.0", Name: "min-slaves-max-lag"}}},
+	{Name: "replica-announce-ip", Section: SectionReplication, Args: args(stringArg), Runtime: true, MinVersion: "3.2.2", Renames: []Rename{{Before: "5.0", Name: "slave-announce-ip"}}},
+	{Name: "replica-announce-port", Section: SectionReplication, Args: args(intArg), Runtime: true, MinVersion: "3.2.2", Renames: []Rename{{Before: "5.0", Name: "slave-announce-port"}}},
+
+	{Name: "requirepass", Section: SectionSecurity, Args: args(stringArg), Runtime: true},
+	{Name: "rename-command", Section: SectionSecurity, Args: args(stringArg, stringArg), Repeatable: true},
+	{Name: "aclfile", Section: SectionSecurity, Args: args(stringArg), MinVersion: "6.0"},
+	{Name: "acllog-max-len", Section: SectionSecurity, Args: args(intArg), Runtime: true, MinVersion: "6.0"},
+	{Name: "enable-debug-command", Section: SectionSecurity, Args: args(enumArg("yes", "no", "local")), MinVersion: "7.0"},
+	{Name: "enable-module-command", Section: SectionSecurity, Args: args(enumArg("yes", "no", "local")), MinVersion: "7.0"},
+	{Name: "enable-protected-configs", Section: SectionSecurity, Args: args(enumArg("yes", "no", "local")), MinVersion: "7.0"},
+
+	{Name: "maxclients", Section: SectionClients, Args: args(intArg), Runtime: true},
+	{Name: "io-threads", Section: SectionClients, Args: args(intArg), MinVersion: "6.0"},
+	{Name: "io-threads-do-reads", Section: SectionClients, Args: args(yesNoArg), MinVersion: "6.0"},
+
+	{Name: "maxmemory", Section: SectionMemory, Args: args(memoryArg), Runtime: true},
+	{Name: "maxmemory-policy", Section: SectionMemory, Args: args(enumArg(
+		"volatile-lru", "allkeys-lru", "volatile-lfu", "allkeys-lfu",
+		"volatile-random", "allkeys-random", "volatile-ttl", "noeviction")), Runtime: true},
+	{Name: "maxmemory-samples", Section: SectionMemory, Args: args(intArg), Runtime: true},
+
+	{Name: "lazyfree-lazy-eviction", Section: SectionLazyFree, Args: args(yesNoArg), Runtime: true, MinVersion: "4.0"},
+	{Name: "lazyfree-lazy-expire", Section: SectionLazyFree, Args: args(yesNoArg), Runtime: true, MinVersion: "4.0"},
+	{Name: "lazyfree-lazy-server-del", Section: SectionLazyFree, Args: args(yesNoArg), Runtime: true, MinVersion: "4.0"},
+	{Name: "replica-lazy-flush", Section: SectionLazyFree, Args: args(yesNoArg), Runtime: true, MinVersion: "4.0", Renames: []Rename{{Before: "5.0", Name: "slave-lazy-flush"}}},
+
+	{Name: "lazyfree-lazy-user-del", Section: SectionLazyFree, Args: args(yesNoArg), Runtime: true, MinVersion: "6.0"},
+
+	{Name: "appendonly", Section: SectionAppendOnly, Args: args(yesNoArg), Runtime: true},
+	{Name: "appendfilename", Section: SectionAppendOnly, Args: args(stringArg)},
+	{Name: "appendfsync", Section: SectionAppendOnly, Args: args(enumArg("always", "everysec", "no")), Runtime: true},
+	{Name: "no-appendfsync-on-rewrite", Section: SectionAppendOnly, Args: args(yesNoArg), Runtime: true},
+	{Name: "auto-aof-rewrite-percentage", Section: SectionAppendOnly, Args: args(intArg), Runtime: true},
+	{Name: "auto-aof-rewrite-min-size", Section: SectionAppendOnly, Args: args(memoryArg), Runtime: true},
+	{Name: "aof-load-truncated", Section: SectionAppendOnly, Args: args(yesNoArg), Runtime: true, MinVersion: "3.0"},
+	{Name: "aof-use-rdb-preamble", Section: SectionAppendOnly, Args: args(yesNoArg), Runtime: true, MinVersion: "4.0"},
+
+	{Name: "busy-reply-threshold", Section: SectionLua, Args: args(intArg), Runtime: true, Renames: []Rename{{Before: "7.0", Name: "lua-time-limit"}}},
+
+	{Name: "cluster-enabled", Section: SectionCluster, Args: args(yesNoArg), MinVersion: "3.0"},
+	{Name: "cluster-config-file", Section: SectionCluster, Args: args(stringArg), MinVersion: "3.0"},
+	{Name: "cluster-node-timeout", Section: SectionCluster, Args: args(intArg), Runtime: true, MinVersion: "3.0"},
+	{Name: "cluster-replica-validity-factor", Section: SectionCluster, Args: args(intArg), Runtime: true, MinVersion: "3.0", Renames: []Rename{{Before: "5.0", Name: "cluster-slave-validity-factor"}}},
+	{Name: "cluster-migration-barrier", Section: SectionCluster, Args: args(intArg), Runtime: true, MinVersion: "3.0"},
+	{Name: "cluster-require-full-coverage", Section: SectionCluster, Args: args(yesNoArg), Runtime: true, MinVersion: "3.0"},
+	{Name: "cluster-replica-no-failover", Section: SectionCluster, Args: args(yesNoArg), Runtime: true, MinVersion: "4.0", Renames: []Rename{{Before: "5.0", Name: "cluster-slave-no-failover"}}},
+	{Name: "cluster-announce-ip", Section: SectionCluster, Args: args(stringArg), Runtime: true, MinVersion: "4.0"},
+	{Name: "cluster-announce-port", Section: SectionCluster, Args: args(intArg), Runtime: true, MinVersion: "4.0"},
+	{Name: "cluster-announce-bus-port", Section: SectionCluster, Args: args(intArg), Runtime: true, MinVersion: "4.0"},
+
+	{Name: "slowlog-log-slower-than", Section: SectionSlowLog, Args: args(intArg), Runtime: true},
+	{Name: "slowlog-max-len", Section: SectionSlowLog, Args: args(intArg), Runtime: true},
+
+	{Name: "latency-monitor-threshold", Section: SectionLatency, Args: args(intArg), Runtime: true, MinVersion: "2.8.13"},
+
+	{Name: "notify-keyspace-events", Section: SectionEvents, Args: args(stringArg), Runtime: true, MinVersion: "2.8"},
+
+	{Name: "hash-max-listpack-entries", Section: SectionAdvanced, Args: args(intArg), Runtime: true, Renames: []Rename{{Before: "7.0", Name: "hash-max-ziplist-entries"}}},
+	{Name: "hash-max-listpack-value", Section: SectionAdvanced, Args: args(intArg), Runtime: true, Renames: []Rename{{Before: "7.0", Name: "hash-max-ziplist-value"}}},
+	{Name: "list-max-listpack-size", Section: SectionAdvanced, Args: args(intArg), Runtime: true, MinVersion: "3.2", Renames: []Rename{{Before: "7.0", Name: "list-max-ziplist-size"}}},
+	{Name: "list-compress-depth", Section: SectionAdvanced, Args: args(intArg), Runtime: true, MinVersion: "3.2"},
+	{Name: "set-max-intset-entries", Section: SectionAdvanced, Args: args(intArg), Runtime: true},
+	{Name: "zset-max-listpack-entries", Section: SectionAdvanced, Args: args(intArg), Runtime: true, Renames: []Rename{{Before: "7.0", Name: "zset-max-ziplist-entries"}}},
+	{Name: "zset-max-listpack-value", Section: SectionAdvanced, Args: args(intArg), Runtime: true, Renames: []Rename{{Before: "7.0", Name: "zset-max-ziplist-value"}}},
+	{Name: "hll-sparse-max-bytes", Section: SectionAdvanced, Args: args(intArg), Runtime: true, MinVersion: "2.8.9"},
+	{Name: "activerehashing", Section: SectionAdvanced, Args: args(yesNoArg), Runtime: true},
+	{Name: "client-output-buffer-limit", Section: SectionAdvanced,
+		Args:       args(enumArg("normal", "replica", "slave", "pubsub"), memoryArg, memoryArg, intArg),
+		Repeatable: true, Runtime: true},
+	{Name: "hz", Section: SectionAdvanced, Args: args(intArg), Runtime: true},
+	{Name: "dynamic-hz", Section: SectionAdvanced, Args: args(yesNoArg), Runtime: true, MinVersion: "5.0"},
+	{Name: "rdb-save-incremental-fsync", Section: SectionAdvanced, Args: args(yesNoArg), Runtime: true, MinVersion: "5.0"},
+	{Name: "stream-node-max-bytes", Section: SectionAdvanced, Args: args(memoryArg), Runtime: true, MinVersion: "5.0"},
+	{Name: "stream-node-max-entries", Section: SectionAdvanced, Args: args(intArg), Runtime: true, MinVersion: "5.0"},
+	{Name: "oom-score-adj", Section: SectionAdvanced, Args: args(enumArg("yes", "no", "relative", "absolute")), Runtime: true, MinVersion: "6.2"},
+	{Name: "aof-rewrite-incremental-fsync", Section: SectionAdvanced, Args: args(yesNoArg), Runtime: true},
+	{Name: "lfu-log-factor", Section: SectionAdvanced, Args: args(intArg), Runtime: true, MinVersion: "4.0"},
+	{Name: "lfu-decay-time", Section: SectionAdvanced, Args: args(intArg), Runtime: true, MinVersion: "4.0"},
+
+	{Name: "activedefrag", Section: SectionDefrag, Args: args(yesNoArg), Runtime: true, MinVersion: "4.0"},
+	{Name: "active-defrag-ignore-bytes", Section: SectionDefrag, Args: args(memoryArg), Runtime: true, MinVersion: "4.0"},
+	{Name: "active-defrag-threshold-lower", Section: SectionDefrag, Args: args(intArg), Runtime: true, MinVersion: "4.0"},
+	{Name: "active-defrag-threshold-upper", Section: SectionDefrag, Args: args(intArg), Runtime: true, MinVersion: "4.0"},
+	{Name: "active-defrag-cycle-min", Section: SectionDefrag, Args: args(intArg), Runtime: true, MinVersion: "4.0"},
+	{Name: "active-defrag-cycle-max", Section: SectionDefrag, Args: args(intArg), Runtime: true, MinVersion: "4.0"},
+}
+
+// Lookup returns the definition of a directive by its current or former
+// name, names are case insensitive like in redis.conf
+func Lookup(name string) (*Definition, bool) {
+	name = strings.ToLower(name)
+	for i := range definitions {
+		if definitions[i].Name == name {
+			return &definitions[i], true
+		}
+
+		for _, rename := range definitions[i].Renames {
+			if rename.Name == name {
+				return &definitions[i], true
+			}
+		}
+	}
+
+	return nil, false
+}
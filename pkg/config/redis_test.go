@@ -0,0 +1,271 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+)
+
+func TestBuildConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		spec    v1alpha2.RedisSpec
+		want    []string
+		not     []string
+		err     string
+	}{
+		{
+			name:    "current names",
+			version: "7.0",
+			want: []string{
+				"replica-read-only yes",
+				"replica-priority 100",
+				"hash-max-listpack-entries 512",
+				"list-max-listpack-size -2",
+				"busy-reply-threshold 5000",
+				"client-output-buffer-limit replica 256mb 64mb 60",
+			},
+			not: []string{"slave-read-only", "hash-max-ziplist-entries", "lua-time-limit"},
+		},
+		{
+			name:    "names before 7.0",
+			version: "6.2",
+			want: []string{
+				"replica-read-only yes",
+				"hash-max-ziplist-entries 512",
+				"list-max-ziplist-size -2",
+				"lua-time-limit 5000",
+			},
+			not: []string{"hash-max-listpack-entries", "busy-reply-threshold"},
+		},
+		{
+			name:    "names before 5.0",
+			version: "4.0",
+			want: []string{
+				"slave-read-only yes",
+				"slave-serve-stale-data yes",
+				"slave-priority 100",
+				"slave-lazy-flush no",
+				"client-output-buffer-limit slave 256mb 64mb 60",
+				"always-show-logo yes",
+			},
+			not: []string{"replica-read-only", "replica-priority"},
+		},
+		{
+			name:    "defaults newer than the version are left out",
+			version: "3.0",
+			want:    []string{"slave-read-only yes", "hash-max-ziplist-entries 512"},
+			not:     []string{"protected-mode", "supervised", "always-show-logo", "list-max-ziplist-size"},
+		},
+		{
+			name:    "override by the old name",
+			version: "7.0",
+			spec:    v1alpha2.RedisSpec{Config: map[string]string{"slave-priority": "10"}},
+			want:    []string{"replica-priority 10"},
+			not:     []string{"replica-priority 100", "slave-priority"},
+		},
+		{
+			name:    "override by the new name on an old version",
+			version: "4.0",
+			spec:    v1alpha2.RedisSpec{Config: map[string]string{"replica-priority": "10"}},
+			want:    []string{"slave-priority 10"},
+			not:     []string{"slave-priority 100", "replica-priority"},
+		},
+		{
+			name:    "directive as new as the version",
+			version: "6.0",
+			spec:    v1alpha2.RedisSpec{Config: map[string]string{"tls-port": "6380"}},
+			want:    []string{"tls-port 6380"},
+		},
+		{
+			name:    "directive newer than the version",
+			version: "5.0",
+			spec:    v1alpha2.RedisSpec{Config: map[string]string{"tls-port": "6380"}},
+			err:     "directive tls-port needs redis 6.0 or later",
+		},
+		{
+			name:    "directive newer than the minor version",
+			version: "6.2",
+			spec:    v1alpha2.RedisSpec{Config: map[string]string{"enable-debug-command": "local"}},
+			err:     "directive enable-debug-command needs redis 7.0 or later",
+		},
+		{
+			name:    "unknown directive",
+			version: "7.0",
+			spec:    v1alpha2.RedisSpec{Config: map[string]string{"no-such-directive": "yes"}},
+			err:     "unknown directive no-such-directive",
+		},
+		{
+			name:    "managed directives come from the spec",
+			version: "7.0",
+			spec: v1alpha2.RedisSpec{
+				Port:                    6380,
+				MaxMemory:               "512Mi",
+				MaxMemoryEvictionPolicy: "allkeys-lru",
+				Config:                  map[string]string{"maxmemory": "1gb", "port": "7000"},
+			},
+			want: []string{"port 6380", "maxmemory 512mb", "maxmemory-policy allkeys-lru"},
+			not:  []string{"maxmemory 1gb", "port 7000"},
+		},
+		{
+			name:    "invalid maxMemory",
+			version: "7.0",
+			spec:    v1alpha2.RedisSpec{MaxMemory: "lots"},
+			err:     "maxMemory",
+		},
+		{
+			name:    "newline in a value",
+			version: "7.0",
+			spec:    v1alpha2.RedisSpec{Config: map[string]string{"pidfile": `"/tmp/redis.pid\nrequirepass guessed"`}},
+			want:    []string{`pidfile "/tmp/redis.pid\nrequirepass guessed"`},
+			not:     []string{"requirepass"},
+		},
+		{
+			name:    "raw newline in a value",
+			version: "7.0",
+			spec:    v1alpha2.RedisSpec{Config: map[string]string{"pidfile": "/tmp/redis.pid\nenable-debug-command"}},
+			want:    []string{`pidfile "/tmp/redis.pid\nenable-debug-command"`},
+			not:     []string{"enable-debug-command"},
+		},
+		{
+			name:    "cluster mode",
+			version: "7.0",
+			spec:    v1alpha2.RedisSpec{Topology: v1alpha2.RedisTopology{Mode: v1alpha2.RedisModeCluster}},
+			want:    []string{"cluster-enabled yes", "cluster-config-file /data/nodes.conf"},
+			not:     []string{"replicaof"},
+		},
+		{
+			name:    "replicas start unattached",
+			version: "7.0",
+			spec:    v1alpha2.RedisSpec{Topology: v1alpha2.RedisTopology{Replicas: 2}},
+			want:    []string{"replicaof 127.0.0.1 1"},
+		},
+		{
+			name:    "replicas start unattached before 5.0",
+			version: "4.0",
+			spec:    v1alpha2.RedisSpec{Topology: v1alpha2.RedisTopology{Replicas: 2}},
+			want:    []string{"slaveof 127.0.0.1 1"},
+		},
+		{
+			// a restarted master reloads its data
+			name:    "replicas with persistence",
+			version: "7.0",
+			spec:    v1alpha2.RedisSpec{Topology: v1alpha2.RedisTopology{Replicas: 2}, Persistence: &v1alpha2.RedisPersistence{}},
+			not:     []string{"replicaof"},
+		},
+		{
+			name:    "single instance",
+			version: "7.0",
+			not:     []string{"replicaof"},
+		},
+	}
+
+	for _, test := range tests {
+		version := MustParseVersion(test.version)
+		config, err := BuildConfig(&test.spec, version)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+
+		rendered := config.Render(version)
+		lines := map[string]bool{}
+		for _, line := range strings.Split(rendered, "\n") {
+			lines[line] = true
+		}
+
+		for _, line := range test.want {
+			if !lines[line] {
+				t.Errorf("%s: %q not in\n%s", test.name, line, rendered)
+			}
+		}
+
+		for _, not := range test.not {
+			for line := range lines {
+				if line == not || strings.HasPrefix(line, not+" ") {
+					t.Errorf("%s: got %q", test.name, line)
+				}
+			}
+		}
+	}
+}
+
+func TestBuildConfigSettings(t *testing.T) {
+	spec := &v1alpha2.RedisSpec{Config: map[string]string{"min-replicas-to-write": "1"}}
+
+	for version, name := range map[string]string{"4.0": "min-slaves-to-write", "5.0": "min-replicas-to-write"} {
+		config, err := BuildConfig(spec, MustParseVersion(version))
+		if err != nil {
+			t.Fatalf("%s: %v", version, err)
+		}
+
+		_, runtime := config.Split()
+		settings := runtime.Settings(MustParseVersion(version))
+		if settings[name] != "1" {
+			t.Errorf("%s: got %s %q, want 1", version, name, settings[name])
+		}
+
+		if settings["save"] != "900 1 300 10 60 10000" {
+			t.Errorf("%s: got save %q, want the occurrences joined", version, settings["save"])
+		}
+	}
+}
+
+func TestParseAuthConfig(t *testing.T) {
+	tests := []struct {
+		image    string
+		password string
+		want     []string
+		not      []string
+	}{
+		{
+			image:    "redis:7.0",
+			password: "s3cret",
+			want:     []string{"requirepass s3cret", "masterauth s3cret"},
+		},
+		{
+			image:    "redis:4.0",
+			password: `with "quotes" and spaces`,
+			want:     []string{`requirepass "with \"quotes\" and spaces"`, `masterauth "with \"quotes\" and spaces"`},
+		},
+		{
+			image:    "redis:7.0",
+			password: "s3cret\nslaveof evil 6379",
+			want:     []string{`requirepass "s3cret\nslaveof evil 6379"`, `masterauth "s3cret\nslaveof evil 6379"`},
+			not:      []string{"slaveof evil 6379"},
+		},
+	}
+
+	for _, test := range tests {
+		config, err := ParseAuthConfig(&v1alpha2.RedisSpec{Image: test.image}, test.password)
+		if err != nil {
+			t.Fatalf("%s: %v", test.image, err)
+		}
+
+		lines := map[string]bool{}
+		for _, line := range strings.Split(config, "\n") {
+			lines[line] = true
+		}
+
+		for _, line := range test.want {
+			if !lines[line] {
+				t.Errorf("%s: %q not in\n%s", test.image, line, config)
+			}
+		}
+
+		for _, line := range test.not {
+			if lines[line] {
+				t.Errorf("%s: got %q", test.image, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"strconv"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+)
+
+const SentinelPort = 26379
+
+// sentinelPreamble heads sentinel.conf
+const sentinelPreamble = `# Redis Sentinel configuration file.
+#
+# The master to monitor is not listed here: the operator registers it at
+# runtime with SENTINEL MONITOR once it knows which pod is the master, and
+# sentinel persists it with CONFIG REWRITE. That's why this file is copied
+# to a writable directory before sentinel starts.
+`
+
+// sentinelDefaults are the directives of every sentinel. Sentinels find
+// each other and the replicas through the pod IPs, and write nothing but
+// their rewritten config, kept next to it.
+var sentinelDefaults = []Directive{
+	{Name: "bind", Args: []string{"0.0.0.0"}},
+	{Name: "protected-mode", Args: []string{"no"}},
+	{Name: "dir", Args: []string{"/data"}},
+}
+
+// BuildSentinelConfig is the configuration of the sentinels of an instance
+func BuildSentinelConfig(spec *v1alpha2.RedisSpec, version Version) *Config {
+	config := &Config{}
+	config.Set("port", strconv.Itoa(SentinelPort))
+
+	for _, directive := range sentinelDefaults {
+		definition, _ := Lookup(directive.Name)
+		if definition.SupportedBy(version) {
+			config.directives = append(config.directives, directive)
+		}
+	}
+
+	return config
+}
+
+func ParseSentinelConfig(spec *v1alpha2.RedisSpec) (string, error) {
+	version, err := ResolveVersion(spec)
+	if err != nil {
+		return "", err
+	}
+
+	return sentinelPreamble + "\n" + BuildSentinelConfig(spec, version).Render(version), nil
+}
+
+// SentinelMonitorSettings are applied with SENTINEL SET once the master is
+// registered, spec has its defaults set
+func SentinelMonitorSettings(spec *v1alpha2.RedisSpec) map[string]string {
+	sentinel := spec.Topology.Sentinel
+	if sentinel == nil {
+		return map[string]string{}
+	}
+
+	return map[string]string{
+		"quorum":                  strconv.Itoa(int(sentinel.Quorum)),
+		"down-after-milliseconds": strconv.Itoa(int(sentinel.DownAfterMilliseconds)),
+		"failover-timeout":        strconv.Itoa(int(sentinel.FailoverTimeout)),
+		"parallel-syncs":          strconv.Itoa(int(sentinel.ParallelSyncs)),
+	}
+}
+
+// SentinelAuthVersion is the first release whose sentinel takes requirepass
+var SentinelAuthVersion = Version{Major: 5, Minor: 0, Patch: 1}
+
+// SentinelAuthSupported tells whether the sentinels of an instance can ask
+// their clients for a password
+func SentinelAuthSupported(spec *v1alpha2.RedisSpec) (bool, error) {
+	version, err := ResolveNewestVersion(spec)
+	if err != nil {
+		return false, err
+	}
+
+	return !version.Less(SentinelAuthVersion), nil
+}
+
+// ParseSentinelAuthConfig renders the password of the sentinels, they
+// authenticate to each other with it as well. Like ParseAuthConfig it's
+// kept out of the ConfigMap, the sentinels append it to their config.
+func ParseSentinelAuthConfig(spec *v1alpha2.RedisSpec, password string) (string, error) {
+	version, err := ResolveVersion(spec)
+	if err != nil {
+		return "", err
+	}
+
+	config := &Config{}
+	config.Set("requirepass", password)
+
+	return config.Render(version), nil
+}
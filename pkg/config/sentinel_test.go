@@ -0,0 +1,107 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+)
+
+func TestParseSentinelConfig(t *testing.T) {
+	tests := []struct {
+		image string
+		want  []string
+		not   []string
+	}{
+		{
+			image: "redis:6.2-alpine",
+			want:  []string{"port 26379", "bind 0.0.0.0", "protected-mode no", "dir /data"},
+		},
+		{
+			// protected mode came with 3.2
+			image: "redis:3.0",
+			want:  []string{"port 26379", "bind 0.0.0.0", "dir /data"},
+			not:   []string{"protected-mode"},
+		},
+	}
+
+	for _, test := range tests {
+		config, err := ParseSentinelConfig(&v1alpha2.RedisSpec{Image: test.image})
+		if err != nil {
+			t.Fatalf("%s: %v", test.image, err)
+		}
+
+		lines := map[string]bool{}
+		for _, line := range strings.Split(config, "\n") {
+			lines[line] = true
+		}
+
+		for _, line := range test.want {
+			if !lines[line] {
+				t.Errorf("%s: %q not in\n%s", test.image, line, config)
+			}
+		}
+
+		for _, name := range test.not {
+			if strings.Contains(config, "\n"+name+" ") {
+				t.Errorf("%s: %s in\n%s", test.image, name, config)
+			}
+		}
+	}
+}
+
+func TestSentinelMonitorSettings(t *testing.T) {
+	redis := &v1alpha2.Redis{}
+	redis.Spec.Topology.Replicas = 2
+	redis.Spec.Topology.Sentinel = &v1alpha2.RedisSentinel{Replicas: 5, DownAfterMilliseconds: 2000}
+	redis.SetDefaults()
+
+	want := map[string]string{
+		"quorum":                  "3",
+		"down-after-milliseconds": "2000",
+		"failover-timeout":        "60000",
+		"parallel-syncs":          "1",
+	}
+
+	if settings := SentinelMonitorSettings(&redis.Spec); !reflect.DeepEqual(settings, want) {
+		t.Errorf("got %v, want %v", settings, want)
+	}
+}
+
+func TestSentinelAuthSupported(t *testing.T) {
+	tests := []struct {
+		spec v1alpha2.RedisSpec
+		want bool
+	}{
+		{spec: v1alpha2.RedisSpec{Image: "redis:4-alpine"}, want: false},
+		{spec: v1alpha2.RedisSpec{Image: "redis:5.0.0"}, want: false},
+		{spec: v1alpha2.RedisSpec{Image: "redis:5.0.1"}, want: true},
+		// redis:5 pulls the newest 5.0 release
+		{spec: v1alpha2.RedisSpec{Image: "redis:5"}, want: true},
+		{spec: v1alpha2.RedisSpec{Image: "redis"}, want: true},
+		{spec: v1alpha2.RedisSpec{Image: "redis:7.2", Version: "5.0.0"}, want: false},
+	}
+
+	for _, test := range tests {
+		got, err := SentinelAuthSupported(&test.spec)
+		if err != nil || got != test.want {
+			t.Errorf("%s %s: got %v, %v, want %v", test.spec.Image, test.spec.Version, got, err, test.want)
+		}
+	}
+}
+
+func TestParseSentinelAuthConfig(t *testing.T) {
+	config, err := ParseSentinelAuthConfig(&v1alpha2.RedisSpec{Image: "redis:6.2"}, "s3cret\nsentinel monitor evil")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(config, `requirepass "s3cret\nsentinel monitor evil"`) {
+		t.Errorf("got\n%s", config)
+	}
+
+	if strings.Contains(config, "masterauth") || strings.Contains(config, "\nsentinel") {
+		t.Errorf("got more than requirepass in\n%s", config)
+	}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+)
+
+// Version is a redis release, e.g. 6.2.5
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+var (
+	// MinVersion and MaxVersion bound the redis releases the operator can render for
+	MinVersion = Version{Major: 3}
+	MaxVersion = Version{Major: 8, Minor: 99, Patch: 99}
+	// DefaultVersion is taken for images whose tag doesn't carry a version,
+	// such as redis, redis:latest or an image pinned by digest. Those run
+	// the latest release, set spec.version when they don't.
+	DefaultVersion = Version{Major: 8}
+
+	versionPattern = regexp.MustCompile(`^v?([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?(?:[-_.].*)?$`)
+)
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less tells whether v is an older release than o
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+
+	return v.Patch < o.Patch
+}
+
+// ParseVersion reads a version such as 5, 6.2 or 7.0.11, anything after a
+// dash is ignored so image tags like 4-alpine parse as well
+func ParseVersion(s string) (Version, error) {
+	return parseVersion(s, 0)
+}
+
+// parseVersion takes the parts s leaves out as missing
+func parseVersion(s string, missing int) (Version, error) {
+	matches := versionPattern.FindStringSubmatch(s)
+	if matches == nil {
+		return Version{}, fmt.Errorf("%q is not a redis version", s)
+	}
+
+	parts := [3]int{missing, missing, missing}
+	for i, match := range matches[1:] {
+		if match != "" {
+			parts[i], _ = strconv.Atoi(match)
+		}
+	}
+
+	return Version{Major: parts[0], Minor: parts[1], Patch: parts[2]}, nil
+}
+
+// MustParseVersion is for the versions written in the directive table
+func MustParseVersion(s string) Version {
+	version, err := ParseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return version
+}
+
+// VersionFromImage reads the version from an image tag such as
+// redis:6.2-alpine, it fails on tags like latest that don't carry one
+func VersionFromImage(image string) (Version, error) {
+	return versionFromImage(image, 0)
+}
+
+func versionFromImage(image string, missing int) (Version, error) {
+	// drop a digest, then keep what follows the last colon of the name
+	name := strings.SplitN(image, "@", 2)[0]
+	colon := strings.LastIndex(name, ":")
+	if colon < 0 || colon < strings.LastIndex(name, "/") {
+		return Version{}, fmt.Errorf("image %s has no tag", image)
+	}
+
+	return parseVersion(name[colon+1:], missing)
+}
+
+// ResolveVersion is the redis version of an instance: spec.version when set,
+// otherwise the version in the image tag or DefaultVersion when the tag has
+// none
+func ResolveVersion(spec *v1alpha2.RedisSpec) (Version, error) {
+	return resolveVersion(spec, 0)
+}
+
+// ResolveNewestVersion is ResolveVersion with the parts the version leaves
+// out taken as the newest release: redis:4.0 runs 4.0.14 rather than 4.0.0.
+// It tells whether a fix of a patch release can be counted on.
+func ResolveNewestVersion(spec *v1alpha2.RedisSpec) (Version, error) {
+	return resolveVersion(spec, 99)
+}
+
+func resolveVersion(spec *v1alpha2.RedisSpec, missing int) (Version, error) {
+	version := DefaultVersion
+
+	if spec.Version != "" {
+		var err error
+		version, err = parseVersion(spec.Version, missing)
+		if err != nil {
+			return Version{}, err
+		}
+	} else if imageVersion, err := versionFromImage(spec.Image, missing); err == nil {
+		version = imageVersion
+	}
+
+	if version.Less(MinVersion) || MaxVersion.Less(version) {
+		return Version{}, fmt.Errorf("redis %s is not supported, the operator supports redis %d to %d", version, MinVersion.Major, MaxVersion.Major)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+)
+
+func TestResolveVersion(t *testing.T) {
+	tests := []struct {
+		image   string
+		version string
+		want    Version
+		err     bool
+	}{
+		{image: "redis:6.2-alpine", want: Version{Major: 6, Minor: 2}},
+		{image: "registry.local:5000/redis:5.0.14", want: Version{Major: 5, Patch: 14}},
+		{image: "redis:4-alpine", want: Version{Major: 4}},
+		{image: "redis", want: DefaultVersion},
+		{image: "redis:latest", want: DefaultVersion},
+		{image: "redis:alpine", want: DefaultVersion},
+		{image: "registry.local:5000/redis", want: DefaultVersion},
+		{image: "redis@sha256:0123456789abcdef", want: DefaultVersion},
+		{image: "redis:latest", version: "6.0", want: Version{Major: 6}},
+		{image: "redis:6.2", version: "5", want: Version{Major: 5}},
+		{image: "redis", version: "six", err: true},
+		{image: "redis:2.8", err: true},
+		{image: "redis:8.0.2-alpine", want: Version{Major: 8, Patch: 2}},
+		{image: "redis", version: "8.2", want: Version{Major: 8, Minor: 2}},
+		{image: "redis", version: "9.0", err: true},
+		{image: "redis:9", err: true},
+	}
+
+	for _, test := range tests {
+		version, err := ResolveVersion(&v1alpha2.RedisSpec{Image: test.image, Version: test.version})
+		if test.err {
+			if err == nil {
+				t.Errorf("%s ( version %q ): got %s, want an error", test.image, test.version, version)
+			}
+			continue
+		}
+
+		if err != nil || version != test.want {
+			t.Errorf("%s ( version %q ): got %s, %v, want %s", test.image, test.version, version, err, test.want)
+		}
+	}
+}
+
+func TestResolveNewestVersion(t *testing.T) {
+	tests := []struct {
+		image   string
+		version string
+		want    Version
+	}{
+		{image: "redis:4.0.2", want: Version{Major: 4, Patch: 2}},
+		{image: "redis:4.0", want: Version{Major: 4, Patch: 99}},
+		{image: "redis:4-alpine", want: Version{Major: 4, Minor: 99, Patch: 99}},
+		{image: "redis", want: DefaultVersion},
+		{image: "redis:latest", version: "4.0", want: Version{Major: 4, Patch: 99}},
+	}
+
+	for _, test := range tests {
+		version, err := ResolveNewestVersion(&v1alpha2.RedisSpec{Image: test.image, Version: test.version})
+		if err != nil || version != test.want {
+			t.Errorf("%s ( version %q ): got %s, %v, want %s", test.image, test.version, version, err, test.want)
+		}
+	}
+}
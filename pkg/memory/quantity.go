@@ -0,0 +1,176 @@
+// Package memory parses memory sizes written the way redis.conf does (100mb,
+// 1g) or as kubernetes quantities (512Mi, 1.5G) and renders them back for
+// redis.conf.
+package memory
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Quantity is a number of bytes
+type Quantity int64
+
+const (
+	Byte Quantity = 1
+
+	// decimal units, k m g in redis.conf and k M G T in kubernetes
+	Kilobyte Quantity = 1000 * Byte
+	Megabyte Quantity = 1000 * Kilobyte
+	Gigabyte Quantity = 1000 * Megabyte
+
+	// binary units, kb mb gb in redis.conf and Ki Mi Gi Ti in kubernetes
+	Kibibyte Quantity = 1024 * Byte
+	Mebibyte Quantity = 1024 * Kibibyte
+	Gibibyte Quantity = 1024 * Mebibyte
+	Tebibyte Quantity = 1024 * Gibibyte
+)
+
+// redisUnits are the units redis.conf understands, case insensitive
+var redisUnits = map[string]Quantity{
+	"":   Byte,
+	"b":  Byte,
+	"k":  Kilobyte,
+	"kb": Kibibyte,
+	"m":  Megabyte,
+	"mb": Mebibyte,
+	"g":  Gigabyte,
+	"gb": Gibibyte,
+}
+
+var redisPattern = regexp.MustCompile(`^([0-9]+)([a-zA-Z]*)$`)
+
+// Reason tells why a value isn't a memory quantity
+type Reason string
+
+const (
+	ReasonEmpty    Reason = "Empty"
+	ReasonSyntax   Reason = "Syntax"
+	ReasonFraction Reason = "Fraction"
+	ReasonNegative Reason = "Negative"
+	ReasonOverflow Reason = "Overflow"
+)
+
+// Error is returned by Parse
+type Error struct {
+	Value  string
+	Reason Reason
+}
+
+func (e *Error) Error() string {
+	var detail string
+	switch e.Reason {
+	case ReasonEmpty:
+		detail = "no size given"
+	case ReasonFraction:
+		detail = "not a whole number of bytes"
+	case ReasonNegative:
+		detail = "negative size"
+	case ReasonOverflow:
+		detail = "too large"
+	default:
+		detail = "expected a size such as 100mb, 1g or 512Mi"
+	}
+
+	return fmt.Sprintf("memory quantity %q: %s", e.Value, detail)
+}
+
+// Parse reads a size in redis.conf notation or as a kubernetes quantity.
+// The two agree on every unit but m: as in redis.conf it means megabytes,
+// milli makes no sense for memory.
+func Parse(s string) (Quantity, error) {
+	value := strings.TrimSpace(s)
+	if value == "" {
+		return 0, &Error{Value: s, Reason: ReasonEmpty}
+	}
+
+	if matches := redisPattern.FindStringSubmatch(value); matches != nil {
+		if unit, ok := redisUnits[strings.ToLower(matches[2])]; ok {
+			amount, err := strconv.ParseInt(matches[1], 10, 64)
+			if err != nil || amount > math.MaxInt64/int64(unit) {
+				return 0, &Error{Value: s, Reason: ReasonOverflow}
+			}
+
+			return Quantity(amount) * unit, nil
+		}
+	}
+
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, &Error{Value: s, Reason: ReasonSyntax}
+	}
+
+	if quantity.Sign() < 0 {
+		return 0, &Error{Value: s, Reason: ReasonNegative}
+	}
+
+	// huge values come back clamped to the largest int64
+	if quantity.Cmp(*resource.NewQuantity(math.MaxInt64, resource.BinarySI)) >= 0 {
+		return 0, &Error{Value: s, Reason: ReasonOverflow}
+	}
+
+	// Value rounds up, 1.5Gi is whole bytes but 1.5m (milli) is not
+	bytes := quantity.Value()
+	if quantity.Cmp(*resource.NewQuantity(bytes, resource.BinarySI)) != 0 {
+		return 0, &Error{Value: s, Reason: ReasonFraction}
+	}
+
+	return Quantity(bytes), nil
+}
+
+// MustParse is for sizes written in the code
+func MustParse(s string) Quantity {
+	q, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return q
+}
+
+// Bytes is the size in bytes
+func (q Quantity) Bytes() int64 {
+	return int64(q)
+}
+
+// String renders the size for redis.conf, in the largest binary unit that
+// divides it, e.g. 2gb, 512mb or 1500
+func (q Quantity) String() string {
+	for _, unit := range []struct {
+		size   Quantity
+		suffix string
+	}{
+		{Gibibyte, "gb"},
+		{Mebibyte, "mb"},
+		{Kibibyte, "kb"},
+	} {
+		if q != 0 && q%unit.size == 0 {
+			return strconv.FormatInt(int64(q/unit.size), 10) + unit.suffix
+		}
+	}
+
+	return strconv.FormatInt(int64(q), 10)
+}
+
+// Normalize renders a size in the notation of redis.conf, sizes already
+// written that way are kept as they are
+func Normalize(s string) (string, error) {
+	q, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimSpace(s)
+	if matches := redisPattern.FindStringSubmatch(value); matches != nil {
+		if _, ok := redisUnits[strings.ToLower(matches[2])]; ok {
+			return value, nil
+		}
+	}
+
+	return q.String(), nil
+}
@@ -0,0 +1,159 @@
+package memory
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		quantity Quantity
+		reason   Reason
+	}{
+		// redis.conf units
+		{value: "100", quantity: 100},
+		{value: "100b", quantity: 100},
+		{value: "1k", quantity: 1000},
+		{value: "1kb", quantity: 1024},
+		{value: "1m", quantity: 1000 * 1000},
+		{value: "100mb", quantity: 100 * 1024 * 1024},
+		{value: "1g", quantity: 1000 * 1000 * 1000},
+		{value: "2gb", quantity: 2 * 1024 * 1024 * 1024},
+		{value: " 2gb ", quantity: 2 * Gibibyte},
+
+		// redis.conf units are case insensitive, M is megabytes as in kubernetes
+		{value: "1K", quantity: Kilobyte},
+		{value: "1KB", quantity: Kibibyte},
+		{value: "1Kb", quantity: Kibibyte},
+		{value: "1M", quantity: Megabyte},
+		{value: "100MB", quantity: 100 * Mebibyte},
+		{value: "1G", quantity: Gigabyte},
+		{value: "1GB", quantity: Gibibyte},
+
+		// kubernetes quantities
+		{value: "1Ki", quantity: Kibibyte},
+		{value: "512Mi", quantity: 512 * Mebibyte},
+		{value: "1.5Gi", quantity: 1536 * Mebibyte},
+		{value: "1Ti", quantity: Tebibyte},
+		{value: "1.5G", quantity: 1500 * Megabyte},
+		{value: "1T", quantity: 1000 * Gigabyte},
+		{value: "1e3", quantity: 1000},
+		{value: "0.5Ki", quantity: 512},
+
+		// kubernetes binary suffixes are case sensitive
+		{value: "1mi", reason: ReasonSyntax},
+		{value: "1GI", reason: ReasonSyntax},
+
+		// the largest sizes
+		{value: "8589934591gb", quantity: 8589934591 * Gibibyte},
+		{value: "8589934592gb", reason: ReasonOverflow},
+		{value: "9223372036854775807", quantity: 9223372036854775807},
+		{value: "9223372036854775808", reason: ReasonOverflow},
+		{value: "99999999999999999999k", reason: ReasonOverflow},
+		{value: "8Ei", reason: ReasonOverflow},
+		{value: "10E", reason: ReasonOverflow},
+
+		// invalid
+		{value: "", reason: ReasonEmpty},
+		{value: "   ", reason: ReasonEmpty},
+		{value: "abc", reason: ReasonSyntax},
+		{value: "10xb", reason: ReasonSyntax},
+		{value: "10 mb", reason: ReasonSyntax},
+		{value: "mb", reason: ReasonSyntax},
+		{value: "-1", reason: ReasonNegative},
+		{value: "-1Gi", reason: ReasonNegative},
+		{value: "1.5", reason: ReasonFraction},
+		{value: "1.5m", reason: ReasonFraction},
+	}
+
+	for _, test := range tests {
+		quantity, err := Parse(test.value)
+		if test.reason != "" {
+			e, ok := err.(*Error)
+			if !ok {
+				t.Errorf("%q: got %v, %v, want a %s error", test.value, quantity, err, test.reason)
+				continue
+			}
+
+			if e.Reason != test.reason || e.Value != test.value {
+				t.Errorf("%q: got error %s for %q, want %s", test.value, e.Reason, e.Value, test.reason)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: got error %v", test.value, err)
+			continue
+		}
+
+		if quantity != test.quantity {
+			t.Errorf("%q: got %d bytes, want %d", test.value, quantity, test.quantity)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		quantity Quantity
+		value    string
+	}{
+		{quantity: 0, value: "0"},
+		{quantity: 1500, value: "1500"},
+		{quantity: Kibibyte, value: "1kb"},
+		{quantity: 512 * Mebibyte, value: "512mb"},
+		{quantity: 1536 * Mebibyte, value: "1536mb"},
+		{quantity: 2 * Gibibyte, value: "2gb"},
+		{quantity: Tebibyte, value: "1024gb"},
+	}
+
+	for _, test := range tests {
+		if value := test.quantity.String(); value != test.value {
+			t.Errorf("%d: got %q, want %q", test.quantity, value, test.value)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		value      string
+		normalized string
+		err        bool
+	}{
+		// redis.conf notation is kept as written
+		{value: "100mb", normalized: "100mb"},
+		{value: "1GB", normalized: "1GB"},
+		{value: "1G", normalized: "1G"},
+		{value: "1500", normalized: "1500"},
+		{value: " 2gb ", normalized: "2gb"},
+
+		// kubernetes quantities are converted
+		{value: "512Mi", normalized: "512mb"},
+		{value: "1.5Gi", normalized: "1536mb"},
+		{value: "2Ti", normalized: "2048gb"},
+		{value: "1e3", normalized: "1000"},
+		{value: "1T", normalized: "976562500kb"},
+
+		{value: "", err: true},
+		{value: "1.5", err: true},
+		{value: "lots", err: true},
+	}
+
+	for _, test := range tests {
+		normalized, err := Normalize(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: got %q, want an error", test.value, normalized)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: got error %v", test.value, err)
+			continue
+		}
+
+		if normalized != test.normalized {
+			t.Errorf("%q: got %q, want %q", test.value, normalized, test.normalized)
+		}
+	}
+}
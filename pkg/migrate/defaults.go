@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RunDefaults stores the defaults on the Redis objects of namespace until it
+// succeeds or stop is closed
+func RunDefaults(namespace string, stop <-chan struct{}) {
+	retry("store the defaults of Redis objects", func() error { return Defaults(namespace) }, stop)
+}
+
+// Defaults writes back unchanged the Redis objects of namespace missing some
+// default, for the defaulting webhook to store them. The webhook only sees
+// writes, the objects created before it was set up would never get them.
+func Defaults(namespace string) error {
+	redisList := &v1alpha2.RedisList{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       "Redis",
+		},
+	}
+
+	err := sdk.List(namespace, redisList)
+	if err != nil {
+		return err
+	}
+
+	defaulted := 0
+	for i := range redisList.Items {
+		redis := &redisList.Items[i]
+		redis.APIVersion = v1alpha2.SchemeGroupVersion.String()
+		redis.Kind = "Redis"
+
+		if !missingDefaults(redis) {
+			continue
+		}
+
+		err = rewrite(redis)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite Redis %s/%s: %v", redis.Namespace, redis.Name, err)
+		}
+
+		// the webhook may not serve yet, or not be registered at all
+		if missingDefaults(redis) {
+			return fmt.Errorf("Redis %s/%s was written without its defaults, is the defaulting webhook registered?",
+				redis.Namespace, redis.Name)
+		}
+
+		defaulted++
+	}
+
+	if defaulted > 0 {
+		logrus.Infof("stored the defaults of %d Redis objects", defaulted)
+	}
+
+	return nil
+}
+
+func missingDefaults(redis *v1alpha2.Redis) bool {
+	return redis.DeepCopy().SetDefaults()
+}
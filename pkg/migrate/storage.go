@@ -0,0 +1,165 @@
+// Package migrate rewrites the Redis objects stored in an older version of
+// the API in the storage version, so that the older version can be dropped
+// from the CRD.
+package migrate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const crdName = "redises.cache.flexshopper.com"
+
+// retryInterval paces the attempts, the first ones usually fail until the
+// conversion webhook serves
+const retryInterval = time.Minute
+
+var crdGroupVersion = schema.GroupVersion{Group: "apiextensions.k8s.io", Version: "v1beta1"}
+
+// Run migrates the stored Redis objects until it succeeds or stop is closed
+func Run(stop <-chan struct{}) {
+	retry("migrate stored Redis objects", Storage, stop)
+}
+
+// retry runs migration until it succeeds or stop is closed
+func retry(description string, migration func() error, stop <-chan struct{}) {
+	for {
+		err := migration()
+		if err == nil {
+			return
+		}
+
+		logrus.Errorf("failed to %s, retrying in %s with error : %v", description, retryInterval, err)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// Storage rewrites every Redis in the storage version, which the API server
+// does on any write, and then records on the CRD that no object is stored
+// in another version anymore
+func Storage() error {
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion(crdGroupVersion.String())
+	crd.SetKind("CustomResourceDefinition")
+	crd.SetName(crdName)
+
+	err := sdk.Get(crd)
+	if err != nil {
+		return err
+	}
+
+	storageVersion := v1alpha2.SchemeGroupVersion.Version
+	if version := crdStorageVersion(crd); version != storageVersion {
+		return fmt.Errorf("CustomResourceDefinition %s stores %s, apply the CRD storing %s first", crdName, version, storageVersion)
+	}
+
+	storedVersions, _, _ := unstructured.NestedStringSlice(crd.Object, "status", "storedVersions")
+	if len(storedVersions) == 1 && storedVersions[0] == storageVersion {
+		return nil
+	}
+
+	redisList := &v1alpha2.RedisList{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       "Redis",
+		},
+	}
+
+	err = sdk.List(metav1.NamespaceAll, redisList)
+	if err != nil {
+		return err
+	}
+
+	for i := range redisList.Items {
+		redis := &redisList.Items[i]
+		redis.APIVersion = v1alpha2.SchemeGroupVersion.String()
+		redis.Kind = "Redis"
+
+		err = rewrite(redis)
+		if err != nil {
+			return fmt.Errorf("failed to rewrite Redis %s/%s: %v", redis.Namespace, redis.Name, err)
+		}
+	}
+
+	err = unstructured.SetNestedStringSlice(crd.Object, []string{storageVersion}, "status", "storedVersions")
+	if err != nil {
+		return err
+	}
+
+	err = updateCRDStatus(crd)
+	if err != nil {
+		return fmt.Errorf("failed to update stored versions of CustomResourceDefinition %s: %v", crdName, err)
+	}
+
+	logrus.Infof("migrated %d Redis objects to %s", len(redisList.Items), storageVersion)
+	return nil
+}
+
+// rewrite writes a Redis back unchanged, once more on a conflict with the
+// latest version
+func rewrite(redis *v1alpha2.Redis) error {
+	err := sdk.Update(redis)
+	if errors.IsConflict(err) {
+		err = sdk.Get(redis)
+		if err == nil {
+			err = sdk.Update(redis)
+		}
+	}
+
+	if errors.IsNotFound(err) {
+		return nil
+	}
+
+	return err
+}
+
+// crdStorageVersion is the version the CRD stores objects in
+func crdStorageVersion(crd *unstructured.Unstructured) string {
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, version := range versions {
+		version, ok := version.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if storage, _ := version["storage"].(bool); storage {
+			name, _ := version["name"].(string)
+			return name
+		}
+	}
+
+	name, _, _ := unstructured.NestedString(crd.Object, "spec", "version")
+	return name
+}
+
+// updateCRDStatus writes the status subresource of the CRD, which sdk can't
+// address
+func updateCRDStatus(crd *unstructured.Unstructured) error {
+	config := *k8sclient.GetKubeConfig()
+	config.GroupVersion = &crdGroupVersion
+	config.APIPath = "/apis"
+
+	client, err := dynamic.NewClient(&config)
+	if err != nil {
+		return err
+	}
+
+	resource := &metav1.APIResource{Name: "customresourcedefinitions/status", Namespaced: false}
+	_, err = client.Resource(resource, "").Update(crd)
+	return err
+}
@@ -0,0 +1,235 @@
+package policy
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConfigMapKey is the key of the policy in the policy ConfigMap
+const ConfigMapKey = "policy.yaml"
+
+var (
+	mu      sync.RWMutex
+	current = &Policy{}
+)
+
+// Current is the policy in force, the one last loaded
+func Current() *Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return current
+}
+
+func set(p *Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current = p
+}
+
+// Options are the command line flags of the policy. The flags make up the
+// default rules, a policy file and then a policy ConfigMap override them.
+type Options struct {
+	File string
+	// ConfigMap is name or namespace/name
+	ConfigMap               string
+	ReloadInterval          time.Duration
+	MaxMemory               string
+	AllowedRegistries       string
+	AllowedTags             string
+	AllowedEvictionPolicies string
+	MinPort                 int
+	MaxPort                 int
+	AllowPersistence        bool
+}
+
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.File, "policy-file", "", "path of a policy file, reloaded when it changes")
+	fs.StringVar(&o.ConfigMap, "policy-configmap", "", "name or namespace/name of a ConfigMap holding the policy under "+ConfigMapKey)
+	fs.DurationVar(&o.ReloadInterval, "policy-reload-interval", 10*time.Second, "how often the policy file and ConfigMap are checked for changes")
+	fs.StringVar(&o.MaxMemory, "max-memory", "5gb", "largest maxMemory allowed by default")
+	fs.StringVar(&o.AllowedRegistries, "allowed-registries", "", "comma separated registries images may come from, any when empty")
+	fs.StringVar(&o.AllowedTags, "allowed-tags", "", "comma separated patterns the redis image tag must match, any when empty")
+	fs.StringVar(&o.AllowedEvictionPolicies, "allowed-eviction-policies", "", "comma separated eviction policies allowed, any when empty")
+	fs.IntVar(&o.MinPort, "min-port", 0, "lowest port allowed")
+	fs.IntVar(&o.MaxPort, "max-port", 0, "highest port allowed")
+	fs.BoolVar(&o.AllowPersistence, "allow-persistence", true, "whether spec.persistence is allowed by default")
+}
+
+func (o *Options) flagsPolicy() *Policy {
+	allowPersistence := o.AllowPersistence
+
+	return &Policy{
+		Default: Rules{
+			MaxMemory:               o.MaxMemory,
+			AllowedRegistries:       splitList(o.AllowedRegistries),
+			AllowedTags:             splitList(o.AllowedTags),
+			AllowedEvictionPolicies: splitList(o.AllowedEvictionPolicies),
+			MinPort:                 int32(o.MinPort),
+			MaxPort:                 int32(o.MaxPort),
+			AllowPersistence:        &allowPersistence,
+		},
+	}
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// Loader keeps Current in line with the flags, the file and the ConfigMap
+type Loader struct {
+	flags              *Policy
+	file               string
+	configMapNamespace string
+	configMapName      string
+	interval           time.Duration
+
+	// loaded is the raw file and ConfigMap contents Current was built from
+	loaded string
+}
+
+// NewLoader loads the policy once, a broken policy at startup is an error
+// while later it only keeps the previous one in force. The ConfigMap is
+// looked up in namespace unless its name says otherwise.
+func NewLoader(o *Options, namespace string) (*Loader, error) {
+	l := &Loader{
+		flags:              o.flagsPolicy(),
+		file:               o.File,
+		configMapNamespace: namespace,
+		configMapName:      o.ConfigMap,
+		interval:           o.ReloadInterval,
+	}
+
+	if parts := strings.SplitN(o.ConfigMap, "/", 2); len(parts) == 2 {
+		l.configMapNamespace, l.configMapName = parts[0], parts[1]
+	}
+
+	if l.configMapName != "" && l.configMapNamespace == "" {
+		return nil, fmt.Errorf("policy ConfigMap %s needs a namespace, write it as namespace/name", l.configMapName)
+	}
+
+	err := l.flags.validate()
+	if err != nil {
+		return nil, fmt.Errorf("policy flags: %v", err)
+	}
+
+	_, err = l.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Run reloads the policy until stop is closed. A new policy takes effect on
+// the next resync of every Redis, which is validated against it again.
+func (l *Loader) Run(stop <-chan struct{}) {
+	if l.file == "" && l.configMapName == "" {
+		return
+	}
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := l.reload()
+		if err != nil {
+			logrus.Errorf("failed to reload policy, keeping the current one: %v", err)
+			continue
+		}
+
+		if changed {
+			logrus.Info("policy reloaded")
+		}
+	}
+}
+
+func (l *Loader) reload() (bool, error) {
+	var fileData, configMapData string
+
+	if l.file != "" {
+		data, err := ioutil.ReadFile(l.file)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+
+		fileData = string(data)
+	}
+
+	if l.configMapName != "" {
+		cm := &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      l.configMapName,
+				Namespace: l.configMapNamespace,
+			},
+		}
+
+		err := sdk.Get(cm)
+		if err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+
+		configMapData = cm.Data[ConfigMapKey]
+	}
+
+	loaded := fileData + "\x00" + configMapData
+	if loaded == l.loaded {
+		return false, nil
+	}
+
+	p, err := merge(l.flags, "file "+l.file, fileData)
+	if err != nil {
+		return false, err
+	}
+
+	p, err = merge(p, "ConfigMap "+l.configMapNamespace+"/"+l.configMapName, configMapData)
+	if err != nil {
+		return false, err
+	}
+
+	set(p)
+	l.loaded = loaded
+	return true, nil
+}
+
+func merge(p *Policy, source, data string) (*Policy, error) {
+	if strings.TrimSpace(data) == "" {
+		return p, nil
+	}
+
+	o, err := Parse([]byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %v", source, err)
+	}
+
+	return p.Merge(o), nil
+}
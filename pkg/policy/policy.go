@@ -0,0 +1,294 @@
+// Package policy holds the limits the cluster operators put on Redis
+// instances: how much memory a namespace may ask for, which images, eviction
+// policies and ports are allowed and whether persistence may be used.
+package policy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/flexshopper/redis-operator/pkg/memory"
+	"github.com/ghodss/yaml"
+)
+
+// Policy is what a policy file or ConfigMap holds, as YAML or JSON
+type Policy struct {
+	// Default applies to every namespace
+	Default Rules `json:"default"`
+	// Namespaces override fields of Default for a namespace
+	Namespaces map[string]Rules `json:"namespaces,omitempty"`
+}
+
+// Rules are the limits of a namespace, an empty field means no limit
+type Rules struct {
+	// MaxMemory is the largest spec.maxMemory, e.g. 5gb or 4Gi
+	MaxMemory string `json:"maxMemory,omitempty"`
+	// AllowedRegistries are registries or repository prefixes images may
+	// come from, e.g. docker.io or quay.io/myorg
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+	// AllowedTags are patterns the redis image tag must match, e.g. 6.* or
+	// *-alpine
+	AllowedTags             []string `json:"allowedTags,omitempty"`
+	AllowedEvictionPolicies []string `json:"allowedEvictionPolicies,omitempty"`
+	MinPort                 int32    `json:"minPort,omitempty"`
+	MaxPort                 int32    `json:"maxPort,omitempty"`
+	// AllowPersistence false refuses spec.persistence
+	AllowPersistence *bool `json:"allowPersistence,omitempty"`
+}
+
+// Parse reads a policy written as YAML or JSON and checks its values
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	err := yaml.Unmarshal(data, p)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *Policy) validate() error {
+	check := func(scope string, rules Rules) error {
+		if rules.MaxMemory != "" {
+			if _, err := memory.Parse(rules.MaxMemory); err != nil {
+				return fmt.Errorf("%s: maxMemory: %v", scope, err)
+			}
+		}
+
+		for _, pattern := range rules.AllowedTags {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s: allowedTags: bad pattern %q", scope, pattern)
+			}
+		}
+
+		if rules.MinPort != 0 && rules.MaxPort != 0 && rules.MinPort > rules.MaxPort {
+			return fmt.Errorf("%s: minPort %d is above maxPort %d", scope, rules.MinPort, rules.MaxPort)
+		}
+
+		return nil
+	}
+
+	err := check("default", p.Default)
+	if err != nil {
+		return err
+	}
+
+	for namespace, rules := range p.Namespaces {
+		err = check("namespace "+namespace, rules)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Merge returns p with the fields set in o taking over, per namespace
+func (p *Policy) Merge(o *Policy) *Policy {
+	merged := &Policy{
+		Default:    p.Default.merge(o.Default),
+		Namespaces: map[string]Rules{},
+	}
+
+	for namespace, rules := range p.Namespaces {
+		merged.Namespaces[namespace] = rules
+	}
+
+	for namespace, rules := range o.Namespaces {
+		merged.Namespaces[namespace] = merged.Namespaces[namespace].merge(rules)
+	}
+
+	return merged
+}
+
+// RulesFor are the rules of a namespace, its own on top of the defaults
+func (p *Policy) RulesFor(namespace string) Rules {
+	return p.Default.merge(p.Namespaces[namespace])
+}
+
+func (r Rules) merge(o Rules) Rules {
+	if o.MaxMemory != "" {
+		r.MaxMemory = o.MaxMemory
+	}
+
+	if o.AllowedRegistries != nil {
+		r.AllowedRegistries = o.AllowedRegistries
+	}
+
+	if o.AllowedTags != nil {
+		r.AllowedTags = o.AllowedTags
+	}
+
+	if o.AllowedEvictionPolicies != nil {
+		r.AllowedEvictionPolicies = o.AllowedEvictionPolicies
+	}
+
+	if o.MinPort != 0 {
+		r.MinPort = o.MinPort
+	}
+
+	if o.MaxPort != 0 {
+		r.MaxPort = o.MaxPort
+	}
+
+	if o.AllowPersistence != nil {
+		r.AllowPersistence = o.AllowPersistence
+	}
+
+	return r
+}
+
+// Check returns the violations of the policy of its namespace by a Redis
+// with its defaults set
+func (p *Policy) Check(redis *v1alpha2.Redis) []string {
+	rules := p.RulesFor(redis.Namespace)
+	spec := &redis.Spec
+
+	var violations []string
+
+	if rules.MaxMemory != "" {
+		// maxmemory 0 is no limit at all, an unreadable value can't be
+		// held against the cap either
+		limit := memory.MustParse(rules.MaxMemory)
+		requested, err := memory.Parse(spec.MaxMemory)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf(
+				"maxMemory setting ( %s ) is invalid, maxMemory is capped at ( %s ) in namespace ( %s )",
+				spec.MaxMemory, rules.MaxMemory, redis.Namespace))
+		} else if requested == 0 {
+			violations = append(violations, fmt.Sprintf(
+				"maxMemory setting ( %s ) is unlimited, maxMemory is capped at ( %s ) in namespace ( %s )",
+				spec.MaxMemory, rules.MaxMemory, redis.Namespace))
+		} else if requested > limit {
+			violations = append(violations, fmt.Sprintf(
+				"maxMemory setting ( %s ) greater than allowed maxMemory ( %s ) in namespace ( %s )",
+				spec.MaxMemory, rules.MaxMemory, redis.Namespace))
+		}
+	}
+
+	images := []string{spec.Image}
+	if spec.Monitoring != nil {
+		images = append(images, spec.Monitoring.Image)
+	}
+
+	for _, image := range images {
+		if !registryAllowed(rules.AllowedRegistries, image) {
+			violations = append(violations, fmt.Sprintf(
+				"image ( %s ) is not from an allowed registry ( %s )",
+				image, strings.Join(rules.AllowedRegistries, ", ")))
+		}
+	}
+
+	if !tagAllowed(rules.AllowedTags, spec.Image) {
+		violations = append(violations, fmt.Sprintf(
+			"image tag of ( %s ) does not match an allowed tag ( %s )",
+			spec.Image, strings.Join(rules.AllowedTags, ", ")))
+	}
+
+	if len(rules.AllowedEvictionPolicies) > 0 && !contains(rules.AllowedEvictionPolicies, spec.MaxMemoryEvictionPolicy) {
+		violations = append(violations, fmt.Sprintf(
+			"maxMemoryEvictionPolicy ( %s ) is not allowed, use one of ( %s )",
+			spec.MaxMemoryEvictionPolicy, strings.Join(rules.AllowedEvictionPolicies, ", ")))
+	}
+
+	if (rules.MinPort != 0 && spec.Port < rules.MinPort) || (rules.MaxPort != 0 && spec.Port > rules.MaxPort) {
+		violations = append(violations, fmt.Sprintf(
+			"port ( %d ) is outside the allowed range ( %s )", spec.Port, portRange(rules)))
+	}
+
+	if spec.Persistence != nil && rules.AllowPersistence != nil && !*rules.AllowPersistence {
+		violations = append(violations, fmt.Sprintf(
+			"persistence is not allowed in namespace ( %s )", redis.Namespace))
+	}
+
+	return violations
+}
+
+func portRange(rules Rules) string {
+	min, max := "1", "65535"
+	if rules.MinPort != 0 {
+		min = fmt.Sprint(rules.MinPort)
+	}
+
+	if rules.MaxPort != 0 {
+		max = fmt.Sprint(rules.MaxPort)
+	}
+
+	return min + "-" + max
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitImage splits an image reference into its repository, with the
+// registry spelled out, and its tag
+func splitImage(image string) (string, string) {
+	name := strings.SplitN(image, "@", 2)[0]
+
+	tag := "latest"
+	if colon := strings.LastIndex(name, ":"); colon > strings.LastIndex(name, "/") {
+		name, tag = name[:colon], name[colon+1:]
+	} else if strings.Contains(image, "@") {
+		// pinned by digest only
+		tag = ""
+	}
+
+	// the first component is a registry when it looks like a host
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 1 || !(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		if len(parts) == 1 {
+			name = "library/" + name
+		}
+
+		name = "docker.io/" + name
+	}
+
+	return name, tag
+}
+
+// registryAllowed matches the repository of image against allowed prefixes,
+// a prefix matches whole path components only
+func registryAllowed(allowed []string, image string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	repository, _ := splitImage(image)
+	for _, prefix := range allowed {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if repository == prefix || strings.HasPrefix(repository, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func tagAllowed(allowed []string, image string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	_, tag := splitImage(image)
+	for _, pattern := range allowed {
+		if matched, _ := path.Match(pattern, tag); matched {
+			return true
+		}
+	}
+
+	return false
+}
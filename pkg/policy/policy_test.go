@@ -0,0 +1,297 @@
+package policy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testRedis(namespace string, mutate func(*v1alpha2.RedisSpec)) *v1alpha2.Redis {
+	redis := &v1alpha2.Redis{ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: namespace}}
+	if mutate != nil {
+		mutate(&redis.Spec)
+	}
+	redis.SetDefaults()
+	return redis
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{
+			name: "yaml",
+			data: "default:\n  maxMemory: 1gb\nnamespaces:\n  team:\n    maxPort: 7000\n",
+		},
+		{
+			name: "json",
+			data: `{"default": {"allowedTags": ["7.*"]}}`,
+		},
+		{
+			name: "invalid maxMemory",
+			data: "default:\n  maxMemory: lots\n",
+			err:  "default: maxMemory",
+		},
+		{
+			name: "invalid tag pattern",
+			data: "namespaces:\n  team:\n    allowedTags: ['[']\n",
+			err:  "namespace team: allowedTags",
+		},
+		{
+			name: "inverted port range",
+			data: "default:\n  minPort: 7000\n  maxPort: 6000\n",
+			err:  "minPort 7000 is above maxPort 6000",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := Parse([]byte(test.data))
+		if test.err == "" && err != nil {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	allow, deny := true, false
+
+	base := &Policy{
+		Default: Rules{MaxMemory: "1gb", AllowedTags: []string{"7.*"}, AllowPersistence: &allow},
+		Namespaces: map[string]Rules{
+			"team":  {MaxMemory: "4gb", MinPort: 6000},
+			"other": {MaxPort: 7000},
+		},
+	}
+
+	override := &Policy{
+		Default: Rules{AllowedTags: []string{"6.*", "7.*"}, AllowPersistence: &deny},
+		Namespaces: map[string]Rules{
+			"team": {MaxPort: 6500},
+			"new":  {MaxMemory: "100mb"},
+		},
+	}
+
+	merged := base.Merge(override)
+
+	tests := []struct {
+		namespace string
+		want      Rules
+	}{
+		{
+			namespace: "default",
+			want:      Rules{MaxMemory: "1gb", AllowedTags: []string{"6.*", "7.*"}, AllowPersistence: &deny},
+		},
+		{
+			namespace: "team",
+			want:      Rules{MaxMemory: "4gb", AllowedTags: []string{"6.*", "7.*"}, MinPort: 6000, MaxPort: 6500, AllowPersistence: &deny},
+		},
+		{
+			namespace: "other",
+			want:      Rules{MaxMemory: "1gb", AllowedTags: []string{"6.*", "7.*"}, MaxPort: 7000, AllowPersistence: &deny},
+		},
+		{
+			namespace: "new",
+			want:      Rules{MaxMemory: "100mb", AllowedTags: []string{"6.*", "7.*"}, AllowPersistence: &deny},
+		},
+	}
+
+	for _, test := range tests {
+		if got := merged.RulesFor(test.namespace); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.namespace, got, test.want)
+		}
+	}
+
+	// the merged policies are left alone
+	if base.Namespaces["team"].MaxPort != 0 || len(base.Namespaces) != 2 {
+		t.Errorf("Merge changed the base policy: %+v", base.Namespaces)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	deny := false
+
+	policy := &Policy{
+		Default: Rules{
+			MaxMemory:               "1gb",
+			AllowedRegistries:       []string{"docker.io/library", "docker.io/oliver006"},
+			AllowedTags:             []string{"7.*"},
+			AllowedEvictionPolicies: []string{"allkeys-lru", "volatile-lru"},
+			MinPort:                 6000,
+			MaxPort:                 7000,
+		},
+		Namespaces: map[string]Rules{
+			"team": {MaxMemory: "4gb", AllowPersistence: &deny},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		mutate    func(*v1alpha2.RedisSpec)
+		want      []string
+	}{
+		{
+			name: "within the policy",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Image = "redis:7.2"
+				spec.MaxMemory = "512mb"
+			},
+		},
+		{
+			name: "above maxMemory",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Image = "redis:7.2"
+				spec.MaxMemory = "2gb"
+			},
+			want: []string{"maxMemory setting ( 2gb ) greater than allowed maxMemory ( 1gb ) in namespace ( default )"},
+		},
+		{
+			name:      "maxMemory of the namespace",
+			namespace: "team",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Image = "redis:7.2"
+				spec.MaxMemory = "2gb"
+			},
+		},
+		{
+			name: "unlimited maxMemory",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Image = "redis:7.2"
+				spec.MaxMemory = "0"
+			},
+			want: []string{"maxMemory setting ( 0 ) is unlimited, maxMemory is capped at ( 1gb ) in namespace ( default )"},
+		},
+		{
+			name: "unlimited maxMemory with a unit",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Image = "redis:7.2"
+				spec.MaxMemory = "0Gi"
+			},
+			want: []string{"maxMemory setting ( 0Gi ) is unlimited, maxMemory is capped at ( 1gb ) in namespace ( default )"},
+		},
+		{
+			name: "invalid maxMemory",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Image = "redis:7.2"
+				spec.MaxMemory = "lots"
+			},
+			want: []string{"maxMemory setting ( lots ) is invalid, maxMemory is capped at ( 1gb ) in namespace ( default )"},
+		},
+		{
+			name: "registry and tag",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Image = "quay.io/someone/redis:6.2"
+			},
+			want: []string{
+				"image ( quay.io/someone/redis:6.2 ) is not from an allowed registry ( docker.io/library, docker.io/oliver006 )",
+				"image tag of ( quay.io/someone/redis:6.2 ) does not match an allowed tag ( 7.* )",
+			},
+		},
+		{
+			name: "exporter registry",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Image = "redis:7.2"
+				spec.Monitoring = &v1alpha2.RedisMonitoring{Image: "ghcr.io/exporter:1.0"}
+			},
+			want: []string{"image ( ghcr.io/exporter:1.0 ) is not from an allowed registry ( docker.io/library, docker.io/oliver006 )"},
+		},
+		{
+			name: "eviction policy and port",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Image = "redis:7.2"
+				spec.MaxMemoryEvictionPolicy = "noeviction"
+				spec.Port = 8000
+			},
+			want: []string{
+				"maxMemoryEvictionPolicy ( noeviction ) is not allowed, use one of ( allkeys-lru, volatile-lru )",
+				"port ( 8000 ) is outside the allowed range ( 6000-7000 )",
+			},
+		},
+		{
+			name:      "persistence",
+			namespace: "team",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Image = "redis:7.2"
+				spec.Persistence = &v1alpha2.RedisPersistence{}
+			},
+			want: []string{"persistence is not allowed in namespace ( team )"},
+		},
+	}
+
+	for _, test := range tests {
+		namespace := test.namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+
+		got := policy.Check(testRedis(namespace, test.mutate))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCheckWithoutRules(t *testing.T) {
+	redis := testRedis("default", func(spec *v1alpha2.RedisSpec) {
+		spec.MaxMemory = "0"
+		spec.Persistence = &v1alpha2.RedisPersistence{}
+	})
+
+	if violations := (&Policy{}).Check(redis); len(violations) != 0 {
+		t.Errorf("got %q", violations)
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image      string
+		repository string
+		tag        string
+	}{
+		{image: "redis", repository: "docker.io/library/redis", tag: "latest"},
+		{image: "redis:7.2-alpine", repository: "docker.io/library/redis", tag: "7.2-alpine"},
+		{image: "bitnami/redis:7.2", repository: "docker.io/bitnami/redis", tag: "7.2"},
+		{image: "quay.io/org/redis:7.2", repository: "quay.io/org/redis", tag: "7.2"},
+		{image: "registry:5000/redis", repository: "registry:5000/redis", tag: "latest"},
+		{image: "registry:5000/redis:7.2", repository: "registry:5000/redis", tag: "7.2"},
+		{image: "localhost/redis:7.2", repository: "localhost/redis", tag: "7.2"},
+		{image: "redis@sha256:abcd", repository: "docker.io/library/redis", tag: ""},
+		{image: "redis:7.2@sha256:abcd", repository: "docker.io/library/redis", tag: "7.2"},
+	}
+
+	for _, test := range tests {
+		repository, tag := splitImage(test.image)
+		if repository != test.repository || tag != test.tag {
+			t.Errorf("%s: got %s and %q, want %s and %q", test.image, repository, tag, test.repository, test.tag)
+		}
+	}
+}
+
+func TestRegistryAllowed(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		image   string
+		want    bool
+	}{
+		{image: "anything/at:all", want: true},
+		{allowed: []string{"docker.io"}, image: "redis:7.2", want: true},
+		{allowed: []string{"quay.io/org/"}, image: "quay.io/org/redis", want: true},
+		{allowed: []string{"quay.io/org"}, image: "quay.io/organization/redis", want: false},
+		{allowed: []string{"docker.io/library"}, image: "bitnami/redis", want: false},
+	}
+
+	for _, test := range tests {
+		if got := registryAllowed(test.allowed, test.image); got != test.want {
+			t.Errorf("%s in %v: got %v, want %v", test.image, test.allowed, got, test.want)
+		}
+	}
+}
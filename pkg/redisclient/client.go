@@ -0,0 +1,285 @@
+// Package redisclient is the small RESP client the operator uses to inspect
+// and steer the redis instances it manages.
+package redisclient
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 2 * time.Second
+
+// Error is an error reply sent by the server, e.g. "ERR unknown command"
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Interface is what the operator needs from a connection to redis, Client
+// implements it and tests can substitute a client of a fake server
+type Interface interface {
+	Do(args ...string) (interface{}, error)
+	String(args ...string) (string, error)
+	Info(section string) (map[string]string, error)
+	Close() error
+}
+
+// Dialer opens an Interface to addr, authenticating with password
+type Dialer func(addr, password string) (Interface, error)
+
+// DefaultDialer dials real servers with Dial
+func DefaultDialer(addr, password string) (Interface, error) {
+	client, err := Dial(addr, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+var _ Interface = &Client{}
+
+type Client struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+// Dial connects to addr and authenticates when password isn't empty
+func Dial(addr, password string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		timeout: defaultTimeout,
+	}
+
+	if password != "" {
+		_, err = c.Do("AUTH", password)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// SetTimeout changes how long a command may take, 2s by default
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Do sends a command and returns its reply: a string for simple and bulk
+// strings, an int64 for integers, []interface{} for arrays and nil for null
+// replies. Server errors are returned as Error.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	err := c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.write(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.read()
+}
+
+// String runs a command expected to reply with a string
+func (c *Client) String(args ...string) (string, error) {
+	reply, err := c.Do(args...)
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected reply %T to %s", reply, args[0])
+	}
+
+	return s, nil
+}
+
+// Info runs INFO for a section and parses the "key:value" lines
+func (c *Client) Info(section string) (map[string]string, error) {
+	raw, err := c.String("INFO", section)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseInfo(raw), nil
+}
+
+// ParseInfo parses the text returned by INFO
+func ParseInfo(raw string) map[string]string {
+	info := map[string]string{}
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			info[parts[0]] = parts[1]
+		}
+	}
+
+	return info
+}
+
+// Subscribe puts the connection in pub/sub mode, messages are then read
+// with ReceiveMessage
+func (c *Client) Subscribe(channels ...string) error {
+	err := c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if err != nil {
+		return err
+	}
+
+	err = c.write(append([]string{"SUBSCRIBE"}, channels...))
+	if err != nil {
+		return err
+	}
+
+	// one confirmation per channel
+	for range channels {
+		_, err = c.read()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReceiveMessage blocks until a message is published on one of the
+// subscribed channels or the connection is closed
+func (c *Client) ReceiveMessage() (string, string, error) {
+	err := c.conn.SetDeadline(time.Time{})
+	if err != nil {
+		return "", "", err
+	}
+
+	for {
+		reply, err := c.read()
+		if err != nil {
+			return "", "", err
+		}
+
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 3 {
+			continue
+		}
+
+		kind, _ := items[0].(string)
+		channel, _ := items[1].(string)
+		payload, _ := items[2].(string)
+		if kind == "message" {
+			return channel, payload, nil
+		}
+	}
+}
+
+func (c *Client) write(args []string) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	_, err := io.WriteString(c.conn, buf.String())
+	return err
+}
+
+func (c *Client) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", errors.New("malformed reply line")
+	}
+
+	return line[:len(line)-2], nil
+}
+
+func (c *Client) read() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		if size < 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size+2)
+		_, err = io.ReadFull(c.reader, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		return string(buf[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		if size < 0 {
+			return nil, nil
+		}
+
+		items := make([]interface{}, size)
+		for i := range items {
+			items[i], err = c.read()
+			if err != nil {
+				// keep reading the array, an error element doesn't break the stream
+				if _, ok := err.(Error); !ok {
+					return nil, err
+				}
+
+				items[i] = err
+			}
+		}
+
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", line[0])
+	}
+}
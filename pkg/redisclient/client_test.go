@@ -0,0 +1,199 @@
+package redisclient
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/redisclient/fake"
+)
+
+func startServer(t *testing.T, password string) *fake.Server {
+	server, err := fake.NewServer(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server
+}
+
+func TestDial(t *testing.T) {
+	server := startServer(t, "secret")
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		password string
+		err      string
+	}{
+		{name: "right password", password: "secret"},
+		{name: "wrong password", password: "guess", err: "ERR invalid password"},
+		{name: "no password", err: "NOAUTH Authentication required."},
+	}
+
+	for _, test := range tests {
+		client, err := DefaultDialer(server.Addr(), test.password)
+		if err == nil {
+			// the server only refuses a missing password on the first command
+			_, err = client.String("PING")
+			client.Close()
+		}
+
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: got error %v", test.name, err)
+		case test.err != "" && err == nil:
+			t.Errorf("%s: got no error, want %q", test.name, test.err)
+		case test.err != "":
+			if _, ok := err.(Error); !ok || err.Error() != test.err {
+				t.Errorf("%s: got error %#v, want Error %q", test.name, err, test.err)
+			}
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	server := startServer(t, "")
+	defer server.Close()
+
+	client, err := Dial(server.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		args  []string
+		reply interface{}
+		err   string
+	}{
+		{args: []string{"PING"}, reply: "PONG"},
+		{args: []string{"CONFIG", "SET", "maxmemory", "100mb"}, reply: "OK"},
+		{args: []string{"CONFIG", "GET", "maxmemory"}, reply: []interface{}{"maxmemory", "100mb"}},
+		{args: []string{"CONFIG", "GET", "unknown"}, reply: []interface{}{}},
+		{args: []string{"FLUSHALL"}, err: "ERR unknown command 'flushall'"},
+	}
+
+	for _, test := range tests {
+		reply, err := client.Do(test.args...)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%v: got error %v, want %q", test.args, err, test.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: got error %v", test.args, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(reply, test.reply) {
+			t.Errorf("%v: got reply %#v, want %#v", test.args, reply, test.reply)
+		}
+	}
+
+	if got := server.Config("maxmemory"); got != "100mb" {
+		t.Errorf("server has maxmemory %q, want 100mb", got)
+	}
+
+	// the connection is still usable after an error reply
+	_, err = client.String("PING")
+	if err != nil {
+		t.Errorf("PING after an error: %v", err)
+	}
+
+	_, err = client.String("CONFIG", "GET", "maxmemory")
+	if err == nil {
+		t.Errorf("String of an array reply: got no error")
+	}
+}
+
+func TestInfo(t *testing.T) {
+	server := startServer(t, "")
+	defer server.Close()
+
+	server.SetInfo("Server", "redis_version", "5.0.7")
+	server.SetInfo("Server", "uptime_in_seconds", "42")
+	server.SetInfo("Replication", "role", "master")
+	server.SetInfo("Replication", "master_replid", "abc:def")
+
+	client, err := Dial(server.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		section string
+		info    map[string]string
+	}{
+		{
+			section: "default",
+			info: map[string]string{
+				"redis_version":     "5.0.7",
+				"uptime_in_seconds": "42",
+				"role":              "master",
+				"master_replid":     "abc:def",
+			},
+		},
+		{
+			section: "replication",
+			info:    map[string]string{"role": "master", "master_replid": "abc:def"},
+		},
+		{
+			section: "memory",
+			info:    map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		info, err := client.Info(test.section)
+		if err != nil {
+			t.Errorf("%s: got error %v", test.section, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(info, test.info) {
+			t.Errorf("%s: got %v, want %v", test.section, info, test.info)
+		}
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		info map[string]string
+	}{
+		{
+			name: "sections and blank lines",
+			raw:  "# Server\r\nredis_version:6.2.1\r\n\r\n# Memory\r\nused_memory:1024\r\n",
+			info: map[string]string{"redis_version": "6.2.1", "used_memory": "1024"},
+		},
+		{
+			name: "value with colons",
+			raw:  "slave0:ip=10.0.0.1,port=6379,state=online,offset=1,lag=0\r\nexecutable:/usr/local/bin/redis-server\r\n",
+			info: map[string]string{
+				"slave0":     "ip=10.0.0.1,port=6379,state=online,offset=1,lag=0",
+				"executable": "/usr/local/bin/redis-server",
+			},
+		},
+		{
+			name: "line without a value",
+			raw:  "garbage\nrole:slave\n",
+			info: map[string]string{"role": "slave"},
+		},
+		{
+			name: "empty",
+			raw:  "",
+			info: map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		info := ParseInfo(test.raw)
+		if !reflect.DeepEqual(info, test.info) {
+			t.Errorf("%s: got %v, want %v", test.name, info, test.info)
+		}
+	}
+}
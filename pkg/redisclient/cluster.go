@@ -0,0 +1,182 @@
+package redisclient
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ClusterSlots is the number of hash slots a cluster spreads its keys over
+const ClusterSlots = 16384
+
+// SlotRange is an inclusive range of hash slots
+type SlotRange struct {
+	Start int
+	End   int
+}
+
+func (r SlotRange) String() string {
+	if r.Start == r.End {
+		return strconv.Itoa(r.Start)
+	}
+
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// ClusterNode is one line of CLUSTER NODES
+type ClusterNode struct {
+	ID string
+	// Addr is ip:port, without the cluster bus port
+	Addr  string
+	Flags map[string]bool
+	// MasterID is the master a replica follows, empty for masters
+	MasterID  string
+	LinkState string
+	Slots     []SlotRange
+	// Migrating and Importing map a slot to the node it moves to or from
+	Migrating map[int]string
+	Importing map[int]string
+}
+
+func (n *ClusterNode) IP() string {
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		return ""
+	}
+
+	return host
+}
+
+func (n *ClusterNode) Myself() bool {
+	return n.Flags["myself"]
+}
+
+func (n *ClusterNode) IsMaster() bool {
+	return n.Flags["master"]
+}
+
+// Failing is true when the node is flagged fail, or pfail from this
+// node's point of view
+func (n *ClusterNode) Failing() bool {
+	return n.Flags["fail"] || n.Flags["fail?"]
+}
+
+func (n *ClusterNode) SlotCount() int {
+	count := 0
+	for _, r := range n.Slots {
+		count += r.End - r.Start + 1
+	}
+
+	return count
+}
+
+// ClusterNodes runs CLUSTER NODES on the node the client is connected to
+func (c *Client) ClusterNodes() ([]*ClusterNode, error) {
+	raw, err := c.String("CLUSTER", "NODES")
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseClusterNodes(raw)
+}
+
+// ClusterInfo runs CLUSTER INFO and parses the "key:value" lines
+func (c *Client) ClusterInfo() (map[string]string, error) {
+	raw, err := c.String("CLUSTER", "INFO")
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseInfo(raw), nil
+}
+
+// ParseClusterNodes parses the text returned by CLUSTER NODES
+func ParseClusterNodes(raw string) ([]*ClusterNode, error) {
+	var nodes []*ClusterNode
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("malformed cluster node line %q", line)
+		}
+
+		node := &ClusterNode{
+			ID: fields[0],
+			// redis 4 appends the bus port as ip:port@cport
+			Addr:      strings.SplitN(fields[1], "@", 2)[0],
+			Flags:     map[string]bool{},
+			LinkState: fields[7],
+			Migrating: map[int]string{},
+			Importing: map[int]string{},
+		}
+
+		for _, flag := range strings.Split(fields[2], ",") {
+			node.Flags[flag] = true
+		}
+
+		if fields[3] != "-" {
+			node.MasterID = fields[3]
+		}
+
+		for _, slot := range fields[8:] {
+			err := node.parseSlot(slot)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// parseSlot handles "0-5460", "42" and the "[42->-<id>]" and "[42-<-<id>]"
+// entries of slots being migrated
+func (n *ClusterNode) parseSlot(slot string) error {
+	if strings.HasPrefix(slot, "[") {
+		slot = strings.Trim(slot, "[]")
+		if parts := strings.SplitN(slot, "->-", 2); len(parts) == 2 {
+			s, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return err
+			}
+
+			n.Migrating[s] = parts[1]
+			return nil
+		}
+
+		if parts := strings.SplitN(slot, "-<-", 2); len(parts) == 2 {
+			s, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return err
+			}
+
+			n.Importing[s] = parts[1]
+			return nil
+		}
+
+		return fmt.Errorf("malformed slot %q", slot)
+	}
+
+	bounds := strings.SplitN(slot, "-", 2)
+	start, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return err
+	}
+
+	end := start
+	if len(bounds) == 2 {
+		end, err = strconv.Atoi(bounds[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	n.Slots = append(n.Slots, SlotRange{Start: start, End: end})
+	return nil
+}
@@ -0,0 +1,268 @@
+// Package fake is an in-process redis server speaking just enough RESP to
+// exercise the operator's redis client: AUTH, PING, INFO and CONFIG GET/SET.
+package fake
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server listens on a random local port until Close is called
+type Server struct {
+	listener net.Listener
+	password string
+
+	mu     sync.Mutex
+	info   map[string]map[string]string
+	config map[string]string
+	conns  map[net.Conn]struct{}
+}
+
+// NewServer starts a server, clients must AUTH with password when it isn't
+// empty
+func NewServer(password string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: listener,
+		password: password,
+		info:     map[string]map[string]string{},
+		config:   map[string]string{},
+		conns:    map[net.Conn]struct{}{},
+	}
+
+	go s.serve()
+	return s, nil
+}
+
+// Addr is the host:port to dial
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// SetInfo sets a field reported by INFO in section, e.g. memory
+func (s *Server) SetInfo(section, key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	section = strings.ToLower(section)
+	if s.info[section] == nil {
+		s.info[section] = map[string]string{}
+	}
+
+	s.info[section][key] = value
+}
+
+// Config returns what CONFIG SET last set for a directive
+func (s *Server) Config(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.config[strings.ToLower(name)]
+}
+
+// Close stops listening and drops the open connections
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	authenticated := s.password == ""
+
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		command := strings.ToUpper(args[0])
+		var reply string
+		switch {
+		case command == "AUTH":
+			if len(args) == 2 && args[1] == s.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-ERR invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		default:
+			reply = s.run(command, args[1:])
+		}
+
+		_, err = io.WriteString(conn, reply)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) run(command string, args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch command {
+	case "PING":
+		return "+PONG\r\n"
+	case "INFO":
+		return bulk(s.renderInfo(args))
+	case "CONFIG":
+		if len(args) == 3 && strings.ToUpper(args[0]) == "SET" {
+			s.config[strings.ToLower(args[1])] = args[2]
+			return "+OK\r\n"
+		}
+
+		if len(args) == 2 && strings.ToUpper(args[0]) == "GET" {
+			name := strings.ToLower(args[1])
+			value, ok := s.config[name]
+			if !ok {
+				return "*0\r\n"
+			}
+
+			return "*2\r\n" + bulk(name) + bulk(value)
+		}
+
+		return "-ERR syntax error\r\n"
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", strings.ToLower(command))
+	}
+}
+
+// renderInfo writes the sections the way redis does, every section for
+// INFO, INFO all and INFO default
+func (s *Server) renderInfo(args []string) string {
+	var sections []string
+	if len(args) == 0 || args[0] == "all" || args[0] == "default" || args[0] == "everything" {
+		for section := range s.info {
+			sections = append(sections, section)
+		}
+		sort.Strings(sections)
+	} else {
+		sections = []string{strings.ToLower(args[0])}
+	}
+
+	var output strings.Builder
+	for _, section := range sections {
+		fields, ok := s.info[section]
+		if !ok {
+			continue
+		}
+
+		var keys []string
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(&output, "# %s%s\r\n", strings.ToUpper(section[:1]), section[1:])
+		for _, key := range keys {
+			fmt.Fprintf(&output, "%s:%s\r\n", key, fields[key])
+		}
+		output.WriteString("\r\n")
+	}
+
+	return output.String()
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		// inline command, as typed in telnet
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		header, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(header, "$") {
+			return nil, fmt.Errorf("expected a bulk string, got %q", header)
+		}
+
+		size, err := strconv.Atoi(header[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, size+2)
+		_, err = io.ReadFull(reader, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,513 @@
+package stub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	rConfig "github.com/flexshopper/redis-operator/pkg/config"
+	"github.com/flexshopper/redis-operator/pkg/redisclient"
+	"github.com/sirupsen/logrus"
+)
+
+// clusterBusPortOffset is added to the redis port to get the port nodes
+// gossip on
+const clusterBusPortOffset = 10000
+
+// clusterAuthVersion is the first release whose MIGRATE takes AUTH
+var clusterAuthVersion = rConfig.Version{Major: 4, Minor: 0, Patch: 7}
+
+func clusterEnabled(redis *v1alpha2.Redis) bool {
+	return redis.Spec.Topology.Mode == v1alpha2.RedisModeCluster
+}
+
+// clusterSize is the number of pods of a cluster, every shard being a
+// master and its replicas
+func clusterSize(redis *v1alpha2.Redis) int32 {
+	return redis.Spec.Topology.Shards * (1 + redis.Spec.Topology.ReplicasPerShard)
+}
+
+// clusterView is a reachable pod along with its CLUSTER NODES output
+type clusterView struct {
+	node  *redisNode
+	nodes []*redisclient.ClusterNode
+}
+
+func (v *clusterView) myself() *redisclient.ClusterNode {
+	for _, n := range v.nodes {
+		if n.Myself() {
+			return n
+		}
+	}
+
+	return nil
+}
+
+func (v *clusterView) lookup(id string) *redisclient.ClusterNode {
+	for _, n := range v.nodes {
+		if n.ID == id {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// reconcileCluster brings the pods together in a cluster and reports its
+// state. Every step is derived from what the nodes report, so a run that
+// stops halfway is picked up where it left off by the next one.
+func reconcileCluster(r *v1alpha2.Redis) ([]v1alpha2.RedisNodeStatus, *v1alpha2.RedisClusterStatus, error) {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	password, err := getPassword(redis)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes, err := getRedisNodes(redis, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	views := getClusterViews(redis, password, nodes)
+	if len(views) == 0 {
+		return getNodesStatus(nodes), nil, nil
+	}
+
+	var previous *v1alpha2.RedisReshardStatus
+	if redis.Status.Cluster != nil {
+		previous = redis.Status.Cluster.Resharding
+	}
+
+	resharding, err := bootstrapCluster(redis, password, views, previous)
+
+	clusterStatus, statusErr := getClusterStatus(redis, password, views[0])
+	if statusErr != nil {
+		// keep the progress even when the seed can't be asked about the rest
+		clusterStatus = &v1alpha2.RedisClusterStatus{}
+		if err == nil {
+			err = statusErr
+		}
+	}
+
+	clusterStatus.Resharding = resharding
+	return getClusterNodesStatus(nodes, views), clusterStatus, err
+}
+
+func getClusterViews(redis *v1alpha2.Redis, password string, nodes []*redisNode) []*clusterView {
+	var views []*clusterView
+	for _, node := range nodes {
+		if node.info == nil {
+			continue
+		}
+
+		client, err := redisclient.Dial(node.addr(redis.Spec.Port), password)
+		if err != nil {
+			logrus.Warnf("failed to connect to redis pod %s/%s: %v", node.pod.Namespace, node.pod.Name, err)
+			continue
+		}
+
+		clusterNodes, err := client.ClusterNodes()
+		client.Close()
+		if err != nil {
+			logrus.Warnf("failed to read cluster nodes of %s/%s: %v", node.pod.Namespace, node.pod.Name, err)
+			continue
+		}
+
+		view := &clusterView{node: node, nodes: clusterNodes}
+		if view.myself() != nil {
+			views = append(views, view)
+		}
+	}
+
+	return views
+}
+
+// bootstrapCluster takes one step towards the desired cluster and returns,
+// the nodes need a moment of gossip before the next one is based on them.
+// It returns the resharding progress, previous is kept while resharding
+// can't go on.
+func bootstrapCluster(redis *v1alpha2.Redis, password string, views []*clusterView,
+	previous *v1alpha2.RedisReshardStatus) (*v1alpha2.RedisReshardStatus, error) {
+	// the pod with the lowest ordinal introduces everyone
+	seed := views[0]
+
+	met, err := meetClusterNodes(redis, password, seed, views)
+	if err != nil || met {
+		return previous, err
+	}
+
+	err = forgetClusterNodes(redis, password, seed, views)
+	if err != nil {
+		return previous, err
+	}
+
+	kept := keptClusterViews(redis, views)
+	if int32(len(kept)) < clusterSize(redis) {
+		logrus.Infof("waiting for %d cluster nodes of %s/%s, %d are up",
+			clusterSize(redis), redis.Namespace, redis.Name, len(kept))
+		return previous, nil
+	}
+
+	assigned, err := assignClusterSlots(redis, password, seed, kept)
+	if err != nil || assigned {
+		return previous, err
+	}
+
+	progress, err := reshardCluster(redis, password, seed, views, previous)
+	if err != nil || (progress != nil && progress.Step != reshardStepRemoving) {
+		return progress, err
+	}
+
+	return progress, replicateClusterShards(redis, password, seed, kept)
+}
+
+// meetClusterNodes introduces the nodes the seed doesn't know yet
+func meetClusterNodes(redis *v1alpha2.Redis, password string, seed *clusterView, views []*clusterView) (bool, error) {
+	met := false
+	port := strconv.Itoa(int(redis.Spec.Port))
+
+	for _, view := range views[1:] {
+		known := seed.lookup(view.myself().ID)
+		if known != nil && !known.Flags["handshake"] && known.IP() == view.node.pod.Status.PodIP {
+			continue
+		}
+
+		logrus.Infof("introducing cluster node %s/%s", view.node.pod.Namespace, view.node.pod.Name)
+		err := runCommand(seed.node.addr(redis.Spec.Port), password,
+			"CLUSTER", "MEET", view.node.pod.Status.PodIP, port)
+		if err != nil {
+			return met, fmt.Errorf("failed to meet %s: %v", view.node.pod.Name, err)
+		}
+
+		met = true
+	}
+
+	return met, nil
+}
+
+// forgetClusterNodes drops failed nodes that serve no slot and aren't any
+// of the pods anymore, e.g. a pod that got a new node ID after losing
+// nodes.conf. Failed masters still owning slots are left for a human.
+func forgetClusterNodes(redis *v1alpha2.Redis, password string, seed *clusterView, views []*clusterView) error {
+	current := map[string]bool{}
+	for _, view := range views {
+		current[view.myself().ID] = true
+	}
+
+	for _, n := range seed.nodes {
+		if current[n.ID] || !n.Flags["fail"] || len(n.Slots) > 0 {
+			continue
+		}
+
+		logrus.Infof("forgetting failed cluster node %s of %s/%s", n.ID, redis.Namespace, redis.Name)
+
+		// FORGET has to reach every node before the others gossip it back
+		for _, view := range views {
+			if view.myself().ID == n.ID {
+				continue
+			}
+
+			err := runCommand(view.node.addr(redis.Spec.Port), password, "CLUSTER", "FORGET", n.ID)
+			if err != nil && !strings.Contains(err.Error(), "Unknown node") {
+				return fmt.Errorf("failed to forget %s on %s: %v", n.ID, view.node.pod.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// shardRange is the slot range shard i of shards starts out with
+func shardRange(i, shards int) redisclient.SlotRange {
+	return redisclient.SlotRange{
+		Start: i * redisclient.ClusterSlots / shards,
+		End:   (i+1)*redisclient.ClusterSlots/shards - 1,
+	}
+}
+
+// slotOwners maps every assigned slot to the node serving it
+func slotOwners(view *clusterView) map[int]string {
+	owners := map[int]string{}
+	for _, n := range view.nodes {
+		for _, r := range n.Slots {
+			for slot := r.Start; slot <= r.End; slot++ {
+				owners[slot] = n.ID
+			}
+		}
+	}
+
+	return owners
+}
+
+// emptyMaster is a master with neither slots nor replicas, a node that
+// hasn't been given a role yet
+func emptyMaster(seed *clusterView, view *clusterView) bool {
+	myself := view.myself()
+	if !myself.IsMaster() || len(myself.Slots) > 0 {
+		return false
+	}
+
+	for _, n := range seed.nodes {
+		if n.MasterID == myself.ID {
+			return false
+		}
+	}
+
+	return true
+}
+
+// slotAssignment is the unassigned slots of a shard and the master taking them
+type slotAssignment struct {
+	shard  int
+	target *clusterView
+	slots  []string
+}
+
+// assignClusterSlots gives every unassigned slot to the master of its shard
+func assignClusterSlots(redis *v1alpha2.Redis, password string, seed *clusterView, views []*clusterView) (bool, error) {
+	assignments, planErr := planSlotAssignments(int(redis.Spec.Topology.Shards), seed, views)
+
+	assigned := false
+	for _, assignment := range assignments {
+		target := assignment.target
+		logrus.Infof("assigning %d slots of shard %d to cluster node %s/%s",
+			len(assignment.slots), assignment.shard, target.node.pod.Namespace, target.node.pod.Name)
+		err := runCommand(target.node.addr(redis.Spec.Port), password,
+			append([]string{"CLUSTER", "ADDSLOTS"}, assignment.slots...)...)
+		if err != nil {
+			return assigned, fmt.Errorf("failed to assign slots to %s: %v", target.node.pod.Name, err)
+		}
+
+		assigned = true
+	}
+
+	return assigned, planErr
+}
+
+// planSlotAssignments finds the master of every shard with unassigned
+// slots. A shard none of whose slots are served yet gets an empty master,
+// so a bootstrap interrupted after some ADDSLOTS completes the same layout.
+// The shards planned before one without a master are returned along with
+// the error.
+func planSlotAssignments(shards int, seed *clusterView, views []*clusterView) ([]slotAssignment, error) {
+	owners := slotOwners(seed)
+	if len(owners) == redisclient.ClusterSlots {
+		return nil, nil
+	}
+
+	picked := map[string]bool{}
+	var assignments []slotAssignment
+
+	for i := 0; i < shards; i++ {
+		r := shardRange(i, shards)
+
+		var unassigned []string
+		master := ""
+		for slot := r.Start; slot <= r.End; slot++ {
+			if owner, ok := owners[slot]; ok {
+				if master == "" {
+					master = owner
+				}
+			} else {
+				unassigned = append(unassigned, strconv.Itoa(slot))
+			}
+		}
+
+		if len(unassigned) == 0 {
+			continue
+		}
+
+		var target *clusterView
+		for _, view := range views {
+			id := view.myself().ID
+			if (master != "" && id == master) || (master == "" && !picked[id] && emptyMaster(seed, view)) {
+				target = view
+				break
+			}
+		}
+
+		if target == nil {
+			return assignments, fmt.Errorf("no master available for slots %s of shard %d", r, i)
+		}
+
+		picked[target.myself().ID] = true
+		assignments = append(assignments, slotAssignment{shard: i, target: target, slots: unassigned})
+	}
+
+	return assignments, nil
+}
+
+// replicateClusterShards makes the empty masters, and the replicas of
+// masters that were drained, replicas of the shard masters with the fewest
+// replicas
+func replicateClusterShards(redis *v1alpha2.Redis, password string, seed *clusterView, views []*clusterView) error {
+	replicas := map[string]int{}
+	var masters []string
+	for _, n := range seed.nodes {
+		if n.IsMaster() && len(n.Slots) > 0 && !n.Failing() {
+			masters = append(masters, n.ID)
+			if _, ok := replicas[n.ID]; !ok {
+				replicas[n.ID] = 0
+			}
+		} else if n.MasterID != "" {
+			replicas[n.MasterID]++
+		}
+	}
+
+	for _, view := range views {
+		if !emptyMaster(seed, view) && !followsDrainedMaster(seed, view) {
+			continue
+		}
+
+		if current := view.myself().MasterID; current != "" {
+			replicas[current]--
+		}
+
+		master := ""
+		for _, id := range masters {
+			if replicas[id] < int(redis.Spec.Topology.ReplicasPerShard) && (master == "" || replicas[id] < replicas[master]) {
+				master = id
+			}
+		}
+
+		if master == "" {
+			logrus.Warnf("cluster node %s/%s has no shard to replicate", view.node.pod.Namespace, view.node.pod.Name)
+			continue
+		}
+
+		logrus.Infof("cluster node %s/%s replicates %s", view.node.pod.Namespace, view.node.pod.Name, master)
+		err := runCommand(view.node.addr(redis.Spec.Port), password, "CLUSTER", "REPLICATE", master)
+		if err != nil {
+			return fmt.Errorf("failed to replicate %s on %s: %v", master, view.node.pod.Name, err)
+		}
+
+		replicas[master]++
+	}
+
+	return nil
+}
+
+// followsDrainedMaster is true for a replica whose master serves no slot
+// anymore, a master that failed is left to the cluster's own failover
+func followsDrainedMaster(seed *clusterView, view *clusterView) bool {
+	master := seed.lookup(view.myself().MasterID)
+	return master != nil && master.IsMaster() && !master.Failing() && len(master.Slots) == 0
+}
+
+func getClusterStatus(redis *v1alpha2.Redis, password string, seed *clusterView) (*v1alpha2.RedisClusterStatus, error) {
+	client, err := redisclient.Dial(seed.node.addr(redis.Spec.Port), password)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	info, err := client.ClusterInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	count := func(key string) int32 {
+		value, _ := strconv.Atoi(info[key])
+		return int32(value)
+	}
+
+	return &v1alpha2.RedisClusterStatus{
+		State:         info["cluster_state"],
+		SlotsAssigned: count("cluster_slots_assigned"),
+		SlotsOk:       count("cluster_slots_ok"),
+		SlotsPFail:    count("cluster_slots_pfail"),
+		SlotsFail:     count("cluster_slots_fail"),
+		KnownNodes:    count("cluster_known_nodes"),
+		Size:          count("cluster_size"),
+	}, nil
+}
+
+// getClusterNodesStatus adds the node IDs, slots and health as seen by the
+// seed to the replication status of the pods
+func getClusterNodesStatus(nodes []*redisNode, views []*clusterView) []v1alpha2.RedisNodeStatus {
+	statuses := getNodesStatus(nodes)
+	if len(views) == 0 {
+		return statuses
+	}
+
+	seed := views[0]
+	ids := map[string]string{}
+	for _, view := range views {
+		ids[view.node.pod.Name] = view.myself().ID
+	}
+
+	for i := range statuses {
+		status := &statuses[i]
+		status.NodeID = ids[status.Name]
+
+		n := seed.lookup(status.NodeID)
+		if n == nil {
+			continue
+		}
+
+		var slots []string
+		for _, r := range n.Slots {
+			slots = append(slots, r.String())
+		}
+		status.Slots = strings.Join(slots, ",")
+
+		switch {
+		case n.Flags["fail"]:
+			status.Health = "fail"
+		case n.Flags["fail?"]:
+			status.Health = "pfail"
+		default:
+			status.Health = n.LinkState
+		}
+	}
+
+	return statuses
+}
+
+func validateCluster(redis *v1alpha2.Redis) []string {
+	var validationErrors []string
+
+	switch redis.Spec.Topology.Mode {
+	case "", v1alpha2.RedisModeStandalone:
+		if redis.Spec.Topology.Shards != 0 || redis.Spec.Topology.ReplicasPerShard != 0 {
+			validationErrors = append(validationErrors, "shards and replicasPerShard require cluster mode")
+		}
+
+		return validationErrors
+	case v1alpha2.RedisModeCluster:
+	default:
+		return append(validationErrors, fmt.Sprintf("mode ( %s ) is not supported", redis.Spec.Topology.Mode))
+	}
+
+	// shards defaults to 3, an explicit value below that can't fail over
+	if redis.Spec.Topology.Shards != 0 && redis.Spec.Topology.Shards < 3 {
+		validationErrors = append(validationErrors,
+			fmt.Sprintf("shards ( %d ) must be at least 3", redis.Spec.Topology.Shards))
+	}
+
+	if redis.Spec.Topology.ReplicasPerShard < 0 {
+		validationErrors = append(validationErrors,
+			fmt.Sprintf("replicasPerShard ( %d ) can't be negative", redis.Spec.Topology.ReplicasPerShard))
+	}
+
+	if redis.Spec.Topology.Replicas != 0 || redis.Spec.Topology.Sentinel != nil {
+		validationErrors = append(validationErrors,
+			"replicas and sentinel are not supported in cluster mode, use replicasPerShard")
+	}
+
+	// resharding moves the keys with MIGRATE, which takes a password from
+	// 4.0.7 on
+	r := redis.DeepCopy()
+	r.SetDefaults()
+	version, err := rConfig.ResolveNewestVersion(&r.Spec)
+	if err == nil && r.Spec.Security.PasswordSecret != "" && version.Less(clusterAuthVersion) {
+		validationErrors = append(validationErrors, fmt.Sprintf(
+			"cluster mode with a passwordSecret needs redis %s or later, the image ( %s ) runs %s",
+			clusterAuthVersion, r.Spec.Image, version))
+	}
+
+	return validationErrors
+}
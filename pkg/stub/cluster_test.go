@@ -0,0 +1,207 @@
+package stub
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/flexshopper/redis-operator/pkg/redisclient"
+)
+
+func TestValidateCluster(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*v1alpha2.RedisSpec)
+		want   []string
+	}{
+		{
+			name: "standalone",
+		},
+		{
+			name: "shards without cluster mode",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology.Shards = 3
+			},
+			want: []string{"shards and replicasPerShard require cluster mode"},
+		},
+		{
+			name: "cluster",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology = v1alpha2.RedisTopology{Mode: v1alpha2.RedisModeCluster, Shards: 3, ReplicasPerShard: 1}
+			},
+		},
+		{
+			name: "too few shards and replicas",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology = v1alpha2.RedisTopology{Mode: v1alpha2.RedisModeCluster, Shards: 2, Replicas: 1}
+			},
+			want: []string{
+				"shards ( 2 ) must be at least 3",
+				"replicas and sentinel are not supported in cluster mode, use replicasPerShard",
+			},
+		},
+		{
+			name: "password on the newest 4.0",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology = v1alpha2.RedisTopology{Mode: v1alpha2.RedisModeCluster}
+				spec.Image = "redis:4.0-alpine"
+				spec.Security.PasswordSecret = "redis"
+			},
+		},
+		{
+			name: "password on 4.0.7",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology = v1alpha2.RedisTopology{Mode: v1alpha2.RedisModeCluster}
+				spec.Image = "redis:4.0.7"
+				spec.Security.PasswordSecret = "redis"
+			},
+		},
+		{
+			name: "password before MIGRATE AUTH",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology = v1alpha2.RedisTopology{Mode: v1alpha2.RedisModeCluster}
+				spec.Image = "redis:4.0.6"
+				spec.Security.PasswordSecret = "redis"
+			},
+			want: []string{"cluster mode with a passwordSecret needs redis 4.0.7 or later, the image ( redis:4.0.6 ) runs 4.0.6"},
+		},
+		{
+			name: "password before MIGRATE AUTH by spec.version",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology = v1alpha2.RedisTopology{Mode: v1alpha2.RedisModeCluster}
+				spec.Image = "registry.local/redis"
+				spec.Version = "3.2"
+				spec.Security.PasswordSecret = "redis"
+			},
+			want: []string{"cluster mode with a passwordSecret needs redis 4.0.7 or later, the image ( registry.local/redis ) runs 3.2.99"},
+		},
+		{
+			name: "old version without a password",
+			mutate: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology = v1alpha2.RedisTopology{Mode: v1alpha2.RedisModeCluster}
+				spec.Image = "redis:3.2.1"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		redis := testRedis()
+		redis.Spec.Topology = v1alpha2.RedisTopology{}
+		if test.mutate != nil {
+			test.mutate(&redis.Spec)
+		}
+
+		if got := validateCluster(redis); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// testClusterSeed sees every node of views along with others, e.g. replicas
+func testClusterSeed(views []*clusterView, others ...*redisclient.ClusterNode) *clusterView {
+	seed := &clusterView{nodes: others}
+	for _, view := range views {
+		seed.nodes = append(seed.nodes, view.nodes...)
+	}
+
+	return seed
+}
+
+func TestPlanSlotAssignments(t *testing.T) {
+	replicaOfA := &redisclient.ClusterNode{ID: "r", Flags: map[string]bool{"slave": true}, MasterID: "a"}
+
+	tests := []struct {
+		name   string
+		shards int
+		views  []*clusterView
+		others []*redisclient.ClusterNode
+		// want is the master each shard with unassigned slots goes to, and
+		// how many slots it's given
+		want  map[int]string
+		slots map[int]int
+		err   bool
+	}{
+		{
+			name:  "bootstrap",
+			views: []*clusterView{testClusterView("a"), testClusterView("b"), testClusterView("c")},
+			want:  map[int]string{0: "a", 1: "b", 2: "c"},
+			slots: map[int]int{0: 5461, 1: 5461, 2: 5462},
+		},
+		{
+			// ADDSLOTS went through for the first shard and part of the second
+			name: "interrupted bootstrap",
+			views: []*clusterView{
+				testClusterView("a", redisclient.SlotRange{Start: 0, End: 5460}),
+				testClusterView("b", redisclient.SlotRange{Start: 5461, End: 6000}),
+				testClusterView("c"),
+			},
+			want:  map[int]string{1: "b", 2: "c"},
+			slots: map[int]int{1: 4921, 2: 5462},
+		},
+		{
+			name:   "every slot served",
+			shards: 2,
+			views: []*clusterView{
+				testClusterView("a", redisclient.SlotRange{Start: 0, End: 8191}),
+				testClusterView("b", redisclient.SlotRange{Start: 8192, End: 16383}),
+			},
+			want: map[int]string{},
+		},
+		{
+			// a has a replica, it isn't free to take a shard
+			name:   "master with a replica",
+			views:  []*clusterView{testClusterView("a"), testClusterView("b"), testClusterView("c")},
+			others: []*redisclient.ClusterNode{replicaOfA},
+			want:   map[int]string{0: "b", 1: "c"},
+			slots:  map[int]int{0: 5461, 1: 5461},
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		seed := testClusterSeed(test.views, test.others...)
+		shards := test.shards
+		if shards == 0 {
+			shards = 3
+		}
+
+		assignments, err := planSlotAssignments(shards, seed, test.views)
+
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+
+		got := map[int]string{}
+		slots := map[int]int{}
+		for _, assignment := range assignments {
+			got[assignment.shard] = assignment.target.myself().ID
+			slots[assignment.shard] = len(assignment.slots)
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got masters %v, want %v", test.name, got, test.want)
+		}
+
+		if test.slots != nil && !reflect.DeepEqual(slots, test.slots) {
+			t.Errorf("%s: got slot counts %v, want %v", test.name, slots, test.slots)
+		}
+	}
+}
+
+func TestShardRange(t *testing.T) {
+	for _, shards := range []int{1, 3, 5, 7} {
+		next := 0
+		for i := 0; i < shards; i++ {
+			r := shardRange(i, shards)
+			if r.Start != next || r.End < r.Start {
+				t.Errorf("%d shards: shard %d got %s, want it to start at %d", shards, i, r, next)
+			}
+
+			next = r.End + 1
+		}
+
+		if next != redisclient.ClusterSlots {
+			t.Errorf("%d shards: the ranges end at %d", shards, next-1)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	eventComponent = "redis-operator"
+	// an identical event seen within eventAggregationWindow bumps the count
+	// of the existing Event instead of creating a new one
+	eventAggregationWindow = 10 * time.Minute
+	// eventFlushInterval bounds how often the count of a repeated Event is
+	// written, repeats in between are only counted in memory
+	eventFlushInterval = time.Minute
+	// the API server refuses longer messages
+	maxEventMessageLength = 1024
+)
+
+// eventRecorder writes Events on Redis objects, client-go's recorder isn't
+// available in the vendored tree
+type eventRecorder struct {
+	mu     sync.Mutex
+	recent map[string]*recordedEvent
+	// create and patch write the Events, replaced in tests
+	create func(sdk.Object) error
+	patch  func(sdk.Object, types.PatchType, []byte) error
+}
+
+type recordedEvent struct {
+	event     *corev1.Event
+	lastWrite time.Time
+}
+
+func newEventRecorder() *eventRecorder {
+	return &eventRecorder{
+		recent: map[string]*recordedEvent{},
+		create: sdk.Create,
+		patch:  sdk.Patch,
+	}
+}
+
+// recorder is used by the helpers creating and deleting children, which
+// aren't handed the Handler
+var recorder = newEventRecorder()
+
+// Event records an event on the Redis ref points to, failures to write it
+// are only logged
+func (r *eventRecorder) Event(ref *corev1.ObjectReference, eventType, reason, message string) {
+	if ref == nil {
+		return
+	}
+
+	if len(message) > maxEventMessageLength {
+		message = message[:maxEventMessageLength-3] + "..."
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key, recorded := range r.recent {
+		if now.Sub(recorded.event.LastTimestamp.Time) > eventAggregationWindow {
+			delete(r.recent, key)
+		}
+	}
+
+	key := strings.Join([]string{ref.Namespace, ref.Kind, ref.Name, string(ref.UID), eventType, reason, message}, "/")
+	if recorded, ok := r.recent[key]; ok {
+		recorded.event.Count++
+		recorded.event.LastTimestamp = metav1.NewTime(now)
+
+		if now.Sub(recorded.lastWrite) < eventFlushInterval {
+			return
+		}
+
+		err := r.writeCount(recorded)
+		if err == nil {
+			return
+		}
+
+		// most likely the Event expired, start a new one
+		logrus.Warnf("failed to update event %s/%s: %v", recorded.event.Namespace, recorded.event.Name, err)
+		delete(r.recent, key)
+	}
+
+	event := &corev1.Event{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Event",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", ref.Name, now.UnixNano()),
+			Namespace: ref.Namespace,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        message,
+		FirstTimestamp: metav1.NewTime(now),
+		LastTimestamp:  metav1.NewTime(now),
+		Count:          1,
+		Type:           eventType,
+		Source: corev1.EventSource{
+			Component: eventComponent,
+		},
+	}
+
+	err := r.create(event)
+	if err != nil {
+		logrus.Warnf("failed to record %s event on %s/%s: %v", reason, ref.Namespace, ref.Name, err)
+		return
+	}
+
+	r.recent[key] = &recordedEvent{event: event, lastWrite: now}
+}
+
+func (r *eventRecorder) Eventf(ref *corev1.ObjectReference, eventType, reason, format string, args ...interface{}) {
+	r.Event(ref, eventType, reason, fmt.Sprintf(format, args...))
+}
+
+func (r *eventRecorder) writeCount(recorded *recordedEvent) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"count":         recorded.event.Count,
+		"lastTimestamp": recorded.event.LastTimestamp,
+	})
+	if err != nil {
+		return err
+	}
+
+	event := recorded.event.DeepCopy()
+	err = r.patch(event, types.MergePatchType, patch)
+	if err != nil {
+		return err
+	}
+
+	recorded.lastWrite = time.Now()
+	return nil
+}
+
+// redisReference points an Event at a Redis
+func redisReference(redis *v1alpha2.Redis) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion:      v1alpha2.SchemeGroupVersion.String(),
+		Kind:            "Redis",
+		Namespace:       redis.Namespace,
+		Name:            redis.Name,
+		UID:             redis.UID,
+		ResourceVersion: redis.ResourceVersion,
+	}
+}
+
+// owningRedisReference points an Event at the Redis an object belongs to,
+// see owningRedis
+func owningRedisReference(object sdk.Object) *corev1.ObjectReference {
+	if redis, ok := object.(*v1alpha2.Redis); ok {
+		return redisReference(redis)
+	}
+
+	accessor, ok := object.(metav1.Object)
+	if !ok {
+		return nil
+	}
+
+	ref := &corev1.ObjectReference{
+		APIVersion: v1alpha2.SchemeGroupVersion.String(),
+		Kind:       "Redis",
+		Namespace:  accessor.GetNamespace(),
+	}
+
+	if owner := metav1.GetControllerOf(accessor); owner != nil && owner.Kind == "Redis" {
+		ref.Name = owner.Name
+		ref.UID = owner.UID
+		return ref
+	}
+
+	if name, ok := accessor.GetLabels()["lru-cache"]; ok {
+		ref.Name = name
+		return ref
+	}
+
+	return nil
+}
+
+// recordChildOperation records a successful create, update or delete of a
+// child, failures are recorded by recordAPIError
+func recordChildOperation(object sdk.Object, operation string, err error) {
+	if err != nil {
+		return
+	}
+
+	name, _, _ := objectInfo(object)
+	reasons := map[string]string{"create": "Created", "update": "Updated", "delete": "Deleted"}
+	recorder.Eventf(owningRedisReference(object), corev1.EventTypeNormal, reasons[operation],
+		"%s %s", strings.ToLower(reasons[operation]), name)
+}
+
+func recordAPIError(object sdk.Object, operation string, err error) {
+	name, _, _ := objectInfo(object)
+	recorder.Eventf(owningRedisReference(object), corev1.EventTypeWarning, "APIError",
+		"failed to %s %s: %v", operation, name, err)
+}
+
+// recordRollout records the changes of a workload that restart the pods
+func recordRollout(redis *v1alpha2.Redis, object sdk.Object, drifted []string) {
+	annotations := map[string]string{
+		".spec.template.metadata.annotations.configmap/hash":          "redis.conf",
+		".spec.template.metadata.annotations." + secretHashAnnotation: "password Secret",
+	}
+
+	name, _, _ := objectInfo(object)
+	for _, path := range drifted {
+		if changed, ok := annotations[path]; ok {
+			recorder.Eventf(redisReference(redis), corev1.EventTypeNormal, "ConfigChanged",
+				"%s changed, restarting the pods of %s", changed, name)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package stub
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fakeEventRecorder keeps the Events it writes instead of sending them
+type fakeEventRecorder struct {
+	*eventRecorder
+	created  []*corev1.Event
+	patches  []string
+	patchErr error
+}
+
+func newFakeEventRecorder() *fakeEventRecorder {
+	f := &fakeEventRecorder{eventRecorder: newEventRecorder()}
+	f.create = func(object sdk.Object) error {
+		f.created = append(f.created, object.(*corev1.Event))
+		return nil
+	}
+	f.patch = func(object sdk.Object, pt types.PatchType, patch []byte) error {
+		f.patches = append(f.patches, string(patch))
+		return f.patchErr
+	}
+	return f
+}
+
+// flushed makes the aggregated Events due for a write
+func (f *fakeEventRecorder) flushed() {
+	for _, recorded := range f.recent {
+		recorded.lastWrite = recorded.lastWrite.Add(-eventFlushInterval)
+	}
+}
+
+func TestEventRecorderAggregation(t *testing.T) {
+	ref := redisReference(testRedis())
+
+	tests := []struct {
+		name     string
+		record   func(f *fakeEventRecorder)
+		created  int
+		patches  int
+		count    int32
+		patchErr error
+	}{
+		{
+			name: "repeated within the flush interval",
+			record: func(f *fakeEventRecorder) {
+				f.Event(ref, corev1.EventTypeWarning, "APIError", "failed")
+				f.Event(ref, corev1.EventTypeWarning, "APIError", "failed")
+				f.Event(ref, corev1.EventTypeWarning, "APIError", "failed")
+			},
+			created: 1,
+			count:   3,
+		},
+		{
+			name: "repeated past the flush interval",
+			record: func(f *fakeEventRecorder) {
+				f.Event(ref, corev1.EventTypeWarning, "APIError", "failed")
+				f.flushed()
+				f.Event(ref, corev1.EventTypeWarning, "APIError", "failed")
+			},
+			created: 1,
+			patches: 1,
+			count:   2,
+		},
+		{
+			name: "expired Event",
+			record: func(f *fakeEventRecorder) {
+				f.Event(ref, corev1.EventTypeWarning, "APIError", "failed")
+				f.flushed()
+				f.Event(ref, corev1.EventTypeWarning, "APIError", "failed")
+			},
+			patchErr: errors.New("not found"),
+			created:  2,
+			patches:  1,
+			count:    1,
+		},
+		{
+			name: "different messages",
+			record: func(f *fakeEventRecorder) {
+				f.Event(ref, corev1.EventTypeWarning, "APIError", "failed")
+				f.Event(ref, corev1.EventTypeWarning, "APIError", "failed again")
+			},
+			created: 2,
+			count:   1,
+		},
+		{
+			name: "no Redis to point at",
+			record: func(f *fakeEventRecorder) {
+				f.Event(nil, corev1.EventTypeWarning, "APIError", "failed")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		f := newFakeEventRecorder()
+		f.patchErr = test.patchErr
+		test.record(f)
+
+		if len(f.created) != test.created {
+			t.Errorf("%s: got %d Events created, want %d", test.name, len(f.created), test.created)
+		}
+
+		if len(f.patches) != test.patches {
+			t.Errorf("%s: got %d counts written, want %d", test.name, len(f.patches), test.patches)
+		}
+
+		if len(f.created) == 0 {
+			continue
+		}
+
+		last := f.created[len(f.created)-1]
+		if last.Count != test.count {
+			t.Errorf("%s: got count %d, want %d", test.name, last.Count, test.count)
+		}
+
+		if last.InvolvedObject != *ref || last.Namespace != ref.Namespace {
+			t.Errorf("%s: got Event on %v in %s", test.name, last.InvolvedObject, last.Namespace)
+		}
+	}
+}
+
+func TestEventRecorderTruncates(t *testing.T) {
+	f := newFakeEventRecorder()
+	f.Event(redisReference(testRedis()), corev1.EventTypeWarning, "APIError", strings.Repeat("x", 2*maxEventMessageLength))
+
+	message := f.created[0].Message
+	if len(message) != maxEventMessageLength || !strings.HasSuffix(message, "...") {
+		t.Errorf("got a message of %d bytes ending with %q", len(message), message[len(message)-3:])
+	}
+}
+
+func TestEventRecorderExpires(t *testing.T) {
+	f := newFakeEventRecorder()
+	ref := redisReference(testRedis())
+	f.Event(ref, corev1.EventTypeNormal, "Created", "created cache")
+
+	for _, recorded := range f.recent {
+		recorded.event.LastTimestamp = metav1.NewTime(time.Now().Add(-eventAggregationWindow - time.Second))
+	}
+
+	f.Event(ref, corev1.EventTypeNormal, "Created", "created cache")
+	if len(f.created) != 2 || len(f.patches) != 0 {
+		t.Errorf("got %d Events created and %d counts written, want a new Event", len(f.created), len(f.patches))
+	}
+}
+
+func TestOwningRedisReference(t *testing.T) {
+	redis := testRedis()
+
+	owned := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:            "cache-read",
+		Namespace:       "default",
+		OwnerReferences: ownerReferences(redis),
+	}}
+
+	labeled := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "cache-0",
+		Namespace: "default",
+		Labels:    map[string]string{"lru-cache": "cache"},
+	}}
+
+	unrelated := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"}}
+
+	tests := []struct {
+		name   string
+		object sdk.Object
+		want   string
+		uid    types.UID
+	}{
+		{name: "the Redis", object: redis, want: "cache", uid: "uid"},
+		{name: "owned", object: owned, want: "cache", uid: "uid"},
+		{name: "labeled", object: labeled, want: "cache"},
+		{name: "unrelated", object: unrelated},
+	}
+
+	for _, test := range tests {
+		ref := owningRedisReference(test.object)
+		if test.want == "" {
+			if ref != nil {
+				t.Errorf("%s: got %v, want none", test.name, ref)
+			}
+			continue
+		}
+
+		if ref == nil || ref.Kind != "Redis" || ref.Name != test.want || ref.UID != test.uid || ref.Namespace != "default" {
+			t.Errorf("%s: got %v, want the Redis %s", test.name, ref, test.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package stub
+
+import (
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/sirupsen/logrus"
+)
+
+// redisFinalizer holds the Redis object until its children are cleaned up
+const redisFinalizer = "cache.flexshopper.com/cleanup"
+
+// cleanUpChildren and updateFinalizers are replaced in tests
+var (
+	cleanUpChildren  = deleteResources
+	updateFinalizers = updateObject
+)
+
+func hasFinalizer(redis *v1alpha2.Redis) bool {
+	for _, f := range redis.Finalizers {
+		if f == redisFinalizer {
+			return true
+		}
+	}
+
+	return false
+}
+
+func addFinalizer(redis *v1alpha2.Redis) error {
+	redis.Finalizers = append(redis.Finalizers, redisFinalizer)
+	return updateFinalizers(redis)
+}
+
+func removeFinalizer(redis *v1alpha2.Redis) error {
+	var finalizers []string
+	for _, f := range redis.Finalizers {
+		if f != redisFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+
+	redis.Finalizers = finalizers
+	return updateFinalizers(redis)
+}
+
+// finalizeRedis runs the cleanup of a Redis being deleted, the finalizer is
+// only released once every child is gone so a failure is retried on resync
+func finalizeRedis(redis *v1alpha2.Redis) error {
+	if !hasFinalizer(redis) {
+		return nil
+	}
+
+	err := cleanUpChildren(redis)
+	if err != nil {
+		logrus.Errorf("failed to clean up redis %s/%s with error : %v", redis.Namespace, redis.Name, err)
+		return err
+	}
+
+	return removeFinalizer(redis)
+}
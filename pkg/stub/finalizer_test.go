@@ -0,0 +1,116 @@
+package stub
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+)
+
+// fakeFinalizerCalls records the cleanups and the finalizers written while
+// it's in place
+type fakeFinalizerCalls struct {
+	cleanups   int
+	updates    [][]string
+	cleanupErr error
+}
+
+func fakeFinalizers() *fakeFinalizerCalls {
+	calls := &fakeFinalizerCalls{}
+
+	cleanUpChildren = func(*v1alpha2.Redis) error {
+		calls.cleanups++
+		return calls.cleanupErr
+	}
+
+	updateFinalizers = func(object sdk.Object) error {
+		calls.updates = append(calls.updates, object.(*v1alpha2.Redis).Finalizers)
+		return nil
+	}
+
+	return calls
+}
+
+func TestAddFinalizer(t *testing.T) {
+	defer func(cleanUp func(*v1alpha2.Redis) error, update func(sdk.Object) error) {
+		cleanUpChildren, updateFinalizers = cleanUp, update
+	}(cleanUpChildren, updateFinalizers)
+
+	calls := fakeFinalizers()
+
+	redis := testRedis()
+	redis.Finalizers = []string{"someone.else/finalizer"}
+	if hasFinalizer(redis) {
+		t.Fatalf("got the finalizer on %v", redis.Finalizers)
+	}
+
+	err := addFinalizer(redis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"someone.else/finalizer", redisFinalizer}}
+	if !reflect.DeepEqual(calls.updates, want) || !hasFinalizer(redis) {
+		t.Errorf("got updates %v, want %v", calls.updates, want)
+	}
+}
+
+func TestFinalizeRedis(t *testing.T) {
+	defer func(cleanUp func(*v1alpha2.Redis) error, update func(sdk.Object) error) {
+		cleanUpChildren, updateFinalizers = cleanUp, update
+	}(cleanUpChildren, updateFinalizers)
+
+	tests := []struct {
+		name       string
+		finalizers []string
+		cleanupErr error
+		cleanups   int
+		updates    [][]string
+		err        bool
+	}{
+		{
+			name:       "released once the children are gone",
+			finalizers: []string{redisFinalizer},
+			cleanups:   1,
+			updates:    [][]string{nil},
+		},
+		{
+			name:       "other finalizers are kept",
+			finalizers: []string{"someone.else/finalizer", redisFinalizer},
+			cleanups:   1,
+			updates:    [][]string{{"someone.else/finalizer"}},
+		},
+		{
+			// retried on the next resync
+			name:       "children still there",
+			finalizers: []string{redisFinalizer},
+			cleanupErr: fmt.Errorf("waiting for cache in default to be deleted"),
+			cleanups:   1,
+			err:        true,
+		},
+		{
+			name:       "already released",
+			finalizers: []string{"someone.else/finalizer"},
+		},
+	}
+
+	for _, test := range tests {
+		calls := fakeFinalizers()
+		calls.cleanupErr = test.cleanupErr
+
+		redis := testRedis()
+		redis.Finalizers = test.finalizers
+
+		err := finalizeRedis(redis)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+
+		if calls.cleanups != test.cleanups || !reflect.DeepEqual(calls.updates, test.updates) {
+			t.Errorf("%s: got %d cleanups and updates %v, want %d and %v",
+				test.name, calls.cleanups, calls.updates, test.cleanups, test.updates)
+		}
+	}
+}
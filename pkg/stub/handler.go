@@ -1,4 +1,5 @@
 package stub
+
 // Example operator handle code below method names have been chosen for explicitness
 // not idiomatic go-ness
 
@@ -6,62 +7,173 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
-	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha1"
+	"fmt"
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
 	rConfig "github.com/flexshopper/redis-operator/pkg/config"
+	"github.com/flexshopper/redis-operator/pkg/redisclient"
 	"github.com/operator-framework/operator-sdk/pkg/sdk"
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"strings"
+	"sync"
+	"time"
 )
 
-
 func NewHandler() sdk.Handler {
-	return &Handler{}
+	return &Handler{
+		sentinelWatchers: map[string]*sentinelWatcher{},
+		infoPoller:       newInfoPoller(redisclient.DefaultDialer, infoPollInterval),
+		recorder:         recorder,
+	}
 }
 
 type Handler struct {
-	// Fill me
+	mu               sync.Mutex
+	sentinelWatchers map[string]*sentinelWatcher
+	infoPoller       *infoPoller
+	recorder         *eventRecorder
 }
 
 // This method handles incoming events, we filter for our own and take action
 // The incoming event looks like:
 // { Deleted: <true|false>, Object: Redis }
-func (h *Handler) Handle(ctx context.Context, event sdk.Event) error {
+func (h *Handler) Handle(ctx context.Context, event sdk.Event) (err error) {
 	switch o := event.Object.(type) {
-	case *v1alpha1.Redis:
+	case *v1alpha2.Redis:
 		if event.Deleted {
+			h.stopSentinelWatcher(o)
+			h.infoPoller.forget(o)
+			forgetConditionMetrics(o)
 			return deleteResources(o)
 		}
 
-		o.Status.Phase = "Initializing"
-		sdk.Update(o)
+		start := time.Now()
+		result := reconcileSucceeded
+		defer func() { observeReconcile(o, result, start, err) }()
+
+		if o.DeletionTimestamp != nil {
+			h.stopSentinelWatcher(o)
+			h.infoPoller.forget(o)
+			return finalizeRedis(o)
+		}
+
+		if !hasFinalizer(o) {
+			err = addFinalizer(o)
+			if err != nil {
+				logrus.Errorf("failed to add finalizer with error : %v", err)
+				return err
+			}
+		}
+
+		status := o.Status.DeepCopy()
+		status.ObservedGeneration = o.Generation
 
 		validationErrors := validate(o)
 		if len(validationErrors) > 0 {
-			o.Status.Phase = "Erred"
-			o.Status.Errors = validationErrors
-			sdk.Update(o)
+			setCondition(status, o.Generation, v1alpha2.RedisConfigValid, corev1.ConditionFalse,
+				"ValidationFailed", strings.Join(validationErrors, "; "))
+			setReadyCondition(o, status)
+			result = reconcileInvalid
 			logrus.Error("there were validation errors")
-			return nil
+			h.recorder.Event(redisReference(o), corev1.EventTypeWarning, "ValidationFailed",
+				strings.Join(validationErrors, "; "))
+			return updateStatus(o, status)
 		}
 
-		err := createOrUpdateResources(o)
+		setCondition(status, o.Generation, v1alpha2.RedisConfigValid, corev1.ConditionTrue, "Valid", "")
+
+		// a Redis the policy no longer allows keeps running as it is
+		violations := checkPolicy(o)
+		if len(violations) > 0 {
+			setCondition(status, o.Generation, v1alpha2.RedisPolicyCompliant, corev1.ConditionFalse,
+				"PolicyViolation", strings.Join(violations, "; "))
+			setReadyCondition(o, status)
+			result = reconcileInvalid
+			logrus.Errorf("redis %s/%s breaks the policy", o.Namespace, o.Name)
+			h.recorder.Event(redisReference(o), corev1.EventTypeWarning, "PolicyViolation",
+				strings.Join(violations, "; "))
+			return updateStatus(o, status)
+		}
+
+		setCondition(status, o.Generation, v1alpha2.RedisPolicyCompliant, corev1.ConditionTrue, "Compliant", "")
+
+		err = createOrUpdateResources(o)
 		if err != nil && !errors.IsAlreadyExists(err) {
 			logrus.Errorf("failed to reconcile redis with error : %v", err)
+			h.recorder.Eventf(redisReference(o), corev1.EventTypeWarning, "ReconcileFailed",
+				"failed to reconcile: %v", err)
+			setCondition(status, o.Generation, v1alpha2.RedisResourcesCreated, corev1.ConditionFalse,
+				"ReconcileFailed", err.Error())
+			setReadyCondition(o, status)
+			updateStatus(o, status)
+			return err
+		}
+
+		setCondition(status, o.Generation, v1alpha2.RedisResourcesCreated, corev1.ConditionTrue, "Reconciled", "")
+		h.syncSentinelWatcher(o)
+
+		if clusterEnabled(o) {
+			status.Nodes, status.Cluster, err = reconcileCluster(o)
+		} else {
+			status.Nodes, err = reconcileReplication(o)
+			status.Cluster = nil
+		}
+
+		if err != nil {
+			logrus.Errorf("failed to reconcile replication with error : %v", err)
+			h.recorder.Eventf(redisReference(o), corev1.EventTypeWarning, "ReplicationFailed",
+				"failed to reconcile replication: %v", err)
+		}
+
+		applied, err := hotApplyConfig(o)
+		setHotAppliedConfig(status, applied)
+		if len(applied) > 0 {
+			h.recorder.Eventf(redisReference(o), corev1.EventTypeNormal, "ConfigHotApplied",
+				"applied %s without a restart", strings.Join(sortedKeys(applied), ", "))
+		}
+		if err != nil {
+			logrus.Errorf("failed to hot apply config with error : %v", err)
+			h.recorder.Eventf(redisReference(o), corev1.EventTypeWarning, "HotApplyFailed",
+				"failed to hot apply config: %v", err)
+		}
+
+		err = h.pollInstances(o, status)
+		if err != nil {
+			logrus.Errorf("failed to poll redis info with error : %v", err)
+		}
+
+		children, err := getChildrenStatus(o)
+		if err == nil {
+			status.Children = children
+			err = setDeploymentAvailableCondition(o, status)
+		}
+
+		if err != nil {
+			logrus.Errorf("failed to read children status with error : %v", err)
 			return err
 		}
 
-		o.Status.Errors = nil
-		o.Status.Phase = "Complete"
-		sdk.Update(o)
+		setReadyCondition(o, status)
+
+		return updateStatus(o, status)
 	}
 
 	return nil
 }
 
+// ownerReferences makes every child garbage collected with its Redis, even
+// when the operator isn't running at the time it's deleted
+func ownerReferences(redis *v1alpha2.Redis) []metav1.OwnerReference {
+	return []metav1.OwnerReference{
+		*metav1.NewControllerRef(redis, v1alpha2.SchemeGroupVersion.WithKind("Redis")),
+	}
+}
+
 func genericObjectDefinitionLabels() map[string]string {
 	return map[string]string{
 		"flexOperator": "cache",
@@ -91,44 +203,129 @@ func getMd5(text string) string {
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
-func deleteResources(redis *v1alpha1.Redis) error {
-
-	deploy, err := getDeploymentDefinition(redis)
+// deleteResources removes the children in order: the Services first so no
+// traffic reaches a dying pod, then the Deployment or StatefulSet and, once
+// their pods are gone, the ConfigMaps and Secret they mount. It's safe to call
+// repeatedly, anything already gone is skipped and the remaining children are
+// still deleted.
+// The children are named from the Redis only, nothing is rendered from a
+// spec that may no longer render.
+func deleteResources(redis *v1alpha2.Redis) error {
+	var errs []error
+
+	err := deleteMonitoringResources(redis)
 	if err != nil {
-		return err
+		errs = append(errs, err)
 	}
 
-	err =  sdk.Delete(deploy)
-	if err != nil {
-		return err
+	services := []sdk.Object{
+		&corev1.Service{TypeMeta: serviceTypeMeta, ObjectMeta: childObjectMeta(redis, redis.Name)},
+		&corev1.Service{TypeMeta: serviceTypeMeta, ObjectMeta: childObjectMeta(redis, redis.Name+"-read")},
+		&corev1.Service{TypeMeta: serviceTypeMeta, ObjectMeta: childObjectMeta(redis, sentinelName(redis))},
 	}
 
-	cm, err := getConfigMapDefinition(redis)
-	if err != nil {
-		return err
+	for _, svc := range services {
+		err = deleteChild(svc)
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
 	}
 
-	err = sdk.Delete(cm)
-	if err != nil {
-		return err
+	workloads := []sdk.Object{
+		&v1.Deployment{TypeMeta: deploymentTypeMeta, ObjectMeta: childObjectMeta(redis, redis.Name)},
+		&v1.StatefulSet{TypeMeta: statefulSetTypeMeta, ObjectMeta: childObjectMeta(redis, redis.Name)},
+		&v1.StatefulSet{TypeMeta: statefulSetTypeMeta, ObjectMeta: childObjectMeta(redis, sentinelName(redis))},
+	}
+
+	// Foreground deletion keeps the workloads around until their pods are
+	// gone, claims created by the StatefulSet are kept so the data survives
+	foreground := metav1.DeletePropagationForeground
+	for _, workload := range workloads {
+		err = deleteChild(workload, sdk.WithDeleteOptions(&metav1.DeleteOptions{PropagationPolicy: &foreground}))
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, workload := range workloads {
+		err = sdk.Get(workload)
+		if err == nil {
+			name, namespace, _ := objectInfo(workload)
+			errs = append(errs, fmt.Errorf("waiting for %s in %s to be deleted", name, namespace))
+		} else if !errors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	mounted := []sdk.Object{
+		&corev1.ConfigMap{TypeMeta: configMapTypeMeta, ObjectMeta: childObjectMeta(redis, redis.Name)},
+		&corev1.ConfigMap{TypeMeta: configMapTypeMeta, ObjectMeta: childObjectMeta(redis, sentinelName(redis))},
+		&corev1.Secret{TypeMeta: secretTypeMeta, ObjectMeta: childObjectMeta(redis, authSecretName(redis))},
+	}
+
+	for _, object := range mounted {
+		err = deleteChild(object)
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+var (
+	serviceTypeMeta     = metav1.TypeMeta{APIVersion: "v1", Kind: "Service"}
+	configMapTypeMeta   = metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}
+	secretTypeMeta      = metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}
+	deploymentTypeMeta  = metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"}
+	statefulSetTypeMeta = metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"}
+)
+
+// childObjectMeta is the name of a child of redis, enough to get or delete it
+func childObjectMeta(redis *v1alpha2.Redis, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: redis.Namespace,
+	}
+}
+
+// deleteUnusedChild deletes a child the spec doesn't ask for, if it exists.
+// Optional children are looked at on every resync, reading first saves a
+// failing delete each time.
+func deleteUnusedChild(object sdk.Object) error {
+	err := sdk.Get(object)
+	if errors.IsNotFound(err) {
+		return nil
 	}
 
-	svc := getServiceDefinition(redis)
-	err = sdk.Delete(svc)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	err = deleteChild(object)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+
+	return err
 }
 
-func createOrUpdateResources(r *v1alpha1.Redis) error {
+func createOrUpdateResources(r *v1alpha2.Redis) error {
 	err := createOrUpdateConfigMap(r)
 	if err != nil {
 		return err
 	}
 
-	err = createOrUpdateDeployment(r)
+	err = createOrUpdateAuthSecret(r)
+	if err != nil {
+		return err
+	}
+
+	err = createOrUpdateWorkload(r)
 	if err != nil {
 		return err
 	}
@@ -138,46 +335,50 @@ func createOrUpdateResources(r *v1alpha1.Redis) error {
 		return err
 	}
 
-	return nil
+	err = createOrUpdateSentinel(r)
+	if err != nil {
+		return err
+	}
+
+	return createOrUpdateMonitoring(r)
 }
 
-func createOrUpdateService(r *v1alpha1.Redis) error {
+func createOrUpdateService(r *v1alpha2.Redis) error {
 	redis := r.DeepCopy()
-	changed := redis.SetDefaults()
-
-	if changed {
-		svc := getServiceDefinition(redis)
-
-		err := sdk.Update(svc)
-
-		if errors.IsNotFound(err) {
-			err = sdk.Create(svc)
-		}
+	redis.SetDefaults()
 
-		if err != nil && errors.IsAlreadyExists(err) {
-			return err
-		}
+	_, err := reconcileObject(getServiceDefinition(redis))
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return createOrUpdateReadService(redis)
 }
 
-func getServiceDefinition(redis *v1alpha1.Redis) *corev1.Service {
+func getServiceDefinition(redis *v1alpha2.Redis) *corev1.Service {
 	labels := redisLabels(redis.Name)
-	return &corev1.Service{
+
+	// Only the master takes writes, the pods of a StatefulSet replicate the
+	// pod of the Deployment it replaces until they're promoted
+	if usesStatefulSet(redis) && !clusterEnabled(redis) {
+		labels[roleLabel] = roleMaster
+	}
+
+	svc := &corev1.Service{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
-			Kind: "Service",
+			Kind:       "Service",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: redis.Name,
-			Namespace: redis.Namespace,
-			Labels: genericObjectDefinitionLabels(),
+			Name:            redis.Name,
+			Namespace:       redis.Namespace,
+			Labels:          genericObjectDefinitionLabels(),
+			OwnerReferences: ownerReferences(redis),
 		},
 		Spec: corev1.ServiceSpec{
-			Type: "ClusterIP",
+			Type:            "ClusterIP",
 			SessionAffinity: "None",
-			Selector: labels,
+			Selector:        labels,
 			Ports: []corev1.ServicePort{
 				{
 					Name: "redis",
@@ -190,33 +391,25 @@ func getServiceDefinition(redis *v1alpha1.Redis) *corev1.Service {
 			},
 		},
 	}
+
+	addMonitoringToService(redis, svc)
+	return svc
 }
 
-func createOrUpdateConfigMap(r *v1alpha1.Redis) error {
+func createOrUpdateConfigMap(r *v1alpha2.Redis) error {
 	redis := r.DeepCopy()
-	changed := redis.SetDefaults()
-
-	if changed {
-		cm, err := getConfigMapDefinition(redis)
-		if err != nil {
-			return err
-		}
-
-		err = sdk.Update(cm)
-
-		if errors.IsNotFound(err) {
-			err = sdk.Create(cm)
-		}
+	redis.SetDefaults()
 
-		if err != nil && !errors.IsAlreadyExists(err) {
-			return err
-		}
+	cm, err := getConfigMapDefinition(redis)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	_, err = reconcileObject(cm)
+	return err
 }
 
-func getConfigMapDefinition(redis *v1alpha1.Redis) (*corev1.ConfigMap, error) {
+func getConfigMapDefinition(redis *v1alpha2.Redis) (*corev1.ConfigMap, error) {
 	redisConfigs, err := rConfig.ParseConfig(redis.Spec.DeepCopy())
 
 	if err != nil {
@@ -226,12 +419,13 @@ func getConfigMapDefinition(redis *v1alpha1.Redis) (*corev1.ConfigMap, error) {
 	rConfigMap := &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
-			Kind: "ConfigMap",
+			Kind:       "ConfigMap",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: redis.Name,
-			Namespace: redis.Namespace,
-			Labels: genericObjectDefinitionLabels(),
+			Name:            redis.Name,
+			Namespace:       redis.Namespace,
+			Labels:          genericObjectDefinitionLabels(),
+			OwnerReferences: ownerReferences(redis),
 		},
 		Data: map[string]string{
 			"redis.config": redisConfigs,
@@ -241,106 +435,171 @@ func getConfigMapDefinition(redis *v1alpha1.Redis) (*corev1.ConfigMap, error) {
 	return rConfigMap, nil
 }
 
-func createOrUpdateDeployment(r *v1alpha1.Redis) error {
+func createOrUpdateDeployment(r *v1alpha2.Redis) error {
 	redis := r.DeepCopy()
-	changed := redis.SetDefaults()
-	if changed {
-		deploy, err := getDeploymentDefinition(redis)
-		if err != nil {
-			return err
-		}
+	redis.SetDefaults()
 
-		err = sdk.Update(deploy)
+	deploy, err := getDeploymentDefinition(redis)
+	if err != nil {
+		return err
+	}
 
-		if errors.IsNotFound(err) {
-			err = sdk.Create(deploy)
-		}
+	err = setPasswordSecretHash(redis, &deploy.Spec.Template)
+	if err != nil {
+		return err
+	}
 
-		if err != nil && !errors.IsAlreadyExists(err) {
-			return err
-		}
+	live := &v1.Deployment{TypeMeta: deploymentTypeMeta, ObjectMeta: childObjectMeta(redis, redis.Name)}
+	err = sdk.Get(live)
+	if err == nil {
+		keepDerivedMemory(redis, &deploy.Spec.Template, &live.Spec.Template)
+		keepRuntimeConfig(&deploy.Spec.Template, &live.Spec.Template)
+	} else if !errors.IsNotFound(err) {
+		return err
 	}
 
-	return nil
-}
+	desired, err := withTopologySpread(redis, deploy)
+	if err != nil {
+		return err
+	}
 
+	drifted, err := reconcileObject(desired)
+	recordRollout(redis, deploy, drifted)
+	return err
+}
 
-func getDeploymentDefinition(redis *v1alpha1.Redis) (*v1.Deployment, error) {
+func getDeploymentDefinition(redis *v1alpha2.Redis) (*v1.Deployment, error) {
 	replicas := int32(1)
-	redisConfigs, err := rConfig.ParseConfig(redis.Spec.DeepCopy())
+	template, err := getPodTemplateDefinition(redis)
 
 	if err != nil {
 		return nil, err
 	}
 
-	configHash := getMd5(redisConfigs)
 	labels := getCombinedLabels(redis.Name)
 
 	return &v1.Deployment{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "apps/v1",
-			Kind: "Deployment",
+			Kind:       "Deployment",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: redis.Name,
-			Namespace: redis.Namespace,
-			Labels: labels,
+			Name:            redis.Name,
+			Namespace:       redis.Namespace,
+			Labels:          labels,
+			OwnerReferences: ownerReferences(redis),
 		},
 		Spec: v1.DeploymentSpec{
 			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-					Annotations: map[string]string{
-						"configmap/hash": configHash,
-					},
-				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{
-						{
-							Name: "redis-config",
-							VolumeSource: corev1.VolumeSource{
-								ConfigMap: &corev1.ConfigMapVolumeSource{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: redis.Name,
-									},
-									Items: []corev1.KeyToPath{
-										{
-											Key: "redis.config",
-											Path: "redis.conf",
-										},
-									},
-								},
-							},
-						},
-					},
-					Containers: []corev1.Container{
-						{
-							Image: redis.Spec.Image,
-							Name: redis.Name,
-							Command: []string{
-								"redis-server",
-								"/usr/local/etc/redis/redis.conf",
-							},
-							Ports: []corev1.ContainerPort{
-								{
-									ContainerPort: redis.Spec.Port,
-									Name: "redis",
-								},
+			Template: *template,
+		},
+	}, nil
+}
+
+// getPodTemplateDefinition is the redis pod shared by the Deployment and the StatefulSet
+func getPodTemplateDefinition(redis *v1alpha2.Redis) (*corev1.PodTemplateSpec, error) {
+	// directives CONFIG SET can change are hot applied, only the others
+	// roll the pods
+	restartConfig, err := rConfig.ParseRestartConfig(redis.Spec.DeepCopy())
+
+	if err != nil {
+		return nil, err
+	}
+
+	configHash := getMd5(restartConfig)
+	_, runtimeSettings, err := runtimeConfig(redis)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := getCombinedLabels(redis.Name)
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      "redis-config",
+			MountPath: "/usr/local/etc/redis/",
+		},
+	}
+
+	if redis.Spec.Persistence != nil {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      dataVolumeName,
+			MountPath: dataDir,
+		})
+	}
+
+	ports := []corev1.ContainerPort{
+		{
+			ContainerPort: redis.Spec.Port,
+			Name:          "redis",
+		},
+	}
+
+	if clusterEnabled(redis) {
+		ports = append(ports, corev1.ContainerPort{
+			ContainerPort: redis.Spec.Port + clusterBusPortOffset,
+			Name:          "cluster-bus",
+		})
+	}
+
+	livenessProbe, readinessProbe := getRedisProbes(redis)
+	secretVolumes, secretVolumeMounts := authVolumes(redis)
+
+	containers := []corev1.Container{
+		{
+			Image: redis.Spec.Image,
+			Name:  redis.Name,
+			Command: append([]string{
+				"redis-server",
+				"/usr/local/etc/redis/redis.conf",
+			}, authArgs(redis)...),
+			Env:            passwordEnv(redis),
+			Ports:          ports,
+			VolumeMounts:   append(volumeMounts, secretVolumeMounts...),
+			Resources:      getRedisResources(redis),
+			LivenessProbe:  livenessProbe,
+			ReadinessProbe: readinessProbe,
+		},
+	}
+
+	if monitoringEnabled(redis) {
+		containers = append(containers, getExporterContainer(redis))
+	}
+
+	return &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: labels,
+			Annotations: map[string]string{
+				"configmap/hash":        configHash,
+				runtimeConfigAnnotation: runtimeSettings,
+			},
+		},
+		Spec: corev1.PodSpec{
+			Volumes: append([]corev1.Volume{
+				{
+					Name: "redis-config",
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: redis.Name,
 							},
-							VolumeMounts: []corev1.VolumeMount{
+							Items: []corev1.KeyToPath{
 								{
-									Name: "redis-config",
-									MountPath: "/usr/local/etc/redis/",
+									Key:  "redis.config",
+									Path: "redis.conf",
 								},
 							},
 						},
 					},
 				},
-			},
+			}, secretVolumes...),
+			Containers:        containers,
+			NodeSelector:      redis.Spec.Scheduling.NodeSelector,
+			Tolerations:       redis.Spec.Scheduling.Tolerations,
+			Affinity:          getRedisAffinity(redis),
+			PriorityClassName: redis.Spec.Scheduling.PriorityClassName,
 		},
 	}, nil
-}
\ No newline at end of file
+}
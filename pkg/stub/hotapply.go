@@ -0,0 +1,232 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	rConfig "github.com/flexshopper/redis-operator/pkg/config"
+	"github.com/flexshopper/redis-operator/pkg/redisclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// runtimeConfigAnnotation holds the runtime settings a pod runs with. The
+// pod template is stamped with the ones it was built from, which the pods
+// inherit, and the pods are stamped again once others are applied to them.
+const runtimeConfigAnnotation = "cache.flexshopper.com/runtime-config"
+
+// runtimeConfig is the value of runtimeConfigAnnotation for the spec
+func runtimeConfig(redis *v1alpha2.Redis) (map[string]string, string, error) {
+	settings, err := rConfig.RuntimeSettings(redis.Spec.DeepCopy())
+	if err != nil {
+		return nil, "", err
+	}
+
+	// map keys are sorted, the annotation is stable
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return settings, string(raw), nil
+}
+
+// keepRuntimeConfig keeps the runtime settings stamped on the live template
+// when nothing else of the template changed, new runtime settings are hot
+// applied and restamping them would restart every pod. A template from
+// before the stamp stays unstamped until it's rolled for another change.
+func keepRuntimeConfig(template, live *corev1.PodTemplateSpec) {
+	kept := withLiveRuntimeConfig(template, live)
+
+	keptMap, err := toMap(kept)
+	if err != nil {
+		return
+	}
+
+	liveMap, err := toMap(live)
+	if err != nil {
+		return
+	}
+
+	var drifted []string
+	if len(diffMaps(nil, keptMap, liveMap, "", &drifted)) > 0 {
+		return
+	}
+
+	*template = *kept
+}
+
+// withLiveRuntimeConfig is template with the runtime settings of live
+func withLiveRuntimeConfig(template, live *corev1.PodTemplateSpec) *corev1.PodTemplateSpec {
+	kept := template.DeepCopy()
+	if current, ok := live.Annotations[runtimeConfigAnnotation]; ok {
+		kept.Annotations[runtimeConfigAnnotation] = current
+	} else {
+		delete(kept.Annotations, runtimeConfigAnnotation)
+	}
+
+	return kept
+}
+
+// hotApplyConfig applies the runtime settings that changed since a pod last
+// got them with CONFIG SET and returns what was applied. A pod without the
+// annotation predates the template stamp, it gets every setting.
+func hotApplyConfig(r *v1alpha2.Redis) (map[string]string, error) {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	settings, desired, err := runtimeConfig(redis)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := getPassword(redis)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := listRedisPods(redis)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[string]string{}
+	var errs []error
+
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		current := pod.Annotations[runtimeConfigAnnotation]
+		if current == desired {
+			continue
+		}
+
+		changed, err := applySettings(redis, password, pod, current, settings)
+		for name, value := range changed {
+			applied[name] = value
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		err = setRuntimeConfigAnnotation(pod, desired)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return applied, utilerrors.NewAggregate(errs)
+}
+
+func applySettings(redis *v1alpha2.Redis, password string, pod *corev1.Pod, current string,
+	settings map[string]string) (map[string]string, error) {
+	previous := map[string]string{}
+	err := json.Unmarshal([]byte(current), &previous)
+	if err != nil && current != "" {
+		logrus.Warnf("ignoring malformed %s of %s/%s: %v", runtimeConfigAnnotation, pod.Namespace, pod.Name, err)
+	}
+
+	var names []string
+	for name, value := range settings {
+		if previous[name] != value {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	node := &redisNode{pod: pod}
+	client, err := redisclient.Dial(node.addr(redis.Spec.Port), password)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	changed := map[string]string{}
+	var errs []error
+	for _, name := range names {
+		logrus.Infof("setting %s to %q on redis pod %s/%s", name, settings[name], pod.Namespace, pod.Name)
+		_, err = client.Do("CONFIG", "SET", name, settings[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to set %s on %s: %v", name, pod.Name, err))
+			continue
+		}
+
+		changed[name] = settings[name]
+	}
+
+	return changed, utilerrors.NewAggregate(errs)
+}
+
+func setRuntimeConfigAnnotation(pod *corev1.Pod, value string) error {
+	pod.TypeMeta = metav1.TypeMeta{
+		APIVersion: "v1",
+		Kind:       "Pod",
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{runtimeConfigAnnotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = sdk.Patch(pod, types.MergePatchType, patch)
+	observeAPICall(pod, "patch", err)
+	return err
+}
+
+// setHotAppliedConfig records the directives applied in status, keeping
+// the ones applied earlier
+func setHotAppliedConfig(status *v1alpha2.RedisStatus, applied map[string]string) {
+	now := metav1.Now()
+	for name, value := range applied {
+		found := false
+		for i := range status.HotAppliedConfig {
+			directive := &status.HotAppliedConfig[i]
+			if directive.Name == name {
+				directive.Value = value
+				directive.LastAppliedTime = now
+				found = true
+			}
+		}
+
+		if !found {
+			status.HotAppliedConfig = append(status.HotAppliedConfig, v1alpha2.RedisHotAppliedDirective{
+				Name:            name,
+				Value:           value,
+				LastAppliedTime: now,
+			})
+		}
+	}
+
+	sort.Slice(status.HotAppliedConfig, func(i, j int) bool {
+		return status.HotAppliedConfig[i].Name < status.HotAppliedConfig[j].Name
+	})
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
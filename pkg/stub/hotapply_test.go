@@ -0,0 +1,141 @@
+package stub
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+)
+
+func TestKeepRuntimeConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*v1alpha2.Redis)
+		// kept is whether the live template stays as it is
+		kept bool
+	}{
+		{
+			name: "unchanged",
+			kept: true,
+		},
+		{
+			name: "runtime settings",
+			mutate: func(redis *v1alpha2.Redis) {
+				redis.Spec.MaxMemoryEvictionPolicy = "volatile-lru"
+				redis.Spec.Config = map[string]string{"slowlog-log-slower-than": "1000"}
+			},
+			kept: true,
+		},
+		{
+			name: "hot applied maxMemory",
+			mutate: func(redis *v1alpha2.Redis) {
+				redis.Spec.MaxMemory = "1mb"
+			},
+			kept: true,
+		},
+		{
+			name: "runtime settings along with a restart",
+			mutate: func(redis *v1alpha2.Redis) {
+				redis.Spec.MaxMemoryEvictionPolicy = "volatile-lru"
+				redis.Spec.Image = "redis:5-alpine"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		live := testRedis()
+		liveTemplate, err := getPodTemplateDefinition(live)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		redis := testRedis()
+		if test.mutate != nil {
+			test.mutate(redis)
+		}
+
+		template, err := getPodTemplateDefinition(redis)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keepDerivedMemory(redis, template, liveTemplate)
+		keepRuntimeConfig(template, liveTemplate)
+
+		if kept := reflect.DeepEqual(template, liveTemplate); kept != test.kept {
+			t.Errorf("%s: kept the live template %v, want %v", test.name, kept, test.kept)
+		}
+
+		_, settings, err := runtimeConfig(redis)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a template rolled anyway is stamped with the settings it's built from
+		if !test.kept && template.Annotations[runtimeConfigAnnotation] != settings {
+			t.Errorf("%s: got runtime settings %s, want %s", test.name, template.Annotations[runtimeConfigAnnotation], settings)
+		}
+	}
+}
+
+func TestKeepRuntimeConfigUnstamped(t *testing.T) {
+	redis := testRedis()
+	liveTemplate, err := getPodTemplateDefinition(redis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(liveTemplate.Annotations, runtimeConfigAnnotation)
+
+	template, err := getPodTemplateDefinition(redis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keepRuntimeConfig(template, liveTemplate)
+	if !reflect.DeepEqual(template, liveTemplate) {
+		t.Errorf("a template from before the runtime settings stamp got stamped")
+	}
+
+	redis.Spec.Image = "redis:5-alpine"
+	template, err = getPodTemplateDefinition(redis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keepRuntimeConfig(template, liveTemplate)
+	if _, ok := template.Annotations[runtimeConfigAnnotation]; !ok {
+		t.Errorf("a template rolled for another change isn't stamped")
+	}
+}
+
+func TestRuntimeConfigAnnotation(t *testing.T) {
+	redis := testRedis()
+	redis.Spec.Config = map[string]string{"min-replicas-to-write": "1"}
+
+	settings, raw, err := runtimeConfig(redis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stamped map[string]string
+	if err = json.Unmarshal([]byte(raw), &stamped); err != nil || !reflect.DeepEqual(stamped, settings) {
+		t.Errorf("got annotation %s, want %v", raw, settings)
+	}
+
+	template, err := getPodTemplateDefinition(redis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if template.Annotations[runtimeConfigAnnotation] != raw {
+		t.Errorf("got template stamped with %s, want %s", template.Annotations[runtimeConfigAnnotation], raw)
+	}
+
+	// the settings come out the same every time, or the pods would roll
+	for i := 0; i < 10; i++ {
+		if _, again, _ := runtimeConfig(redis); again != raw {
+			t.Fatalf("got %s, then %s", raw, again)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package stub
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/flexshopper/redis-operator/pkg/redisclient"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// infoPollInterval is how often status.instances is refreshed, polling on
+// every resync would run INFO against every pod every few seconds
+const infoPollInterval = 30 * time.Second
+
+// startTimeSlack is how far apart two start times worked out from
+// uptime_in_seconds may be and still be taken for the same start, uptime is
+// in whole seconds and read a moment after the poll began
+const startTimeSlack = 2 * time.Second
+
+// infoPoller runs INFO against the pods of every Redis, at most once per
+// interval for each of them
+type infoPoller struct {
+	dial     redisclient.Dialer
+	interval time.Duration
+
+	mu       sync.Mutex
+	lastPoll map[string]time.Time
+}
+
+func newInfoPoller(dial redisclient.Dialer, interval time.Duration) *infoPoller {
+	return &infoPoller{
+		dial:     dial,
+		interval: interval,
+		lastPoll: map[string]time.Time{},
+	}
+}
+
+// due tells whether the instances of a Redis should be polled again, it
+// records the poll when they should. The poll time is kept out of status so
+// that the status only changes with the figures, after a restart of the
+// operator every Redis is polled right away.
+func (p *infoPoller) due(redis *v1alpha2.Redis) bool {
+	key := redis.Namespace + "/" + redis.Name
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.lastPoll[key]) < p.interval {
+		return false
+	}
+
+	p.lastPoll[key] = now
+	return true
+}
+
+func (p *infoPoller) forget(redis *v1alpha2.Redis) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.lastPoll, redis.Namespace+"/"+redis.Name)
+}
+
+// poll reads INFO from every running redis pod. A pod that can't be polled
+// keeps its previous figures along with the error, pods that are gone are
+// dropped.
+func (p *infoPoller) poll(r *v1alpha2.Redis, previous []v1alpha2.RedisInstanceStatus) ([]v1alpha2.RedisInstanceStatus, error) {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	password, err := getPassword(redis)
+	if err != nil {
+		return previous, err
+	}
+
+	pods, err := listRedisPods(redis)
+	if err != nil {
+		return previous, err
+	}
+
+	byName := map[string]v1alpha2.RedisInstanceStatus{}
+	for _, instance := range previous {
+		byName[instance.Name] = instance
+	}
+
+	var instances []v1alpha2.RedisInstanceStatus
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		instance, err := p.pollPod(redis, password, pod, byName[pod.Name])
+		if err != nil {
+			instance = byName[pod.Name]
+			instance.Name = pod.Name
+			instance.Error = err.Error()
+		}
+
+		instances = append(instances, instance)
+	}
+
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+	return instances, nil
+}
+
+func (p *infoPoller) pollPod(redis *v1alpha2.Redis, password string, pod *corev1.Pod, previous v1alpha2.RedisInstanceStatus) (v1alpha2.RedisInstanceStatus, error) {
+	node := &redisNode{pod: pod}
+	client, err := p.dial(node.addr(redis.Spec.Port), password)
+	if err != nil {
+		return v1alpha2.RedisInstanceStatus{}, err
+	}
+	defer client.Close()
+
+	// the default sections cover server, clients, memory, persistence,
+	// stats and replication
+	info, err := client.Info("default")
+	if err != nil {
+		return v1alpha2.RedisInstanceStatus{}, err
+	}
+
+	return instanceStatus(pod.Name, info, previous, time.Now()), nil
+}
+
+// instanceStatus picks the figures reported in status out of INFO read at
+// now. The start time of previous is kept unless redis restarted since.
+func instanceStatus(name string, info map[string]string, previous v1alpha2.RedisInstanceStatus, now time.Time) v1alpha2.RedisInstanceStatus {
+	integer := func(key string) int64 {
+		value, _ := strconv.ParseInt(info[key], 10, 64)
+		return value
+	}
+
+	startTime := metav1.NewTime(now.Add(-time.Duration(integer("uptime_in_seconds")) * time.Second).Truncate(time.Second))
+	if !previous.StartTime.IsZero() {
+		drift := startTime.Sub(previous.StartTime.Time)
+		if drift < startTimeSlack && drift > -startTimeSlack {
+			startTime = previous.StartTime
+		}
+	}
+
+	return v1alpha2.RedisInstanceStatus{
+		Name:             name,
+		RedisVersion:     info["redis_version"],
+		Role:             info["role"],
+		UsedMemory:       integer("used_memory"),
+		MaxMemory:        integer("maxmemory"),
+		ConnectedClients: integer("connected_clients"),
+		EvictedKeys:      integer("evicted_keys"),
+		KeyspaceHits:     integer("keyspace_hits"),
+		KeyspaceMisses:   integer("keyspace_misses"),
+		LastBgsaveStatus: info["rdb_last_bgsave_status"],
+		StartTime:        startTime,
+	}
+}
+
+// pollInstances refreshes status.instances when they're due
+func (h *Handler) pollInstances(redis *v1alpha2.Redis, status *v1alpha2.RedisStatus) error {
+	if !h.infoPoller.due(redis) {
+		return nil
+	}
+
+	instances, err := h.infoPoller.poll(redis, status.Instances)
+	status.Instances = instances
+	return err
+}
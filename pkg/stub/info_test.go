@@ -0,0 +1,79 @@
+package stub
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/flexshopper/redis-operator/pkg/redisclient"
+	"github.com/flexshopper/redis-operator/pkg/redisclient/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInstanceStatus(t *testing.T) {
+	server, err := fake.NewServer("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.SetInfo("server", "redis_version", "5.0.7")
+	server.SetInfo("server", "uptime_in_seconds", "100")
+	server.SetInfo("replication", "role", "master")
+	server.SetInfo("memory", "used_memory", "1048576")
+	server.SetInfo("memory", "maxmemory", "104857600")
+	server.SetInfo("clients", "connected_clients", "3")
+	server.SetInfo("stats", "evicted_keys", "7")
+	server.SetInfo("stats", "keyspace_hits", "40")
+	server.SetInfo("stats", "keyspace_misses", "2")
+	server.SetInfo("persistence", "rdb_last_bgsave_status", "ok")
+
+	poll := func() map[string]string {
+		client, err := redisclient.DefaultDialer(server.Addr(), "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		info, err := client.Info("default")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return info
+	}
+
+	now := time.Date(2020, 1, 1, 12, 0, 0, 500000000, time.UTC)
+	first := instanceStatus("cache-0", poll(), v1alpha2.RedisInstanceStatus{}, now)
+
+	want := v1alpha2.RedisInstanceStatus{
+		Name:             "cache-0",
+		RedisVersion:     "5.0.7",
+		Role:             "master",
+		UsedMemory:       1048576,
+		MaxMemory:        104857600,
+		ConnectedClients: 3,
+		EvictedKeys:      7,
+		KeyspaceHits:     40,
+		KeyspaceMisses:   2,
+		LastBgsaveStatus: "ok",
+		StartTime:        metav1.NewTime(time.Date(2020, 1, 1, 11, 58, 20, 0, time.UTC)),
+	}
+	if !reflect.DeepEqual(first, want) {
+		t.Fatalf("got %+v, want %+v", first, want)
+	}
+
+	// a poll a moment later than the uptime suggests reports the same status
+	server.SetInfo("server", "uptime_in_seconds", "130")
+	second := instanceStatus("cache-0", poll(), first, now.Add(31*time.Second))
+	if !reflect.DeepEqual(second, first) {
+		t.Errorf("unchanged instance: got %+v, want %+v", second, first)
+	}
+
+	server.SetInfo("server", "uptime_in_seconds", "5")
+	restarted := instanceStatus("cache-0", poll(), second, now.Add(60*time.Second))
+	if want := now.Add(55 * time.Second).Truncate(time.Second); !restarted.StartTime.Time.Equal(want) {
+		t.Errorf("restarted instance: got start time %v, want %v", restarted.StartTime, want)
+	}
+}
@@ -0,0 +1,184 @@
+package stub
+
+import (
+	"time"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The metrics are served by sdk.ExposeMetricsPort along with the ones of the
+// sdk, every series is labelled with the namespace and name of the Redis
+const metricsNamespace = "redis_operator"
+
+const (
+	reconcileSucceeded = "success"
+	reconcileFailed    = "error"
+	reconcileInvalid   = "invalid"
+)
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_total",
+		Help:      "Reconciles of a Redis by result: success, error or invalid.",
+	}, []string{"namespace", "name", "result"})
+
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Time spent reconciling a Redis by result.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"namespace", "name", "result"})
+
+	validationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "validation_failures_total",
+		Help:      "Validation errors found in a Redis spec by rule.",
+	}, []string{"namespace", "name", "rule"})
+
+	redisConditions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "redis_condition",
+		Help:      "1 for the current status of each condition of a Redis, 0 for the others.",
+	}, []string{"namespace", "name", "condition", "status"})
+
+	childOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "child_operations_total",
+		Help:      "Create, update and delete calls made for the children of a Redis by kind.",
+	}, []string{"namespace", "name", "kind", "operation"})
+
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_errors_total",
+		Help:      "Failed calls to the API server on behalf of a Redis by kind and operation.",
+	}, []string{"namespace", "name", "kind", "operation"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		reconcileTotal,
+		reconcileDuration,
+		validationFailures,
+		redisConditions,
+		childOperations,
+		apiErrors,
+	)
+}
+
+var conditionStatuses = []corev1.ConditionStatus{
+	corev1.ConditionTrue,
+	corev1.ConditionFalse,
+	corev1.ConditionUnknown,
+}
+
+// observeReconcile records a reconcile of redis that took since start, an
+// error overrides the result
+func observeReconcile(redis *v1alpha2.Redis, result string, start time.Time, err error) {
+	if err != nil {
+		result = reconcileFailed
+	}
+
+	reconcileTotal.WithLabelValues(redis.Namespace, redis.Name, result).Inc()
+	reconcileDuration.WithLabelValues(redis.Namespace, redis.Name, result).Observe(time.Since(start).Seconds())
+	setConditionMetrics(redis)
+}
+
+func setConditionMetrics(redis *v1alpha2.Redis) {
+	for _, condition := range redis.Status.Conditions {
+		for _, status := range conditionStatuses {
+			value := 0.0
+			if condition.Status == status {
+				value = 1
+			}
+
+			redisConditions.WithLabelValues(redis.Namespace, redis.Name, string(condition.Type), string(status)).Set(value)
+		}
+	}
+}
+
+// forgetConditionMetrics drops the gauges of a Redis that is gone
+func forgetConditionMetrics(redis *v1alpha2.Redis) {
+	for _, conditionType := range []v1alpha2.RedisConditionType{
+		v1alpha2.RedisConfigValid,
+		v1alpha2.RedisPolicyCompliant,
+		v1alpha2.RedisResourcesCreated,
+		v1alpha2.RedisDeploymentAvailable,
+		v1alpha2.RedisReady,
+	} {
+		for _, status := range conditionStatuses {
+			redisConditions.DeleteLabelValues(redis.Namespace, redis.Name, string(conditionType), string(status))
+		}
+	}
+}
+
+func observeValidationFailures(redis *v1alpha2.Redis, rule string, count int) {
+	if count > 0 {
+		validationFailures.WithLabelValues(redis.Namespace, redis.Name, rule).Add(float64(count))
+	}
+}
+
+// owningRedis is the namespace and name of the Redis an object belongs to:
+// its controller when that's a Redis, otherwise the object itself
+func owningRedis(object sdk.Object) (string, string) {
+	accessor, ok := object.(metav1.Object)
+	if !ok {
+		return "", ""
+	}
+
+	if ref := metav1.GetControllerOf(accessor); ref != nil && ref.Kind == "Redis" {
+		return accessor.GetNamespace(), ref.Name
+	}
+
+	// pods are owned by the workload, they carry the name of the Redis
+	if name, ok := accessor.GetLabels()["lru-cache"]; ok {
+		return accessor.GetNamespace(), name
+	}
+
+	return accessor.GetNamespace(), accessor.GetName()
+}
+
+// observeAPICall counts a failed call to the API server, objects already
+// gone aren't failures
+func observeAPICall(object sdk.Object, operation string, err error) {
+	if err == nil || errors.IsNotFound(err) {
+		return
+	}
+
+	namespace, name := owningRedis(object)
+	apiErrors.WithLabelValues(namespace, name, object.GetObjectKind().GroupVersionKind().Kind, operation).Inc()
+	recordAPIError(object, operation, err)
+}
+
+func observeChildOperation(object sdk.Object, operation string, err error) {
+	namespace, name := owningRedis(object)
+	childOperations.WithLabelValues(namespace, name, object.GetObjectKind().GroupVersionKind().Kind, operation).Inc()
+	observeAPICall(object, operation, err)
+	recordChildOperation(object, operation, err)
+}
+
+// createChild creates a child of a Redis through sdk, counting the call
+func createChild(object sdk.Object) error {
+	err := sdk.Create(object)
+	observeChildOperation(object, "create", err)
+	return err
+}
+
+// deleteChild deletes a child of a Redis through sdk, counting the call
+func deleteChild(object sdk.Object, opts ...sdk.DeleteOption) error {
+	err := sdk.Delete(object, opts...)
+	observeChildOperation(object, "delete", err)
+	return err
+}
+
+// updateObject updates the Redis itself, only failures are counted
+func updateObject(object sdk.Object) error {
+	err := sdk.Update(object)
+	observeAPICall(object, "update", err)
+	return err
+}
@@ -0,0 +1,157 @@
+package stub
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func metricValue(t *testing.T, metric prometheus.Metric) float64 {
+	m := &dto.Metric{}
+	err := metric.Write(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switch {
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	case m.Histogram != nil:
+		return float64(m.Histogram.GetSampleCount())
+	}
+
+	t.Fatalf("unexpected metric %v", m)
+	return 0
+}
+
+func TestObserveReconcile(t *testing.T) {
+	redis := testRedis()
+	redis.Name = "metrics-reconcile"
+
+	observeReconcile(redis, reconcileSucceeded, time.Now(), nil)
+	observeReconcile(redis, reconcileSucceeded, time.Now(), fmt.Errorf("failed"))
+	observeReconcile(redis, reconcileInvalid, time.Now(), nil)
+
+	for _, result := range []string{reconcileSucceeded, reconcileFailed, reconcileInvalid} {
+		if got := metricValue(t, reconcileTotal.WithLabelValues("default", redis.Name, result)); got != 1 {
+			t.Errorf("%s: got %v reconciles, want 1", result, got)
+		}
+
+		duration := reconcileDuration.WithLabelValues("default", redis.Name, result).(prometheus.Metric)
+		if got := metricValue(t, duration); got != 1 {
+			t.Errorf("%s: got %v durations, want 1", result, got)
+		}
+	}
+}
+
+func TestConditionMetrics(t *testing.T) {
+	redis := testRedis()
+	redis.Name = "metrics-conditions"
+	setCondition(&redis.Status, 1, v1alpha2.RedisReady, corev1.ConditionFalse, "", "")
+	setCondition(&redis.Status, 1, v1alpha2.RedisConfigValid, corev1.ConditionTrue, "", "")
+
+	setConditionMetrics(redis)
+
+	want := map[v1alpha2.RedisConditionType]corev1.ConditionStatus{
+		v1alpha2.RedisReady:       corev1.ConditionFalse,
+		v1alpha2.RedisConfigValid: corev1.ConditionTrue,
+	}
+
+	for conditionType, current := range want {
+		for _, status := range conditionStatuses {
+			value := 0.0
+			if status == current {
+				value = 1
+			}
+
+			gauge := redisConditions.WithLabelValues("default", redis.Name, string(conditionType), string(status))
+			if got := metricValue(t, gauge); got != value {
+				t.Errorf("%s %s: got %v, want %v", conditionType, status, got, value)
+			}
+		}
+	}
+
+	forgetConditionMetrics(redis)
+	if redisConditions.DeleteLabelValues("default", redis.Name, string(v1alpha2.RedisReady), string(corev1.ConditionFalse)) {
+		t.Errorf("the gauges of a deleted Redis are still exported")
+	}
+}
+
+func TestObserveAPICall(t *testing.T) {
+	defer func(r *eventRecorder) {
+		recorder = r
+	}(recorder)
+	recorder = newFakeEventRecorder().eventRecorder
+
+	redis := testRedis()
+	redis.Name = "metrics-api"
+
+	pod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "metrics-api-0",
+			Namespace: "default",
+			Labels:    map[string]string{"lru-cache": redis.Name},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		object sdk.Object
+		err    error
+		// kind is the kind label of the counted failure, empty when none is
+		kind string
+	}{
+		{name: "success", object: pod},
+		{name: "not found", object: pod, err: errors.NewNotFound(schema.GroupResource{Resource: "pods"}, pod.Name)},
+		{name: "failure on a pod", object: pod, err: fmt.Errorf("conflict"), kind: "Pod"},
+		{name: "failure on the Redis", object: redis, err: fmt.Errorf("conflict"), kind: "Redis"},
+	}
+
+	for _, test := range tests {
+		counted := map[string]float64{}
+		for _, kind := range []string{"Pod", "Redis"} {
+			counted[kind] = metricValue(t, apiErrors.WithLabelValues("default", redis.Name, kind, "patch"))
+		}
+
+		observeAPICall(test.object, "patch", test.err)
+
+		// failures are counted for the Redis the object belongs to
+		for kind, before := range counted {
+			want := before
+			if kind == test.kind {
+				want++
+			}
+
+			if got := metricValue(t, apiErrors.WithLabelValues("default", redis.Name, kind, "patch")); got != want {
+				t.Errorf("%s: got %v %s failures, want %v", test.name, got, kind, want)
+			}
+		}
+	}
+}
+
+func TestObserveValidationFailures(t *testing.T) {
+	redis := testRedis()
+	redis.Name = "metrics-validation"
+
+	observeValidationFailures(redis, "maxMemory", 0)
+	if validationFailures.DeleteLabelValues("default", redis.Name, "maxMemory") {
+		t.Errorf("a rule without failures got a series")
+	}
+
+	observeValidationFailures(redis, "maxMemory", 2)
+	if got := metricValue(t, validationFailures.WithLabelValues("default", redis.Name, "maxMemory")); got != 2 {
+		t.Errorf("got %v failures, want 2", got)
+	}
+}
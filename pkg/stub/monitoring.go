@@ -0,0 +1,303 @@
+package stub
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	exporterContainerName = "redis-exporter"
+	metricsPortName       = "metrics"
+	// metricsLabel marks the Services the ServiceMonitor of a Redis selects
+	metricsLabel = "cache.flexshopper.com/metrics"
+
+	monitoringAPIVersion = "monitoring.coreos.com/v1"
+	// monitoringAPICheckInterval is how long the presence of the prometheus
+	// operator CRDs is cached
+	monitoringAPICheckInterval = 5 * time.Minute
+)
+
+func monitoringEnabled(redis *v1alpha2.Redis) bool {
+	return redis.Spec.Monitoring != nil
+}
+
+// getExporterContainer is the redis_exporter sidecar, it reaches redis over
+// localhost and shares the REDIS_PASSWORD env of the redis container
+func getExporterContainer(redis *v1alpha2.Redis) corev1.Container {
+	monitoring := redis.Spec.Monitoring
+
+	env := []corev1.EnvVar{
+		{
+			Name:  "REDIS_ADDR",
+			Value: fmt.Sprintf("redis://localhost:%d", redis.Spec.Port),
+		},
+	}
+
+	return corev1.Container{
+		Name:  exporterContainerName,
+		Image: monitoring.Image,
+		Args: []string{
+			"-web.listen-address",
+			fmt.Sprintf(":%d", monitoring.Port),
+		},
+		Env: append(env, passwordEnv(redis)...),
+		Ports: []corev1.ContainerPort{
+			{
+				ContainerPort: monitoring.Port,
+				Name:          metricsPortName,
+			},
+		},
+	}
+}
+
+// addMonitoringToService exposes the exporter port and labels the Service
+// for the ServiceMonitor
+func addMonitoringToService(redis *v1alpha2.Redis, svc *corev1.Service) {
+	if !monitoringEnabled(redis) {
+		return
+	}
+
+	svc.Labels[metricsLabel] = redis.Name
+	svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+		Name:       metricsPortName,
+		Port:       redis.Spec.Monitoring.Port,
+		TargetPort: intstr.FromString(metricsPortName),
+		Protocol:   "TCP",
+	})
+}
+
+// validateMonitoring makes sure the exporter fits next to redis
+func validateMonitoring(r *v1alpha2.Redis) []string {
+	if !monitoringEnabled(r) {
+		return nil
+	}
+
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+	monitoring := redis.Spec.Monitoring
+
+	var validationErrors []string
+
+	if monitoring.Port == redis.Spec.Port ||
+		(clusterEnabled(redis) && monitoring.Port == redis.Spec.Port+clusterBusPortOffset) {
+		validationErrors = append(validationErrors,
+			fmt.Sprintf("monitoring port ( %d ) is already used by redis", monitoring.Port))
+	}
+
+	if _, err := time.ParseDuration(monitoring.Interval); err != nil {
+		validationErrors = append(validationErrors,
+			fmt.Sprintf("monitoring interval ( %s ) is not a duration", monitoring.Interval))
+	}
+
+	return validationErrors
+}
+
+// monitoringAPI tells whether the prometheus operator CRDs are installed,
+// the answer is cached as discovery is too slow to query on every resync
+var monitoringAPI struct {
+	sync.Mutex
+	available bool
+	checked   time.Time
+}
+
+func monitoringAPIAvailable() (bool, error) {
+	monitoringAPI.Lock()
+	defer monitoringAPI.Unlock()
+
+	if time.Since(monitoringAPI.checked) < monitoringAPICheckInterval {
+		return monitoringAPI.available, nil
+	}
+
+	_, err := k8sclient.GetKubeClient().Discovery().ServerResourcesForGroupVersion(monitoringAPIVersion)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	available := err == nil
+	if available != monitoringAPI.available {
+		logrus.Infof("%s available: %t", monitoringAPIVersion, available)
+	}
+
+	monitoringAPI.available = available
+	monitoringAPI.checked = time.Now()
+	return available, nil
+}
+
+// createOrUpdateMonitoring keeps the ServiceMonitor and PrometheusRule in
+// line with spec.monitoring, nothing is done without the prometheus operator
+func createOrUpdateMonitoring(r *v1alpha2.Redis) error {
+	available, err := monitoringAPIAvailable()
+	if err != nil || !available {
+		return err
+	}
+
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	serviceMonitor := getServiceMonitorDefinition(redis)
+	prometheusRule := getPrometheusRuleDefinition(redis)
+
+	if !monitoringEnabled(redis) {
+		return deleteMonitoring(serviceMonitor, prometheusRule)
+	}
+
+	_, err = reconcileObject(serviceMonitor)
+	if err != nil {
+		return err
+	}
+
+	if !redis.Spec.Monitoring.Rules {
+		return deleteMonitoring(prometheusRule)
+	}
+
+	_, err = reconcileObject(prometheusRule)
+	return err
+}
+
+// deleteMonitoringResources removes the prometheus operator objects of a
+// Redis, if the prometheus operator is installed
+func deleteMonitoringResources(redis *v1alpha2.Redis) error {
+	available, err := monitoringAPIAvailable()
+	if err != nil || !available {
+		return err
+	}
+
+	return deleteMonitoring(getMonitoringObject(redis, "ServiceMonitor"), getMonitoringObject(redis, "PrometheusRule"))
+}
+
+func deleteMonitoring(objects ...sdk.Object) error {
+	for _, object := range objects {
+		err := deleteUnusedChild(object)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getMonitoringObject(redis *v1alpha2.Redis, kind string) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion(monitoringAPIVersion)
+	object.SetKind(kind)
+	object.SetName(redis.Name)
+	object.SetNamespace(redis.Namespace)
+	object.SetOwnerReferences(ownerReferences(redis))
+
+	labels := genericObjectDefinitionLabels()
+	if monitoringEnabled(redis) {
+		for k, v := range redis.Spec.Monitoring.Labels {
+			labels[k] = v
+		}
+	}
+	object.SetLabels(labels)
+
+	return object
+}
+
+func getServiceMonitorDefinition(redis *v1alpha2.Redis) *unstructured.Unstructured {
+	serviceMonitor := getMonitoringObject(redis, "ServiceMonitor")
+	if !monitoringEnabled(redis) {
+		return serviceMonitor
+	}
+
+	serviceMonitor.Object["spec"] = map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{
+				metricsLabel: redis.Name,
+			},
+		},
+		"namespaceSelector": map[string]interface{}{
+			"matchNames": []interface{}{redis.Namespace},
+		},
+		"endpoints": []interface{}{
+			map[string]interface{}{
+				"port":     metricsPortName,
+				"interval": redis.Spec.Monitoring.Interval,
+			},
+		},
+	}
+
+	return serviceMonitor
+}
+
+// getPrometheusRuleDefinition holds the default alerts, scoped to the
+// Services of the Redis
+func getPrometheusRuleDefinition(redis *v1alpha2.Redis) *unstructured.Unstructured {
+	prometheusRule := getMonitoringObject(redis, "PrometheusRule")
+	if !monitoringEnabled(redis) {
+		return prometheusRule
+	}
+
+	selector := fmt.Sprintf(`namespace=%q,service=~%q`, redis.Namespace, redis.Name+"(-read)?")
+	instance := redis.Namespace + "/" + redis.Name
+
+	rules := []interface{}{
+		alertRule("RedisDown",
+			fmt.Sprintf("redis_up{%s} == 0", selector),
+			"1m", "critical",
+			"redis {{ $labels.pod }} of "+instance+" is down"),
+		alertRule("RedisMemoryHigh",
+			fmt.Sprintf("redis_memory_used_bytes{%[1]s} / redis_config_maxmemory{%[1]s} > 0.9 and redis_config_maxmemory{%[1]s} > 0", selector),
+			"5m", "warning",
+			"redis {{ $labels.pod }} of "+instance+" uses over 90% of maxmemory"),
+		alertRule("RedisEvictingKeys",
+			fmt.Sprintf("increase(redis_evicted_keys_total{%s}[5m]) > 0", selector),
+			"5m", "warning",
+			"redis {{ $labels.pod }} of "+instance+" is evicting keys"),
+		alertRule("RedisTooManyConnections",
+			fmt.Sprintf("redis_connected_clients{%s} > 1000", selector),
+			"5m", "warning",
+			"redis {{ $labels.pod }} of "+instance+" has over 1000 clients"),
+	}
+
+	if redis.Spec.Persistence != nil {
+		rules = append(rules, alertRule("RedisBackgroundSaveFailed",
+			fmt.Sprintf("redis_rdb_last_bgsave_status{%s} == 0", selector),
+			"1m", "critical",
+			"the last background save of redis {{ $labels.pod }} of "+instance+" failed"))
+	}
+
+	if replicationEnabled(redis) {
+		rules = append(rules, alertRule("RedisMissingReplicas",
+			fmt.Sprintf(`max(redis_connected_slaves{%s}) < %s`, selector, strconv.Itoa(int(redis.Spec.Topology.Replicas))),
+			"5m", "warning",
+			"the master of "+instance+" has fewer replicas than spec.topology.replicas"))
+	}
+
+	prometheusRule.Object["spec"] = map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{
+				"name":  "redis-" + redis.Name,
+				"rules": rules,
+			},
+		},
+	}
+
+	return prometheusRule
+}
+
+func alertRule(name, expr, duration, severity, summary string) map[string]interface{} {
+	return map[string]interface{}{
+		"alert": name,
+		"expr":  expr,
+		"for":   duration,
+		"labels": map[string]interface{}{
+			"severity": severity,
+		},
+		"annotations": map[string]interface{}{
+			"summary": summary,
+		},
+	}
+}
@@ -0,0 +1,239 @@
+package stub
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// fakeCustomResourceClient serves one custom resource the way the API server
+// does: strategic merge patches are refused, merge patches are applied
+type fakeCustomResourceClient struct {
+	dynamic.ResourceInterface
+	object  *unstructured.Unstructured
+	patches []types.PatchType
+}
+
+func (c *fakeCustomResourceClient) Get(name string, opts metav1.GetOptions) (*unstructured.Unstructured, error) {
+	return c.object.DeepCopy(), nil
+}
+
+func (c *fakeCustomResourceClient) Patch(name string, pt types.PatchType, data []byte) (*unstructured.Unstructured, error) {
+	c.patches = append(c.patches, pt)
+	if pt != types.MergePatchType {
+		return nil, errors.NewGenericServerResponse(415, "patch", schema.GroupResource{}, name, "the body of the request was in an unknown format", 0, false)
+	}
+
+	var patch map[string]interface{}
+	err := json.Unmarshal(data, &patch)
+	if err != nil {
+		return nil, err
+	}
+
+	c.object.Object = applyMergePatch(c.object.Object, patch)
+	return c.object.DeepCopy(), nil
+}
+
+// applyMergePatch is RFC 7386
+func applyMergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = map[string]interface{}{}
+	}
+
+	for key, value := range patch {
+		switch value := value.(type) {
+		case nil:
+			delete(target, key)
+		case map[string]interface{}:
+			targetValue, _ := target[key].(map[string]interface{})
+			target[key] = applyMergePatch(targetValue, value)
+		default:
+			target[key] = value
+		}
+	}
+
+	return target
+}
+
+// liveCustomResource is desired as it was created by an earlier reconcile
+func liveCustomResource(t *testing.T, desired *unstructured.Unstructured) *unstructured.Unstructured {
+	desiredMap, err := toMap(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live := desired.DeepCopy()
+	err = setLastApplied(live, desiredMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live.Object, err = toMap(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live.SetResourceVersion("42")
+	return live
+}
+
+func TestReconcileCustomResources(t *testing.T) {
+	defer func(f func(string, string, string) (dynamic.ResourceInterface, string, error), r *eventRecorder) {
+		getResourceClient = f
+		recorder = r
+	}(getResourceClient, recorder)
+	recorder = newFakeEventRecorder().eventRecorder
+
+	redis := testRedis()
+	redis.Spec.Monitoring = &v1alpha2.RedisMonitoring{Labels: map[string]string{"prometheus": "a"}, Rules: true}
+	redis.SetDefaults()
+
+	changed := redis.DeepCopy()
+	changed.Spec.Monitoring.Interval = "10s"
+	changed.Spec.Monitoring.Labels = map[string]string{"prometheus": "b"}
+	changed.Spec.Persistence = nil
+
+	tests := []struct {
+		name       string
+		definition func(*v1alpha2.Redis) *unstructured.Unstructured
+	}{
+		{name: "ServiceMonitor", definition: getServiceMonitorDefinition},
+		{name: "PrometheusRule", definition: getPrometheusRuleDefinition},
+	}
+
+	for _, test := range tests {
+		client := &fakeCustomResourceClient{object: liveCustomResource(t, test.definition(redis))}
+		// a label set by someone else
+		client.object.SetLabels(map[string]string{"prometheus": "a", "team": "cache"})
+		getResourceClient = func(apiVersion, kind, namespace string) (dynamic.ResourceInterface, string, error) {
+			return client, "", nil
+		}
+
+		desired := test.definition(changed)
+		drifted, err := reconcileObject(desired)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if len(drifted) == 0 {
+			t.Errorf("%s: nothing drifted", test.name)
+		}
+
+		if !reflect.DeepEqual(client.patches, []types.PatchType{types.MergePatchType}) {
+			t.Errorf("%s: got patches %v, want one merge patch", test.name, client.patches)
+		}
+
+		desiredMap, err := toMap(desired)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(client.object.Object["spec"], desiredMap["spec"]) {
+			t.Errorf("%s: got spec %v, want %v", test.name, client.object.Object["spec"], desiredMap["spec"])
+		}
+
+		labels := map[string]string{"prometheus": "b", "team": "cache"}
+		for k, v := range genericObjectDefinitionLabels() {
+			labels[k] = v
+		}
+
+		if !reflect.DeepEqual(client.object.GetLabels(), labels) {
+			t.Errorf("%s: got labels %v, want %v", test.name, client.object.GetLabels(), labels)
+		}
+
+		client.patches = nil
+		drifted, err = reconcileObject(test.definition(changed))
+		if err != nil || len(drifted) != 0 || len(client.patches) != 0 {
+			t.Errorf("%s: reconciled again, got drift %v, patches %v and error %v", test.name, drifted, client.patches, err)
+		}
+	}
+}
+
+func TestStrategicMergeSupported(t *testing.T) {
+	tests := []struct {
+		gvk  schema.GroupVersionKind
+		want bool
+	}{
+		{gvk: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}, want: true},
+		{gvk: schema.GroupVersionKind{Version: "v1", Kind: "Service"}, want: true},
+		{gvk: schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}, want: false},
+		{gvk: schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "PrometheusRule"}, want: false},
+	}
+
+	for _, test := range tests {
+		if got := strategicMergeSupported(test.gvk); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.gvk, got, test.want)
+		}
+	}
+}
+
+func TestPrometheusRuleDefinition(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*v1alpha2.Redis)
+		alerts  []string
+		missing []string
+	}{
+		{
+			name:   "replicated with persistence",
+			alerts: []string{"RedisDown", "RedisBackgroundSaveFailed", "RedisMissingReplicas"},
+		},
+		{
+			name: "single instance in memory",
+			mutate: func(redis *v1alpha2.Redis) {
+				redis.Spec.Topology.Replicas = 0
+				redis.Spec.Persistence = nil
+			},
+			alerts:  []string{"RedisDown", "RedisMemoryHigh"},
+			missing: []string{"RedisBackgroundSaveFailed", "RedisMissingReplicas"},
+		},
+	}
+
+	for _, test := range tests {
+		redis := testRedis()
+		redis.Spec.Monitoring = &v1alpha2.RedisMonitoring{Rules: true}
+		if test.mutate != nil {
+			test.mutate(redis)
+		}
+		redis.SetDefaults()
+
+		groups, _, _ := unstructured.NestedSlice(getPrometheusRuleDefinition(redis).Object, "spec", "groups")
+		if len(groups) != 1 {
+			t.Fatalf("%s: got %d groups", test.name, len(groups))
+		}
+
+		alerts := map[string]string{}
+		rules, _, _ := unstructured.NestedSlice(groups[0].(map[string]interface{}), "rules")
+		for _, rule := range rules {
+			rule := rule.(map[string]interface{})
+			alerts[rule["alert"].(string)] = rule["expr"].(string)
+		}
+
+		for _, alert := range test.alerts {
+			expr, ok := alerts[alert]
+			if !ok {
+				t.Errorf("%s: no %s alert", test.name, alert)
+				continue
+			}
+
+			if !strings.Contains(expr, `namespace="default",service=~"cache(-read)?"`) {
+				t.Errorf("%s: %s isn't scoped to the Redis: %s", test.name, alert, expr)
+			}
+		}
+
+		for _, alert := range test.missing {
+			if _, ok := alerts[alert]; ok {
+				t.Errorf("%s: got the %s alert", test.name, alert)
+			}
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package stub
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	dataVolumeName = "redis-data"
+	// dataDir is where the rendered config points "dir" at
+	dataDir = "/data"
+)
+
+// createOrUpdateWorkload runs redis as a StatefulSet when persistence,
+// replicas or cluster mode are requested and as a Deployment otherwise. A
+// Deployment is only replaced by a StatefulSet: the pods of the StatefulSet
+// replicate the pod of the Deployment, which is removed once they have
+// synced with it. Going back to a Deployment is refused by validateWorkload.
+func createOrUpdateWorkload(r *v1alpha2.Redis) error {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	if !usesStatefulSet(redis) {
+		err := createOrUpdateDeployment(redis)
+		if err != nil {
+			return err
+		}
+
+		deploy, err := getDeploymentDefinition(redis)
+		if err != nil {
+			return err
+		}
+
+		sts, err := getStatefulSetDefinition(redis)
+		if err != nil {
+			return err
+		}
+
+		return retireWorkload(deploy, sts, func() bool { return isDeploymentReady(deploy) })
+	}
+
+	err := createOrUpdateStatefulSet(redis)
+	if err != nil {
+		return err
+	}
+
+	sts, err := getStatefulSetDefinition(redis)
+	if err != nil {
+		return err
+	}
+
+	deploy, err := getDeploymentDefinition(redis)
+	if err != nil {
+		return err
+	}
+
+	return retireWorkload(sts, deploy, func() bool { return isStatefulSetReady(sts) && handedOver(redis) })
+}
+
+// usesStatefulSet tells whether the pods need the stable names and volumes of
+// a StatefulSet, a plain single instance keeps using a Deployment
+func usesStatefulSet(redis *v1alpha2.Redis) bool {
+	return redis.Spec.Persistence != nil || redis.Spec.Topology.Replicas > 0 || clusterEnabled(redis)
+}
+
+// retireWorkload deletes old once current exists and is ready
+func retireWorkload(current, old sdk.Object, ready func() bool) error {
+	err := sdk.Get(old)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = sdk.Get(current)
+	if err != nil {
+		return err
+	}
+
+	oldName, _, _ := objectInfo(old)
+	currentName, namespace, _ := objectInfo(current)
+
+	if !ready() {
+		logrus.Infof("waiting for %s to be ready before removing %s in %s", currentName, oldName, namespace)
+		return nil
+	}
+
+	logrus.Infof("migrated to %s, removing %s in %s", currentName, oldName, namespace)
+	err = deleteChild(old)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+func objectInfo(object sdk.Object) (string, string, error) {
+	accessor, err := metaAccessor(object)
+	if err != nil {
+		return "", "", err
+	}
+
+	kind := object.GetObjectKind().GroupVersionKind().Kind
+	return kind + "/" + accessor.GetName(), accessor.GetNamespace(), nil
+}
+
+func createOrUpdateStatefulSet(redis *v1alpha2.Redis) error {
+	sts, err := getStatefulSetDefinition(redis)
+	if err != nil {
+		return err
+	}
+
+	err = setPasswordSecretHash(redis, &sts.Spec.Template)
+	if err != nil {
+		return err
+	}
+
+	live := &v1.StatefulSet{TypeMeta: statefulSetTypeMeta, ObjectMeta: childObjectMeta(redis, redis.Name)}
+	err = sdk.Get(live)
+	if err == nil {
+		keepDerivedMemory(redis, &sts.Spec.Template, &live.Spec.Template)
+		keepRuntimeConfig(&sts.Spec.Template, &live.Spec.Template)
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	if clusterEnabled(redis) {
+		err = keepClusterNodes(redis, sts)
+		if err != nil {
+			return err
+		}
+	}
+
+	desired, err := withTopologySpread(redis, sts)
+	if err != nil {
+		return err
+	}
+
+	drifted, err := reconcileObject(desired)
+	recordRollout(redis, sts, drifted)
+	return err
+}
+
+func getStatefulSetDefinition(redis *v1alpha2.Redis) (*v1.StatefulSet, error) {
+	// one master plus the read replicas
+	replicas := 1 + redis.Spec.Topology.Replicas
+	if clusterEnabled(redis) {
+		replicas = clusterSize(redis)
+	}
+	template, err := getPodTemplateDefinition(redis)
+
+	if err != nil {
+		return nil, err
+	}
+
+	labels := getCombinedLabels(redis.Name)
+
+	sts := &v1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "apps/v1",
+			Kind:       "StatefulSet",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            redis.Name,
+			Namespace:       redis.Namespace,
+			Labels:          labels,
+			OwnerReferences: ownerReferences(redis),
+		},
+		Spec: v1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: redis.Name,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: *template,
+		},
+	}
+
+	sts.Spec.VolumeClaimTemplates, err = getVolumeClaimTemplates(redis)
+	if err != nil {
+		return nil, err
+	}
+
+	return sts, nil
+}
+
+// getVolumeClaimTemplates is the claim of the data volume, none without
+// persistence
+func getVolumeClaimTemplates(redis *v1alpha2.Redis) ([]corev1.PersistentVolumeClaim, error) {
+	if redis.Spec.Persistence == nil {
+		return nil, nil
+	}
+
+	size, err := resource.ParseQuantity(redis.Spec.Persistence.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	return []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   dataVolumeName,
+				Labels: getCombinedLabels(redis.Name),
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      redis.Spec.Persistence.AccessModes,
+				StorageClassName: redis.Spec.Persistence.StorageClassName,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: size,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// handedOver tells whether every pod of the StatefulSet replicates the pod
+// of the Deployment it replaces and has synced with it, removing the
+// Deployment any earlier would lose its data
+func handedOver(redis *v1alpha2.Redis) bool {
+	password, err := getPassword(redis)
+	if err != nil {
+		logrus.Warnf("failed to read the password of %s/%s: %v", redis.Namespace, redis.Name, err)
+		return false
+	}
+
+	nodes, err := getRedisNodes(redis, password)
+	if err != nil {
+		logrus.Warnf("failed to list the redis pods of %s/%s: %v", redis.Namespace, redis.Name, err)
+		return false
+	}
+
+	masters := map[string]bool{}
+	for _, node := range nodes {
+		if !node.fromDeployment() {
+			continue
+		}
+
+		// it may well hold data we can't see
+		if node.info == nil {
+			return false
+		}
+
+		if node.info["role"] == roleMaster {
+			masters[node.pod.Status.PodIP] = true
+		}
+	}
+
+	// no Deployment pod runs, there's nothing to hand over
+	if len(masters) == 0 {
+		return true
+	}
+
+	for _, node := range nodes {
+		if node.fromDeployment() {
+			continue
+		}
+
+		if node.info == nil ||
+			node.info["role"] != roleSlave ||
+			!masters[node.info["master_host"]] ||
+			node.info["master_link_status"] != "up" ||
+			node.info["master_sync_in_progress"] != "0" {
+			logrus.Infof("waiting for %s/%s to sync with the Deployment it replaces", node.pod.Namespace, node.pod.Name)
+			return false
+		}
+	}
+
+	return true
+}
+
+// isStatefulSetReady is true once every pod runs the current revision
+func isStatefulSetReady(sts *v1.StatefulSet) bool {
+	if sts.Status.ObservedGeneration < sts.Generation {
+		return false
+	}
+
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+
+	return sts.Status.ReadyReplicas == replicas &&
+		sts.Status.CurrentRevision == sts.Status.UpdateRevision
+}
+
+// validateWorkload refuses the changes the running workload can't take. A
+// StatefulSet can't be replaced by a Deployment, which would start empty,
+// cluster mode can't take over the data of a Deployment and the volume
+// claims of a StatefulSet can't change.
+func validateWorkload(r *v1alpha2.Redis) []string {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	sts := &v1.StatefulSet{TypeMeta: statefulSetTypeMeta, ObjectMeta: childObjectMeta(redis, redis.Name)}
+	err := sdk.Get(sts)
+	if errors.IsNotFound(err) {
+		if !clusterEnabled(redis) {
+			return nil
+		}
+
+		deploy := &v1.Deployment{TypeMeta: deploymentTypeMeta, ObjectMeta: childObjectMeta(redis, redis.Name)}
+		err = sdk.Get(deploy)
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		if err != nil {
+			return []string{fmt.Sprintf("failed to read Deployment ( %s ): %v", redis.Name, err)}
+		}
+
+		return []string{clusterTakeoverMessage(redis)}
+	}
+
+	if err != nil {
+		return []string{fmt.Sprintf("failed to read StatefulSet ( %s ): %v", redis.Name, err)}
+	}
+
+	if !usesStatefulSet(redis) {
+		return []string{statefulSetDroppedMessage(redis)}
+	}
+
+	desired, err := getVolumeClaimTemplates(redis)
+	if err != nil {
+		// reported by validatePersistence
+		return nil
+	}
+
+	return claimTemplateChanges(sts.Spec.VolumeClaimTemplates, desired)
+}
+
+func statefulSetDroppedMessage(redis *v1alpha2.Redis) string {
+	return fmt.Sprintf("persistence and replicas can't be dropped, the StatefulSet ( %s ) would be replaced by an empty Deployment", redis.Name)
+}
+
+func clusterTakeoverMessage(redis *v1alpha2.Redis) string {
+	return fmt.Sprintf("cluster mode can't take over the data of the Deployment ( %s ), create a new Redis instead", redis.Name)
+}
+
+// claimTemplateChanges lists how desired differs from the volume claim
+// templates of an existing StatefulSet, which the API server refuses
+func claimTemplateChanges(current, desired []corev1.PersistentVolumeClaim) []string {
+	if len(current) == 0 && len(desired) > 0 {
+		return []string{"persistence can't be added once the StatefulSet exists"}
+	}
+
+	if len(current) > 0 && len(desired) == 0 {
+		return []string{"persistence can't be removed once the StatefulSet exists"}
+	}
+
+	var changes []string
+	for i := range desired {
+		if i >= len(current) {
+			break
+		}
+
+		c, d := current[i].Spec, desired[i].Spec
+
+		currentSize := c.Resources.Requests[corev1.ResourceStorage]
+		desiredSize := d.Resources.Requests[corev1.ResourceStorage]
+		if currentSize.Cmp(desiredSize) != 0 {
+			changes = append(changes, fmt.Sprintf("persistence size ( %s ) can't change from ( %s ) once the StatefulSet exists",
+				desiredSize.String(), currentSize.String()))
+		}
+
+		if storageClassName(c.StorageClassName) != storageClassName(d.StorageClassName) {
+			changes = append(changes, fmt.Sprintf("persistence storageClassName ( %s ) can't change from ( %s ) once the StatefulSet exists",
+				storageClassName(d.StorageClassName), storageClassName(c.StorageClassName)))
+		}
+
+		if !reflect.DeepEqual(c.AccessModes, d.AccessModes) {
+			changes = append(changes, fmt.Sprintf("persistence accessModes ( %v ) can't change from ( %v ) once the StatefulSet exists",
+				d.AccessModes, c.AccessModes))
+		}
+	}
+
+	return changes
+}
+
+func storageClassName(name *string) string {
+	if name == nil {
+		return ""
+	}
+
+	return *name
+}
+
+func validatePersistence(redis *v1alpha2.Redis) []string {
+	persistence := redis.Spec.Persistence
+	if persistence == nil {
+		return nil
+	}
+
+	var validationErrors []string
+
+	if persistence.Size != "" {
+		size, err := resource.ParseQuantity(persistence.Size)
+		if err != nil || size.Sign() <= 0 {
+			validationErrors = append(validationErrors,
+				fmt.Sprintf("persistence size ( %s ) is not a valid quantity", persistence.Size))
+		}
+	}
+
+	for _, mode := range persistence.AccessModes {
+		switch mode {
+		case corev1.ReadWriteOnce, corev1.ReadOnlyMany, corev1.ReadWriteMany:
+		default:
+			validationErrors = append(validationErrors,
+				fmt.Sprintf("persistence access mode ( %s ) is not supported", mode))
+		}
+	}
+
+	return validationErrors
+}
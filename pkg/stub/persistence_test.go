@@ -0,0 +1,106 @@
+package stub
+
+import (
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidateUpdate(t *testing.T) {
+	fast := "fast"
+
+	tests := []struct {
+		name   string
+		old    func(*v1alpha2.RedisSpec)
+		new    func(*v1alpha2.RedisSpec)
+		fields []string
+	}{
+		{
+			name: "deployment to statefulset",
+			old:  func(spec *v1alpha2.RedisSpec) {},
+			new: func(spec *v1alpha2.RedisSpec) {
+				spec.Persistence = &v1alpha2.RedisPersistence{}
+			},
+		},
+		{
+			name: "statefulset to deployment",
+			old: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology.Replicas = 2
+			},
+			new:    func(spec *v1alpha2.RedisSpec) {},
+			fields: []string{"spec"},
+		},
+		{
+			name: "deployment to cluster",
+			old:  func(spec *v1alpha2.RedisSpec) {},
+			new: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology.Mode = v1alpha2.RedisModeCluster
+				spec.Topology.Shards = 3
+			},
+			fields: []string{"spec.topology.mode"},
+		},
+		{
+			name: "persistence added to a statefulset",
+			old: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology.Replicas = 1
+			},
+			new: func(spec *v1alpha2.RedisSpec) {
+				spec.Topology.Replicas = 1
+				spec.Persistence = &v1alpha2.RedisPersistence{}
+			},
+			fields: []string{"spec.persistence"},
+		},
+		{
+			name: "claim changed",
+			old: func(spec *v1alpha2.RedisSpec) {
+				spec.Persistence = &v1alpha2.RedisPersistence{Size: "1Gi"}
+			},
+			new: func(spec *v1alpha2.RedisSpec) {
+				spec.Persistence = &v1alpha2.RedisPersistence{
+					Size:             "2Gi",
+					StorageClassName: &fast,
+					AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+				}
+			},
+			fields: []string{"spec.persistence", "spec.persistence", "spec.persistence"},
+		},
+		{
+			name: "same claim written differently",
+			old: func(spec *v1alpha2.RedisSpec) {
+				spec.Persistence = &v1alpha2.RedisPersistence{Size: "1Gi"}
+			},
+			new: func(spec *v1alpha2.RedisSpec) {
+				spec.Persistence = &v1alpha2.RedisPersistence{
+					Size:        "1024Mi",
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				}
+				spec.Topology.Replicas = 2
+			},
+		},
+	}
+
+	for _, test := range tests {
+		old, redis := testRedis(), testRedis()
+		old.Spec, redis.Spec = v1alpha2.RedisSpec{}, v1alpha2.RedisSpec{}
+		test.old(&old.Spec)
+		test.new(&redis.Spec)
+
+		var fields []string
+		for _, validationError := range ValidateUpdate(old, redis) {
+			fields = append(fields, validationError.Field)
+		}
+
+		if len(fields) != len(test.fields) {
+			t.Errorf("%s: got errors on %v, want %v", test.name, fields, test.fields)
+			continue
+		}
+
+		for i := range fields {
+			if fields[i] != test.fields[i] {
+				t.Errorf("%s: got errors on %v, want %v", test.name, fields, test.fields)
+				break
+			}
+		}
+	}
+}
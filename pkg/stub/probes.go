@@ -0,0 +1,127 @@
+package stub
+
+import (
+	"fmt"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	rConfig "github.com/flexshopper/redis-operator/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// probeCli runs redis-cli against the local redis, authenticating when the
+// password is in the container env. Errors redis answers with still exit 0,
+// the scripts look at the output.
+const probeCli = `%scli() { redis-cli -h 127.0.0.1 -p %d %s"$@" 2>/dev/null; }
+info=$(cli info) || exit 1
+`
+
+// probeAuthEnv hands the password to redis-cli in REDISCLI_AUTH, which keeps
+// it off the command line. redis-cli only reads it from 5.0 on, older ones
+// are given probeAuthArg.
+const (
+	probeAuthEnv = `[ -z "$` + passwordEnvVar + `" ] || export REDISCLI_AUTH="$` + passwordEnvVar + `"
+`
+	probeAuthArg = `${` + passwordEnvVar + `:+-a "$` + passwordEnvVar + `"} `
+)
+
+// livenessScript answers PING with PONG. While redis loads its dataset it
+// answers LOADING instead, which is fine until the startup budget is spent:
+// startup probes aren't available in the vendored API, so this one stands
+// in for it.
+const livenessScript = `case "$info" in
+*loading:1*)
+	uptime=$(echo "$info" | tr -d '\r' | sed -n 's/^uptime_in_seconds://p')
+	[ "${uptime:-0}" -lt %d ]
+	exit
+	;;
+esac
+[ "$(cli ping)" = PONG ]
+`
+
+// readinessScript fails while redis loads its dataset, while a replica has
+// no link to its master and while it syncs with it
+const readinessScript = `case "$info" in
+*loading:1*|*master_sync_in_progress:1*) exit 1 ;;
+esac
+case "$info" in
+*role:slave*)
+	case "$info" in
+	*master_link_status:up*) ;;
+	*) exit 1 ;;
+	esac
+	;;
+esac
+[ "$(cli ping)" = PONG ]
+`
+
+// getRedisProbes are the liveness and readiness probes of the redis
+// container, redis has its defaults set
+func getRedisProbes(redis *v1alpha2.Redis) (*corev1.Probe, *corev1.Probe) {
+	probes := redis.Spec.Probes
+	cli := fmt.Sprintf(probeCli, probeAuthEnv, redis.Spec.Port, "")
+	if version, err := rConfig.ResolveVersion(&redis.Spec); err == nil && version.Less(rConfig.Version{Major: 5}) {
+		cli = fmt.Sprintf(probeCli, "", redis.Spec.Port, probeAuthArg)
+	}
+
+	startup := probes.Startup
+	startupSeconds := startup.InitialDelaySeconds + startup.PeriodSeconds*startup.FailureThreshold
+
+	liveness := execProbe(cli+fmt.Sprintf(livenessScript, startupSeconds), probes.Liveness)
+	readiness := execProbe(cli+readinessScript, probes.Readiness)
+
+	return liveness, readiness
+}
+
+func execProbe(script string, timings *v1alpha2.RedisProbe) *corev1.Probe {
+	return &corev1.Probe{
+		Handler: corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"sh", "-c", script},
+			},
+		},
+		InitialDelaySeconds: timings.InitialDelaySeconds,
+		PeriodSeconds:       timings.PeriodSeconds,
+		TimeoutSeconds:      timings.TimeoutSeconds,
+		FailureThreshold:    timings.FailureThreshold,
+		SuccessThreshold:    1,
+	}
+}
+
+// validateProbes refuses timings the API server would
+func validateProbes(r *v1alpha2.Redis) []string {
+	if r.Spec.Probes == nil {
+		return nil
+	}
+
+	var validationErrors []string
+
+	for _, probe := range []struct {
+		name    string
+		timings *v1alpha2.RedisProbe
+	}{
+		{"liveness", r.Spec.Probes.Liveness},
+		{"readiness", r.Spec.Probes.Readiness},
+		{"startup", r.Spec.Probes.Startup},
+	} {
+		if probe.timings == nil {
+			continue
+		}
+
+		for _, field := range []struct {
+			name  string
+			value int32
+		}{
+			{"initialDelaySeconds", probe.timings.InitialDelaySeconds},
+			{"periodSeconds", probe.timings.PeriodSeconds},
+			{"timeoutSeconds", probe.timings.TimeoutSeconds},
+			{"failureThreshold", probe.timings.FailureThreshold},
+		} {
+			if field.value < 0 {
+				validationErrors = append(validationErrors,
+					fmt.Sprintf("%s probe %s ( %d ) can't be negative", probe.name, field.name, field.value))
+			}
+		}
+	}
+
+	return validationErrors
+}
@@ -0,0 +1,169 @@
+package stub
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+)
+
+// fakeRedisCli answers info and ping with FAKE_INFO and FAKE_PING and logs
+// how it was called to CLI_LOG
+const fakeRedisCli = `#!/bin/sh
+echo "args: $*" >> "$CLI_LOG"
+[ -z "$REDISCLI_AUTH" ] || echo "env: $REDISCLI_AUTH" >> "$CLI_LOG"
+for last; do :; done
+case "$last" in
+info) printf '%s' "$FAKE_INFO" ;;
+ping) echo "$FAKE_PING" ;;
+esac
+`
+
+// runProbe runs the script of probe with the fake redis-cli, it returns
+// whether the probe passed and what redis-cli was called with
+func runProbe(t *testing.T, script, info, ping, password string) (bool, string) {
+	dir, err := ioutil.TempDir("", "probe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "redis-cli"), []byte(fakeRedisCli), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := filepath.Join(dir, "log")
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Env = []string{
+		"PATH=" + dir + ":" + os.Getenv("PATH"),
+		"CLI_LOG=" + log,
+		"FAKE_INFO=" + info,
+		"FAKE_PING=" + ping,
+	}
+	if password != "" {
+		cmd.Env = append(cmd.Env, passwordEnvVar+"="+password)
+	}
+
+	err = cmd.Run()
+	if _, failed := err.(*exec.ExitError); err != nil && !failed {
+		t.Fatal(err)
+	}
+
+	calls, _ := ioutil.ReadFile(log)
+	return err == nil, string(calls)
+}
+
+func TestRedisProbes(t *testing.T) {
+	redis := testRedis()
+	// a startup budget of 30s
+	redis.Spec.Probes.Startup = &v1alpha2.RedisProbe{PeriodSeconds: 10, FailureThreshold: 3}
+	liveness, readiness := getRedisProbes(redis)
+
+	info := func(lines ...string) string {
+		return "# Server\r\n" + strings.Join(lines, "\r\n") + "\r\n"
+	}
+
+	tests := []struct {
+		name      string
+		info      string
+		ping      string
+		liveness  bool
+		readiness bool
+	}{
+		{
+			name:      "master",
+			info:      info("uptime_in_seconds:100", "loading:0", "role:master"),
+			ping:      "PONG",
+			liveness:  true,
+			readiness: true,
+		},
+		{
+			name:      "loading within the startup budget",
+			info:      info("uptime_in_seconds:20", "loading:1", "role:master"),
+			ping:      "LOADING Redis is loading the dataset in memory",
+			liveness:  true,
+			readiness: false,
+		},
+		{
+			name:      "loading past the startup budget",
+			info:      info("uptime_in_seconds:31", "loading:1", "role:master"),
+			ping:      "LOADING Redis is loading the dataset in memory",
+			liveness:  false,
+			readiness: false,
+		},
+		{
+			name:      "replica in sync",
+			info:      info("uptime_in_seconds:100", "loading:0", "role:slave", "master_link_status:up", "master_sync_in_progress:0"),
+			ping:      "PONG",
+			liveness:  true,
+			readiness: true,
+		},
+		{
+			name:      "replica without its master",
+			info:      info("uptime_in_seconds:100", "loading:0", "role:slave", "master_link_status:down", "master_sync_in_progress:0"),
+			ping:      "PONG",
+			liveness:  true,
+			readiness: false,
+		},
+		{
+			name:      "replica syncing",
+			info:      info("uptime_in_seconds:100", "loading:0", "role:slave", "master_link_status:down", "master_sync_in_progress:1"),
+			ping:      "PONG",
+			liveness:  true,
+			readiness: false,
+		},
+		{
+			name:      "not answering",
+			info:      info("uptime_in_seconds:100", "loading:0", "role:master"),
+			ping:      "NOAUTH Authentication required.",
+			liveness:  false,
+			readiness: false,
+		},
+	}
+
+	for _, test := range tests {
+		if passed, _ := runProbe(t, liveness.Exec.Command[2], test.info, test.ping, ""); passed != test.liveness {
+			t.Errorf("%s: liveness passed %v, want %v", test.name, passed, test.liveness)
+		}
+
+		if passed, _ := runProbe(t, readiness.Exec.Command[2], test.info, test.ping, ""); passed != test.readiness {
+			t.Errorf("%s: readiness passed %v, want %v", test.name, passed, test.readiness)
+		}
+	}
+}
+
+func TestRedisProbesAuth(t *testing.T) {
+	tests := []struct {
+		image    string
+		password string
+		args     string
+		env      bool
+	}{
+		{image: "redis:7.0", password: "s3cret", args: "args: -h 127.0.0.1 -p 6379 info", env: true},
+		{image: "redis:7.0", args: "args: -h 127.0.0.1 -p 6379 info"},
+		// redis-cli reads REDISCLI_AUTH from 5.0 on
+		{image: "redis:4.0", password: "s3cret", args: "args: -h 127.0.0.1 -p 6379 -a s3cret info"},
+		{image: "redis:4.0", args: "args: -h 127.0.0.1 -p 6379 info"},
+	}
+
+	for _, test := range tests {
+		redis := testRedis()
+		redis.Spec.Image = test.image
+		_, readiness := getRedisProbes(redis)
+
+		_, calls := runProbe(t, readiness.Exec.Command[2], "role:master\r\n", "PONG", test.password)
+		lines := strings.Split(calls, "\n")
+		if lines[0] != test.args {
+			t.Errorf("%s with password %q: got %q, want %q", test.image, test.password, lines[0], test.args)
+		}
+
+		if env := strings.Contains(calls, "env: "+test.password); env != test.env {
+			t.Errorf("%s with password %q: REDISCLI_AUTH set %v, want %v", test.image, test.password, env, test.env)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// lastAppliedAnnotation keeps the desired state we sent last time, it lets us
+// tell fields we stopped setting apart from fields set by someone else
+const lastAppliedAnnotation = "cache.flexshopper.com/last-applied"
+
+// getResourceClient is replaced in tests
+var getResourceClient = k8sclient.GetResourceClient
+
+// reconcileObject creates the desired object when it doesn't exist, otherwise
+// it compares it with the live one and patches only the fields that drifted.
+// Fields we never set (defaults, other controllers) are left alone.
+func reconcileObject(desired sdk.Object) ([]string, error) {
+	name, namespace, err := k8sutil.GetNameAndNamespace(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	gvk := desired.GetObjectKind().GroupVersionKind()
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	desiredMap, err := toMap(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceClient, _, err := getResourceClient(apiVersion, kind, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource client: %v", err)
+	}
+
+	live, err := resourceClient.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		err = setLastApplied(desired, desiredMap)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, createChild(desired)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var lastApplied map[string]interface{}
+	if raw, ok := live.GetAnnotations()[lastAppliedAnnotation]; ok {
+		// a corrupted annotation only means we can't prune removed fields
+		utiljson.Unmarshal([]byte(raw), &lastApplied)
+	}
+
+	var drifted []string
+	patch := diffMaps(lastApplied, desiredMap, live.Object, "", &drifted)
+	if len(patch) == 0 {
+		return nil, nil
+	}
+
+	sort.Strings(drifted)
+	logrus.Infof("%s %s/%s drifted: %s", kind, namespace, name, strings.Join(drifted, ", "))
+
+	rawDesired, err := json.Marshal(desiredMap)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, _ := patch["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		patch["metadata"] = metadata
+	}
+
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if annotations == nil {
+		annotations = map[string]interface{}{}
+		metadata["annotations"] = annotations
+	}
+
+	annotations[lastAppliedAnnotation] = string(rawDesired)
+
+	patchType := types.StrategicMergePatchType
+	if !strategicMergeSupported(gvk) {
+		patchType = types.MergePatchType
+		patch = mergePatch(patch, desiredMap)
+	}
+
+	rawPatch, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = resourceClient.Patch(name, patchType, rawPatch)
+	observeChildOperation(desired, "update", err)
+	if err != nil {
+		return nil, err
+	}
+
+	return drifted, nil
+}
+
+// toMap turns a typed object into its JSON form, dropping the status and
+// the null values json.Marshal produces for unset structs. Numbers are
+// decoded as int64 like in the live objects, float64 would never compare
+// equal to them.
+func toMap(object interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	err = utiljson.Unmarshal(raw, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(m, "status")
+	pruneNulls(m)
+
+	return m, nil
+}
+
+func pruneNulls(m map[string]interface{}) {
+	for k, v := range m {
+		switch value := v.(type) {
+		case nil:
+			delete(m, k)
+		case map[string]interface{}:
+			pruneNulls(value)
+		case []interface{}:
+			for _, item := range value {
+				if itemMap, ok := item.(map[string]interface{}); ok {
+					pruneNulls(itemMap)
+				}
+			}
+		}
+	}
+}
+
+func setLastApplied(object sdk.Object, desiredMap map[string]interface{}) error {
+	raw, err := json.Marshal(desiredMap)
+	if err != nil {
+		return err
+	}
+
+	accessor, err := metaAccessor(object)
+	if err != nil {
+		return err
+	}
+
+	annotations := accessor.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	annotations[lastAppliedAnnotation] = string(raw)
+	accessor.SetAnnotations(annotations)
+
+	return nil
+}
+
+func metaAccessor(object sdk.Object) (metav1.Object, error) {
+	accessor, ok := object.(metav1.Object)
+	if !ok {
+		return nil, fmt.Errorf("%T does not have object metadata", object)
+	}
+
+	return accessor, nil
+}
+
+// diffMaps returns the strategic merge patch taking live to desired. Only
+// keys present in desired are compared, keys that were in lastApplied but
+// are gone from desired are removed. Drifted field paths are collected.
+func diffMaps(lastApplied, desired, live map[string]interface{}, path string, drifted *[]string) map[string]interface{} {
+	patch := map[string]interface{}{}
+
+	for k, desiredValue := range desired {
+		fieldPath := path + "." + k
+		liveValue, found := live[k]
+		lastAppliedValue := lastApplied[k]
+
+		switch d := desiredValue.(type) {
+		case map[string]interface{}:
+			l, ok := liveValue.(map[string]interface{})
+			if !ok {
+				patch[k] = d
+				*drifted = append(*drifted, fieldPath)
+				continue
+			}
+
+			la, _ := lastAppliedValue.(map[string]interface{})
+			sub := diffMaps(la, d, l, fieldPath, drifted)
+			if len(sub) > 0 {
+				patch[k] = sub
+			}
+		case []interface{}:
+			l, _ := liveValue.([]interface{})
+			la, _ := lastAppliedValue.([]interface{})
+			sub, changed := diffLists(la, d, l, fieldPath, drifted)
+			if changed {
+				patch[k] = sub
+			}
+		default:
+			if !found || !reflect.DeepEqual(desiredValue, liveValue) {
+				patch[k] = desiredValue
+				*drifted = append(*drifted, fieldPath)
+			}
+		}
+	}
+
+	for k := range lastApplied {
+		if _, wanted := desired[k]; wanted {
+			continue
+		}
+
+		if _, found := live[k]; found {
+			patch[k] = nil
+			*drifted = append(*drifted, path+"."+k)
+		}
+	}
+
+	return patch
+}
+
+// diffLists handles lists of objects keyed by "name" (containers, volumes,
+// env...) element by element, any other list is treated as atomic
+func diffLists(lastApplied, desired, live []interface{}, path string, drifted *[]string) ([]interface{}, bool) {
+	if !isNamedList(desired) {
+		if len(desired) != len(live) {
+			*drifted = append(*drifted, path)
+			return desired, true
+		}
+
+		for i := range desired {
+			d, dOk := desired[i].(map[string]interface{})
+			l, lOk := live[i].(map[string]interface{})
+
+			if dOk && lOk {
+				var ignored []string
+				if len(diffMaps(nil, d, l, "", &ignored)) == 0 {
+					continue
+				}
+			} else if reflect.DeepEqual(desired[i], live[i]) {
+				continue
+			}
+
+			*drifted = append(*drifted, path)
+			return desired, true
+		}
+
+		return nil, false
+	}
+
+	changed := false
+	patch := make([]interface{}, 0, len(desired))
+	wanted := map[interface{}]bool{}
+
+	for _, item := range desired {
+		d := item.(map[string]interface{})
+		name := d["name"]
+		wanted[name] = true
+		itemPath := fmt.Sprintf("%s[%v]", path, name)
+
+		l := findNamed(live, name)
+		if l == nil {
+			changed = true
+			*drifted = append(*drifted, itemPath)
+			patch = append(patch, d)
+			continue
+		}
+
+		sub := diffMaps(findNamed(lastApplied, name), d, l, itemPath, drifted)
+		if len(sub) > 0 {
+			changed = true
+		}
+
+		// Always send every element we own, if the list happens to be atomic
+		// on the server side a partial list would drop the others
+		patch = append(patch, overlay(d, sub))
+	}
+
+	for _, item := range lastApplied {
+		la, ok := item.(map[string]interface{})
+		if !ok || wanted[la["name"]] || findNamed(live, la["name"]) == nil {
+			continue
+		}
+
+		changed = true
+		*drifted = append(*drifted, fmt.Sprintf("%s[%v]", path, la["name"]))
+
+		directive := map[string]interface{}{"$patch": "delete"}
+		for k, v := range la {
+			directive[k] = v
+		}
+
+		patch = append(patch, directive)
+	}
+
+	return patch, changed
+}
+
+func isNamedList(list []interface{}) bool {
+	if len(list) == 0 {
+		return false
+	}
+
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		if _, ok := m["name"]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func findNamed(list []interface{}, name interface{}) map[string]interface{} {
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok && m["name"] == name {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// overlay copies base and applies the patch on top of it, so removals found
+// by diffMaps (nil values) survive in the element we send
+func overlay(base, patch map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		out[k] = v
+	}
+
+	for k, v := range patch {
+		b, bOk := out[k].(map[string]interface{})
+		p, pOk := v.(map[string]interface{})
+		if bOk && pOk {
+			out[k] = overlay(b, p)
+			continue
+		}
+
+		out[k] = v
+	}
+
+	return out
+}
+
+// strategicMergeSupported tells whether the API server takes strategic merge
+// patches for a kind, it only does for the built-in types. Custom resources
+// such as the ServiceMonitor are refused with 415 Unsupported Media Type.
+func strategicMergeSupported(gvk schema.GroupVersionKind) bool {
+	return scheme.Scheme.Recognizes(gvk)
+}
+
+// mergePatch turns a patch made by diffMaps into a JSON merge patch: lists
+// can't be merged by name there, every list that changed is sent whole.
+func mergePatch(patch, desired map[string]interface{}) map[string]interface{} {
+	merge := map[string]interface{}{}
+	for key, value := range patch {
+		switch value.(type) {
+		case map[string]interface{}:
+			desiredValue, _ := desired[key].(map[string]interface{})
+			merge[key] = mergePatch(value.(map[string]interface{}), desiredValue)
+		case []interface{}:
+			merge[key] = desired[key]
+		default:
+			merge[key] = value
+		}
+	}
+
+	return merge
+}
@@ -0,0 +1,199 @@
+package stub
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+)
+
+func testRedis() *v1alpha2.Redis {
+	redis := &v1alpha2.Redis{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       "Redis",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cache",
+			Namespace: "default",
+			UID:       "uid",
+		},
+	}
+	redis.Spec.Topology.Replicas = 2
+	redis.Spec.Persistence = &v1alpha2.RedisPersistence{}
+	redis.SetDefaults()
+	return redis
+}
+
+// liveObject is desired as the API server hands it back: decoded by the
+// unstructured scheme and with fields the server defaults
+func liveObject(t *testing.T, desired runtime.Object) map[string]interface{} {
+	raw, err := json.Marshal(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	object, _, err := unstructured.UnstructuredJSONScheme.Decode(raw, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live := object.(*unstructured.Unstructured).Object
+	unstructured.SetNestedField(live, int64(600), "spec", "progressDeadlineSeconds")
+	unstructured.SetNestedField(live, "ClusterFirst", "spec", "template", "spec", "dnsPolicy")
+	unstructured.SetNestedField(live, map[string]interface{}{"readyReplicas": int64(3)}, "status")
+	return live
+}
+
+// lastApplied is desired as it's read back from the annotation
+func lastApplied(t *testing.T, desired map[string]interface{}) map[string]interface{} {
+	raw, err := json.Marshal(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]interface{}
+	err = utiljson.Unmarshal(raw, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestDiffMapsUnchangedChild(t *testing.T) {
+	redis := testRedis()
+	redis.Spec.Scheduling.TopologySpreadConstraints = []v1alpha2.TopologySpreadConstraint{
+		{MaxSkew: 1, TopologyKey: "zone", WhenUnsatisfiable: "ScheduleAnyway"},
+	}
+
+	sts, err := getStatefulSetDefinition(redis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, object := range []runtime.Object{sts, getServiceDefinition(redis)} {
+		desired, err := toMap(object)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var drifted []string
+		patch := diffMaps(lastApplied(t, desired), desired, liveObject(t, object), "", &drifted)
+		if len(patch) != 0 {
+			t.Errorf("%T: got patch %v for drifted %v, want none", object, patch, drifted)
+		}
+	}
+
+	desired, err := withTopologySpread(redis, sts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desiredMap, err := toMap(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var drifted []string
+	patch := diffMaps(lastApplied(t, desiredMap), desiredMap, liveObject(t, desired), "", &drifted)
+	if len(patch) != 0 {
+		t.Errorf("topology spread: got patch %v for drifted %v, want none", patch, drifted)
+	}
+}
+
+func TestDiffMaps(t *testing.T) {
+	tests := []struct {
+		name        string
+		lastApplied string
+		desired     string
+		live        string
+		patch       string
+		drifted     []string
+	}{
+		{
+			name:        "drifted number",
+			lastApplied: `{"spec":{"replicas":3}}`,
+			desired:     `{"spec":{"replicas":3}}`,
+			live:        `{"spec":{"replicas":1}}`,
+			patch:       `{"spec":{"replicas":3}}`,
+			drifted:     []string{".spec.replicas"},
+		},
+		{
+			name:        "fields set by others are left alone",
+			lastApplied: `{"spec":{"replicas":3}}`,
+			desired:     `{"spec":{"replicas":3}}`,
+			live:        `{"spec":{"replicas":3,"paused":true}}`,
+			patch:       `{}`,
+		},
+		{
+			name:        "field no longer set is removed",
+			lastApplied: `{"metadata":{"labels":{"a":"1","b":"2"}}}`,
+			desired:     `{"metadata":{"labels":{"a":"1"}}}`,
+			live:        `{"metadata":{"labels":{"a":"1","b":"2"}}}`,
+			patch:       `{"metadata":{"labels":{"b":null}}}`,
+			drifted:     []string{".metadata.labels.b"},
+		},
+		{
+			name:    "missing map",
+			desired: `{"metadata":{"annotations":{"a":"1"}}}`,
+			live:    `{"metadata":{}}`,
+			patch:   `{"metadata":{"annotations":{"a":"1"}}}`,
+			drifted: []string{".metadata.annotations"},
+		},
+		{
+			name:        "named list element removed",
+			lastApplied: `{"containers":[{"name":"redis","image":"redis"},{"name":"exporter","image":"exporter"}]}`,
+			desired:     `{"containers":[{"name":"redis","image":"redis"}]}`,
+			live:        `{"containers":[{"name":"redis","image":"redis"},{"name":"exporter","image":"exporter"}]}`,
+			patch:       `{"containers":[{"name":"redis","image":"redis"},{"$patch":"delete","name":"exporter","image":"exporter"}]}`,
+			drifted:     []string{".containers[exporter]"},
+		},
+		{
+			name:    "named list element drifted",
+			desired: `{"containers":[{"name":"redis","image":"redis:5"}]}`,
+			live:    `{"containers":[{"name":"redis","image":"redis:4","imagePullPolicy":"Always"}]}`,
+			patch:   `{"containers":[{"name":"redis","image":"redis:5"}]}`,
+			drifted: []string{".containers[redis].image"},
+		},
+		{
+			name:    "atomic list",
+			desired: `{"args":["a","b"]}`,
+			live:    `{"args":["a"]}`,
+			patch:   `{"args":["a","b"]}`,
+			drifted: []string{".args"},
+		},
+	}
+
+	decode := func(s string) map[string]interface{} {
+		if s == "" {
+			return nil
+		}
+
+		var m map[string]interface{}
+		err := utiljson.Unmarshal([]byte(s), &m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return m
+	}
+
+	for _, test := range tests {
+		var drifted []string
+		patch := diffMaps(decode(test.lastApplied), decode(test.desired), decode(test.live), "", &drifted)
+
+		if want := decode(test.patch); !reflect.DeepEqual(patch, want) {
+			t.Errorf("%s: got patch %v, want %v", test.name, patch, want)
+		}
+
+		if !reflect.DeepEqual(drifted, test.drifted) {
+			t.Errorf("%s: got drifted %v, want %v", test.name, drifted, test.drifted)
+		}
+	}
+}
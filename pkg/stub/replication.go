@@ -0,0 +1,343 @@
+package stub
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/flexshopper/redis-operator/pkg/redisclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// roleLabel is kept on the pods by the operator, the Services select on it
+	roleLabel   = "redis-role"
+	roleMaster  = "master"
+	roleReplica = "replica"
+	// roleSlave is how INFO replication names a replica
+	roleSlave = "slave"
+)
+
+func replicationEnabled(redis *v1alpha2.Redis) bool {
+	return redis.Spec.Topology.Replicas > 0
+}
+
+// redisNode is a pod along with what it reported in INFO replication
+type redisNode struct {
+	pod  *corev1.Pod
+	info map[string]string
+}
+
+func (n *redisNode) addr(port int32) string {
+	return net.JoinHostPort(n.pod.Status.PodIP, strconv.Itoa(int(port)))
+}
+
+func (n *redisNode) ordinal() int {
+	i := strings.LastIndex(n.pod.Name, "-")
+	ordinal, err := strconv.Atoi(n.pod.Name[i+1:])
+	if err != nil {
+		return -1
+	}
+
+	return ordinal
+}
+
+// fromDeployment tells whether the pod belongs to a Deployment being
+// replaced by the StatefulSet
+func (n *redisNode) fromDeployment() bool {
+	owner := metav1.GetControllerOf(n.pod)
+	return owner != nil && owner.Kind == "ReplicaSet"
+}
+
+func (n *redisNode) offset() int64 {
+	offset, _ := strconv.ParseInt(n.info["slave_repl_offset"], 10, 64)
+	return offset
+}
+
+func getReadServiceDefinition(redis *v1alpha2.Redis) *corev1.Service {
+	svc := getServiceDefinition(redis)
+	svc.Name = redis.Name + "-read"
+	svc.Spec.Selector = redisLabels(redis.Name)
+	svc.Spec.Selector[roleLabel] = roleReplica
+
+	return svc
+}
+
+// createOrUpdateReadService keeps the <name>-read Service around only while
+// there are replicas to balance over
+func createOrUpdateReadService(redis *v1alpha2.Redis) error {
+	svc := getReadServiceDefinition(redis)
+
+	if !replicationEnabled(redis) {
+		return deleteUnusedChild(svc)
+	}
+
+	_, err := reconcileObject(svc)
+	return err
+}
+
+func listRedisPods(redis *v1alpha2.Redis) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+	}
+
+	selector := labels.SelectorFromSet(getCombinedLabels(redis.Name)).String()
+	err := sdk.List(redis.Namespace, podList, sdk.WithListOptions(&metav1.ListOptions{LabelSelector: selector}))
+	if err != nil {
+		return nil, err
+	}
+
+	return podList.Items, nil
+}
+
+// getRedisNodes connects to every running redis pod, pods that can't be
+// reached are returned without info
+func getRedisNodes(redis *v1alpha2.Redis, password string) ([]*redisNode, error) {
+	pods, err := listRedisPods(redis)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*redisNode
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		node := &redisNode{pod: pod}
+		nodes = append(nodes, node)
+
+		client, err := redisclient.Dial(node.addr(redis.Spec.Port), password)
+		if err != nil {
+			logrus.Warnf("failed to connect to redis pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+
+		node.info, err = client.Info("replication")
+		client.Close()
+		if err != nil {
+			logrus.Warnf("failed to read replication info of %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ordinal() < nodes[j].ordinal() })
+	return nodes, nil
+}
+
+// pickMaster keeps the current master while it's healthy, otherwise promotes
+// the replica that got furthest in the replication stream. Without
+// persistence the pods start as replicas of nothing, so a master that
+// restarted empty is replaced like a lost one, and its replicas keep their
+// data meanwhile. On a fresh StatefulSet it's the pod of the Deployment it
+// replaces, which holds the data, or else the first pod.
+func pickMaster(nodes []*redisNode) *redisNode {
+	var master, best *redisNode
+	for _, node := range nodes {
+		if node.info == nil {
+			// don't fail over just because we can't reach the master
+			if node.pod.Labels[roleLabel] == roleMaster {
+				return nil
+			}
+
+			continue
+		}
+
+		if node.pod.Labels[roleLabel] == roleMaster && node.info["role"] == roleMaster {
+			master = node
+		}
+
+		if node.info["role"] == roleSlave && (best == nil || node.offset() > best.offset()) {
+			best = node
+		}
+	}
+
+	if master != nil {
+		return master
+	}
+
+	if best != nil && best.offset() > 0 {
+		return best
+	}
+
+	for _, node := range nodes {
+		if node.info != nil && node.fromDeployment() && node.info["role"] == roleMaster {
+			return node
+		}
+	}
+
+	if best != nil {
+		return best
+	}
+
+	for _, node := range nodes {
+		if node.info != nil {
+			return node
+		}
+	}
+
+	return nil
+}
+
+// findMaster defers to sentinel once it monitors the instance, the operator
+// only picks the master itself to bootstrap it. While sentinel is failing
+// over there is no master and nothing gets rewired.
+func findMaster(redis *v1alpha2.Redis, password string, nodes []*redisNode) (*redisNode, error) {
+	if !sentinelEnabled(redis) {
+		return pickMaster(nodes), nil
+	}
+
+	masterIP, err := getSentinelMaster(redis, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if masterIP == "" {
+		return pickMaster(nodes), nil
+	}
+
+	for _, node := range nodes {
+		if node.pod.Status.PodIP == masterIP && node.info != nil && node.info["role"] == roleMaster {
+			return node, nil
+		}
+	}
+
+	logrus.Infof("waiting for sentinel to promote a master for %s/%s", redis.Namespace, redis.Name)
+	return nil, nil
+}
+
+// reconcileReplication wires every pod to the master with SLAVEOF and keeps
+// the role labels the Services select on in sync. Without replicas there's
+// still the pod of a Deployment to take over from.
+func reconcileReplication(r *v1alpha2.Redis) ([]v1alpha2.RedisNodeStatus, error) {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	if !usesStatefulSet(redis) {
+		return nil, nil
+	}
+
+	password, err := getPassword(redis)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := getRedisNodes(redis, password)
+	if err != nil {
+		return nil, err
+	}
+
+	master, err := findMaster(redis, password, nodes)
+	if err != nil {
+		return getNodesStatus(nodes), err
+	}
+
+	if master != nil {
+		err = wireReplication(redis, password, master, nodes)
+		if err == nil && sentinelEnabled(redis) {
+			err = ensureSentinelMonitor(redis, password, master)
+		}
+
+		if err != nil {
+			return getNodesStatus(nodes), err
+		}
+	}
+
+	return getNodesStatus(nodes), nil
+}
+
+func wireReplication(redis *v1alpha2.Redis, password string, master *redisNode, nodes []*redisNode) error {
+	port := strconv.Itoa(int(redis.Spec.Port))
+
+	for _, node := range nodes {
+		if node.info == nil {
+			continue
+		}
+
+		role := roleReplica
+		var command []string
+
+		if node == master {
+			role = roleMaster
+			if node.info["role"] != roleMaster {
+				command = []string{"SLAVEOF", "NO", "ONE"}
+			}
+		} else if node.info["role"] != roleSlave ||
+			node.info["master_host"] != master.pod.Status.PodIP ||
+			node.info["master_port"] != port {
+			command = []string{"SLAVEOF", master.pod.Status.PodIP, port}
+		}
+
+		if command != nil {
+			logrus.Infof("running %s on redis pod %s/%s", strings.Join(command, " "), node.pod.Namespace, node.pod.Name)
+			err := runCommand(node.addr(redis.Spec.Port), password, command...)
+			if err != nil {
+				return fmt.Errorf("failed to configure replication on %s: %v", node.pod.Name, err)
+			}
+		}
+
+		err := setPodRole(node.pod, role)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runCommand(addr, password string, command ...string) error {
+	client, err := redisclient.Dial(addr, password)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	_, err = client.Do(command...)
+	return err
+}
+
+func setPodRole(pod *corev1.Pod, role string) error {
+	if pod.Labels[roleLabel] == role {
+		return nil
+	}
+
+	pod.TypeMeta = metav1.TypeMeta{
+		APIVersion: "v1",
+		Kind:       "Pod",
+	}
+
+	patch := fmt.Sprintf(`{"metadata":{"labels":{%q:%q}}}`, roleLabel, role)
+	err := sdk.Patch(pod, types.MergePatchType, []byte(patch))
+	observeAPICall(pod, "patch", err)
+	return err
+}
+
+func getNodesStatus(nodes []*redisNode) []v1alpha2.RedisNodeStatus {
+	var statuses []v1alpha2.RedisNodeStatus
+	for _, node := range nodes {
+		status := v1alpha2.RedisNodeStatus{
+			Name: node.pod.Name,
+			IP:   node.pod.Status.PodIP,
+		}
+
+		if node.info != nil {
+			status.Role = node.info["role"]
+			status.MasterLinkStatus = node.info["master_link_status"]
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
@@ -0,0 +1,124 @@
+package stub
+
+import (
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testNode(name, label, role string, offset int) *redisNode {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{},
+		},
+	}
+
+	if label != "" {
+		pod.Labels[roleLabel] = label
+	}
+
+	node := &redisNode{pod: pod}
+	if role != "" {
+		node.info = map[string]string{
+			"role":              role,
+			"slave_repl_offset": strconv.Itoa(offset),
+		}
+	}
+
+	return node
+}
+
+func deploymentNode(node *redisNode) *redisNode {
+	controller := true
+	node.pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "cache-5d8f", Controller: &controller}}
+	return node
+}
+
+func TestPickMaster(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []*redisNode
+		want  string
+	}{
+		{
+			name: "healthy master",
+			nodes: []*redisNode{
+				testNode("cache-0", roleMaster, roleMaster, 0),
+				testNode("cache-1", roleReplica, roleSlave, 100),
+			},
+			want: "cache-0",
+		},
+		{
+			name: "unreachable master",
+			nodes: []*redisNode{
+				testNode("cache-0", roleMaster, "", 0),
+				testNode("cache-1", roleReplica, roleSlave, 100),
+			},
+		},
+		{
+			// it came back as a replica of nothing, the replicas it refused
+			// still have the data
+			name: "master restarted empty",
+			nodes: []*redisNode{
+				testNode("cache-0", roleMaster, roleSlave, 0),
+				testNode("cache-1", roleReplica, roleSlave, 90),
+				testNode("cache-2", roleReplica, roleSlave, 100),
+			},
+			want: "cache-2",
+		},
+		{
+			name: "master restarted, replicas never synced",
+			nodes: []*redisNode{
+				testNode("cache-0", roleMaster, roleSlave, 0),
+				testNode("cache-1", roleReplica, roleSlave, 0),
+			},
+			want: "cache-0",
+		},
+		{
+			name: "master pod gone",
+			nodes: []*redisNode{
+				testNode("cache-1", roleReplica, roleSlave, 100),
+				testNode("cache-2", roleReplica, roleSlave, 120),
+			},
+			want: "cache-2",
+		},
+		{
+			name: "fresh instance",
+			nodes: []*redisNode{
+				testNode("cache-0", "", roleSlave, 0),
+				testNode("cache-1", "", roleSlave, 0),
+			},
+			want: "cache-0",
+		},
+		{
+			name: "fresh instance with persistence",
+			nodes: []*redisNode{
+				testNode("cache-0", "", roleMaster, 0),
+				testNode("cache-1", "", roleMaster, 0),
+			},
+			want: "cache-0",
+		},
+		{
+			name: "StatefulSet replacing a Deployment",
+			nodes: []*redisNode{
+				testNode("cache-0", "", roleSlave, 0),
+				deploymentNode(testNode("cache-5d8f-x2x9q", "", roleMaster, 0)),
+			},
+			want: "cache-5d8f-x2x9q",
+		},
+	}
+
+	for _, test := range tests {
+		got := ""
+		if master := pickMaster(test.nodes); master != nil {
+			got = master.pod.Name
+		}
+
+		if got != test.want {
+			t.Errorf("%s: got master %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package stub
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/flexshopper/redis-operator/pkg/redisclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	reshardStepPromoting = "PromotingReplicas"
+	reshardStepMigrating = "MigratingSlots"
+	reshardStepRemoving  = "RemovingNodes"
+
+	// reshardBudget bounds the time one reconcile spends moving keys, every
+	// other Redis waits on the handler meanwhile. A slot still migrating is
+	// picked up by finishStuckSlots on the next resync.
+	reshardBudget = 2 * time.Second
+	// migrateBatch is the number of keys moved per MIGRATE
+	migrateBatch   = 100
+	migrateTimeout = 10 * time.Second
+)
+
+// slotMove is a slot going from one node to another
+type slotMove struct {
+	slot int
+	from string
+	to   string
+}
+
+// keptClusterViews are the pods the StatefulSet keeps at
+// spec.topology.shards, the others are drained before it's scaled down
+func keptClusterViews(redis *v1alpha2.Redis, views []*clusterView) []*clusterView {
+	var kept []*clusterView
+	for _, view := range views {
+		ordinal := view.node.ordinal()
+		if ordinal >= 0 && ordinal < int(clusterSize(redis)) {
+			kept = append(kept, view)
+		}
+	}
+
+	return kept
+}
+
+func viewByID(views []*clusterView, id string) *clusterView {
+	for _, view := range views {
+		if view.myself().ID == id {
+			return view
+		}
+	}
+
+	return nil
+}
+
+// reshardCluster moves slots until spec.topology.shards masters serve an even
+// share of them. Slots an earlier run left migrating or importing are finished
+// first, so nothing is stuck after an operator restart.
+func reshardCluster(redis *v1alpha2.Redis, password string, seed *clusterView, views []*clusterView,
+	previous *v1alpha2.RedisReshardStatus) (*v1alpha2.RedisReshardStatus, error) {
+	progress := &v1alpha2.RedisReshardStatus{Shards: redis.Spec.Topology.Shards}
+	if previous != nil && previous.Shards == redis.Spec.Topology.Shards {
+		progress.SlotsMoved = previous.SlotsMoved
+		progress.KeysMigrated = previous.KeysMigrated
+	}
+
+	deadline := time.Now().Add(reshardBudget)
+	stuck, err := finishStuckSlots(redis, password, views, progress, deadline)
+	if err != nil || stuck {
+		return progress, err
+	}
+
+	kept := keptClusterViews(redis, views)
+	targets, promoted, err := pickShardMasters(redis, password, seed, kept)
+	if err != nil {
+		return progress, err
+	}
+
+	if promoted {
+		progress.Step = reshardStepPromoting
+		return progress, nil
+	}
+
+	moves := planSlotMoves(seed, targets)
+	if len(moves) == 0 {
+		if len(kept) < len(views) {
+			progress.Step = reshardStepRemoving
+			return progress, nil
+		}
+
+		return nil, nil
+	}
+
+	progress.Step = reshardStepMigrating
+	progress.SlotsRemaining = int32(len(moves))
+	logrus.Infof("resharding %s/%s to %d shards, %d slots to move",
+		redis.Namespace, redis.Name, redis.Spec.Topology.Shards, len(moves))
+
+	for _, move := range moves {
+		if time.Now().After(deadline) {
+			break
+		}
+
+		keys, done, err := migrateSlot(redis, password, views, move, deadline)
+		progress.KeysMigrated += keys
+		if err != nil || !done {
+			return progress, err
+		}
+
+		progress.SlotsMoved++
+		progress.SlotsRemaining--
+	}
+
+	return progress, nil
+}
+
+// finishStuckSlots completes the slots some node reports as migrating or
+// importing, or marks them stable again when the other end is gone
+func finishStuckSlots(redis *v1alpha2.Redis, password string, views []*clusterView,
+	progress *v1alpha2.RedisReshardStatus, deadline time.Time) (bool, error) {
+	var moves []slotMove
+	seen := map[int]bool{}
+
+	for _, view := range views {
+		myself := view.myself()
+		for slot, to := range myself.Migrating {
+			moves = append(moves, slotMove{slot: slot, from: myself.ID, to: to})
+			seen[slot] = true
+		}
+	}
+
+	for _, view := range views {
+		myself := view.myself()
+		for slot, from := range myself.Importing {
+			if !seen[slot] {
+				moves = append(moves, slotMove{slot: slot, from: from, to: myself.ID})
+			}
+		}
+	}
+
+	if len(moves) == 0 {
+		return false, nil
+	}
+
+	progress.Step = reshardStepMigrating
+	for _, move := range moves {
+		from := viewByID(views, move.from)
+		to := viewByID(views, move.to)
+
+		if from == nil || to == nil {
+			// one end is gone, nothing left to finish
+			for _, view := range []*clusterView{from, to} {
+				if view == nil {
+					continue
+				}
+
+				logrus.Warnf("marking slot %d of %s stable, the other end is gone", move.slot, view.node.pod.Name)
+				err := runCommand(view.node.addr(redis.Spec.Port), password,
+					"CLUSTER", "SETSLOT", strconv.Itoa(move.slot), "STABLE")
+				if err != nil {
+					return true, err
+				}
+			}
+
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return true, nil
+		}
+
+		logrus.Infof("resuming migration of slot %d from %s to %s", move.slot, from.node.pod.Name, to.node.pod.Name)
+		keys, done, err := migrateSlot(redis, password, views, move, deadline)
+		progress.KeysMigrated += keys
+		if err != nil || !done {
+			return true, err
+		}
+
+		progress.SlotsMoved++
+	}
+
+	return true, nil
+}
+
+// pickShardMasters returns the kept masters that should serve the slots,
+// the ones serving the most slots already first. When too few masters are
+// kept, replicas of masters about to be removed are promoted instead of
+// moving their data.
+func pickShardMasters(redis *v1alpha2.Redis, password string, seed *clusterView,
+	kept []*clusterView) ([]*clusterView, bool, error) {
+	shards := int(redis.Spec.Topology.Shards)
+
+	var owners, empty []*clusterView
+	keptIDs := map[string]bool{}
+	for _, view := range kept {
+		myself := view.myself()
+		keptIDs[myself.ID] = true
+
+		if myself.IsMaster() && len(myself.Slots) > 0 {
+			owners = append(owners, view)
+		} else if emptyMaster(seed, view) {
+			empty = append(empty, view)
+		}
+	}
+
+	// the masters serving the most slots stay, the least data moves
+	sort.SliceStable(owners, func(i, j int) bool {
+		return owners[i].myself().SlotCount() > owners[j].myself().SlotCount()
+	})
+
+	targets := append(owners, empty...)
+	if len(targets) >= shards {
+		return targets[:shards], false, nil
+	}
+
+	promoted := false
+	for _, view := range kept {
+		master := seed.lookup(view.myself().MasterID)
+		if master == nil || keptIDs[master.ID] || len(master.Slots) == 0 || master.Failing() {
+			continue
+		}
+
+		logrus.Infof("promoting %s/%s, its master is being removed", view.node.pod.Namespace, view.node.pod.Name)
+		err := runCommand(view.node.addr(redis.Spec.Port), password, "CLUSTER", "FAILOVER")
+		if err != nil {
+			return nil, promoted, fmt.Errorf("failed to promote %s: %v", view.node.pod.Name, err)
+		}
+
+		// a master is only taken over once
+		keptIDs[master.ID] = true
+		promoted = true
+	}
+
+	if promoted {
+		return nil, true, nil
+	}
+
+	return nil, false, fmt.Errorf("only %d of %d shard masters available", len(targets), shards)
+}
+
+// planSlotMoves evens the slots out over targets: nodes that aren't targets
+// give all of theirs away, targets above their share give their highest
+// slots. The targets serving the most slots keep the larger shares so a
+// balanced cluster plans no moves.
+func planSlotMoves(seed *clusterView, targets []*clusterView) []slotMove {
+	owners := slotOwners(seed)
+	shards := len(targets)
+
+	quota := map[string]int{}
+	count := map[string]int{}
+	for _, owner := range owners {
+		count[owner]++
+	}
+
+	targets = append([]*clusterView(nil), targets...)
+	sort.SliceStable(targets, func(i, j int) bool {
+		return count[targets[i].myself().ID] > count[targets[j].myself().ID]
+	})
+
+	for i, target := range targets {
+		quota[target.myself().ID] = redisclient.ClusterSlots / shards
+		if i < redisclient.ClusterSlots%shards {
+			quota[target.myself().ID]++
+		}
+	}
+
+	var moves []slotMove
+	for slot := 0; slot < redisclient.ClusterSlots; slot++ {
+		if _, target := quota[owners[slot]]; !target {
+			moves = append(moves, slotMove{slot: slot, from: owners[slot]})
+		}
+	}
+
+	for slot := redisclient.ClusterSlots - 1; slot >= 0; slot-- {
+		owner := owners[slot]
+		if q, target := quota[owner]; target && count[owner] > q {
+			moves = append(moves, slotMove{slot: slot, from: owner})
+			count[owner]--
+		}
+	}
+
+	i := 0
+	for _, target := range targets {
+		id := target.myself().ID
+		for ; count[id] < quota[id] && i < len(moves); i++ {
+			moves[i].to = id
+			count[id]++
+		}
+	}
+
+	return moves[:i]
+}
+
+// migrateSlot runs the SETSLOT IMPORTING, MIGRATING, MIGRATE, SETSLOT NODE
+// sequence. Clients are redirected with ASK while the keys move, and every
+// step tolerates having been done already.
+func migrateSlot(redis *v1alpha2.Redis, password string, views []*clusterView, move slotMove,
+	deadline time.Time) (int64, bool, error) {
+	from := viewByID(views, move.from)
+	to := viewByID(views, move.to)
+	if from == nil || to == nil {
+		return 0, false, fmt.Errorf("can't move slot %d, node %s or %s is unreachable", move.slot, move.from, move.to)
+	}
+
+	slot := strconv.Itoa(move.slot)
+	fromAddr := from.node.addr(redis.Spec.Port)
+	toAddr := to.node.addr(redis.Spec.Port)
+
+	err := runCommand(toAddr, password, "CLUSTER", "SETSLOT", slot, "IMPORTING", move.from)
+	if err != nil && !strings.Contains(err.Error(), "already the owner") {
+		return 0, false, fmt.Errorf("failed to import slot %d on %s: %v", move.slot, to.node.pod.Name, err)
+	}
+
+	owner := true
+	err = runCommand(fromAddr, password, "CLUSTER", "SETSLOT", slot, "MIGRATING", move.to)
+	if err != nil {
+		if !strings.Contains(err.Error(), "not the owner") {
+			return 0, false, fmt.Errorf("failed to migrate slot %d on %s: %v", move.slot, from.node.pod.Name, err)
+		}
+
+		owner = false
+	}
+
+	var keys int64
+	if owner {
+		done := false
+		keys, done, err = migrateKeys(redis, password, from, to, slot, deadline)
+		if err != nil || !done {
+			return keys, false, err
+		}
+	}
+
+	// the new owner first, so it never points the slot back at the old one
+	for _, view := range []*clusterView{to, from} {
+		err = runCommand(view.node.addr(redis.Spec.Port), password, "CLUSTER", "SETSLOT", slot, "NODE", move.to)
+		if err != nil {
+			return keys, false, fmt.Errorf("failed to assign slot %d on %s: %v", move.slot, view.node.pod.Name, err)
+		}
+	}
+
+	// the others learn about it through gossip, telling them speeds it up
+	for _, view := range views {
+		myself := view.myself()
+		if view == to || view == from || !myself.IsMaster() {
+			continue
+		}
+
+		err = runCommand(view.node.addr(redis.Spec.Port), password, "CLUSTER", "SETSLOT", slot, "NODE", move.to)
+		if err != nil {
+			logrus.Warnf("failed to announce slot %d to %s: %v", move.slot, view.node.pod.Name, err)
+		}
+	}
+
+	return keys, true, nil
+}
+
+// migrateKeys moves the keys of slot in batches until none is left or the
+// deadline passes, it tells whether the slot is empty
+func migrateKeys(redis *v1alpha2.Redis, password string, from, to *clusterView, slot string,
+	deadline time.Time) (int64, bool, error) {
+	client, err := redisclient.Dial(from.node.addr(redis.Spec.Port), password)
+	if err != nil {
+		return 0, false, err
+	}
+	defer client.Close()
+
+	client.SetTimeout(migrateTimeout)
+
+	var migrated int64
+	for {
+		reply, err := client.Do("CLUSTER", "GETKEYSINSLOT", slot, strconv.Itoa(migrateBatch))
+		if err != nil {
+			return migrated, false, err
+		}
+
+		keys, _ := reply.([]interface{})
+		if len(keys) == 0 {
+			return migrated, true, nil
+		}
+
+		if time.Now().After(deadline) {
+			logrus.Infof("pausing migration of slot %s to %s, %d keys moved", slot, to.node.pod.Name, migrated)
+			return migrated, false, nil
+		}
+
+		command := []string{
+			"MIGRATE", to.node.pod.Status.PodIP, strconv.Itoa(int(redis.Spec.Port)), "", "0",
+			strconv.Itoa(int(migrateTimeout / time.Millisecond)), "REPLACE",
+		}
+
+		if password != "" {
+			command = append(command, "AUTH", password)
+		}
+
+		command = append(command, "KEYS")
+		for _, key := range keys {
+			k, _ := key.(string)
+			command = append(command, k)
+		}
+
+		_, err = client.Do(command...)
+		if err != nil {
+			return migrated, false, fmt.Errorf("failed to migrate keys of slot %s to %s: %v", slot, to.node.pod.Name, err)
+		}
+
+		migrated += int64(len(keys))
+	}
+}
+
+// keepClusterNodes holds a StatefulSet scale down back until the pods that
+// would be removed don't serve any slot anymore
+func keepClusterNodes(redis *v1alpha2.Redis, sts *v1.StatefulSet) error {
+	live := sts.DeepCopy()
+	err := sdk.Get(live)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if live.Spec.Replicas == nil || *live.Spec.Replicas <= *sts.Spec.Replicas {
+		return nil
+	}
+
+	password, err := getPassword(redis)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := getRedisNodes(redis, password)
+	if err != nil {
+		return err
+	}
+
+	views := getClusterViews(redis, password, nodes)
+	reachable := map[string]bool{}
+	for _, view := range views {
+		reachable[view.node.pod.Name] = true
+	}
+
+	for _, node := range nodes {
+		if node.ordinal() < int(*sts.Spec.Replicas) {
+			continue
+		}
+
+		drained := reachable[node.pod.Name]
+		for _, view := range views {
+			if view.node == node && len(view.myself().Slots) > 0 {
+				drained = false
+			}
+		}
+
+		if !drained {
+			logrus.Infof("keeping %d cluster nodes of %s/%s until %s is drained",
+				*live.Spec.Replicas, redis.Namespace, redis.Name, node.pod.Name)
+			sts.Spec.Replicas = live.Spec.Replicas
+			return nil
+		}
+	}
+
+	return nil
+}
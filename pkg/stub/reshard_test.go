@@ -0,0 +1,169 @@
+package stub
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/redisclient"
+)
+
+// testClusterView is the view of a master serving slots
+func testClusterView(id string, slots ...redisclient.SlotRange) *clusterView {
+	return &clusterView{
+		nodes: []*redisclient.ClusterNode{{
+			ID:    id,
+			Flags: map[string]bool{"myself": true, "master": true},
+			Slots: slots,
+		}},
+	}
+}
+
+func TestPlanSlotMoves(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   []*clusterView
+		targets []string
+		// moved counts the moves out of each node, "" for unassigned slots
+		moved map[string]int
+		// slots is how many slots each target serves once moved
+		slots map[string]int
+	}{
+		{
+			name: "balanced",
+			nodes: []*clusterView{
+				testClusterView("a", redisclient.SlotRange{Start: 0, End: 5460}),
+				testClusterView("b", redisclient.SlotRange{Start: 5461, End: 10922}),
+				testClusterView("c", redisclient.SlotRange{Start: 10923, End: 16383}),
+			},
+			targets: []string{"a", "b", "c"},
+			moved:   map[string]int{},
+			slots:   map[string]int{"a": 5461, "b": 5462, "c": 5461},
+		},
+		{
+			name: "balanced, the largest share anywhere",
+			nodes: []*clusterView{
+				testClusterView("a", redisclient.SlotRange{Start: 0, End: 5460}),
+				testClusterView("b", redisclient.SlotRange{Start: 5461, End: 10921}),
+				testClusterView("c", redisclient.SlotRange{Start: 10922, End: 16383}),
+			},
+			targets: []string{"a", "b", "c"},
+			moved:   map[string]int{},
+			slots:   map[string]int{"a": 5461, "b": 5461, "c": 5462},
+		},
+		{
+			name: "scale out",
+			nodes: []*clusterView{
+				testClusterView("a", redisclient.SlotRange{Start: 0, End: 8191}),
+				testClusterView("b", redisclient.SlotRange{Start: 8192, End: 16383}),
+				testClusterView("c"),
+			},
+			targets: []string{"a", "b", "c"},
+			moved:   map[string]int{"a": 2730, "b": 2731},
+			slots:   map[string]int{"a": 5462, "b": 5461, "c": 5461},
+		},
+		{
+			name: "scale in",
+			nodes: []*clusterView{
+				testClusterView("a", redisclient.SlotRange{Start: 0, End: 5460}),
+				testClusterView("b", redisclient.SlotRange{Start: 5461, End: 10922}),
+				testClusterView("c", redisclient.SlotRange{Start: 10923, End: 16383}),
+			},
+			targets: []string{"a", "b"},
+			moved:   map[string]int{"c": 5461},
+			slots:   map[string]int{"a": 8192, "b": 8192},
+		},
+		{
+			name: "scale in to a new node",
+			nodes: []*clusterView{
+				testClusterView("a", redisclient.SlotRange{Start: 0, End: 8191}),
+				testClusterView("b", redisclient.SlotRange{Start: 8192, End: 16383}),
+				testClusterView("c"),
+			},
+			targets: []string{"a", "c"},
+			moved:   map[string]int{"b": 8192},
+			slots:   map[string]int{"a": 8192, "c": 8192},
+		},
+		{
+			name: "unassigned slots",
+			nodes: []*clusterView{
+				testClusterView("a", redisclient.SlotRange{Start: 0, End: 8191}),
+				testClusterView("b"),
+			},
+			targets: []string{"a", "b"},
+			moved:   map[string]int{"": 8192},
+			slots:   map[string]int{"a": 8192, "b": 8192},
+		},
+		{
+			name: "uneven ranges",
+			nodes: []*clusterView{
+				testClusterView("a", redisclient.SlotRange{Start: 0, End: 99}, redisclient.SlotRange{Start: 16000, End: 16383}),
+				testClusterView("b", redisclient.SlotRange{Start: 100, End: 15999}),
+			},
+			targets: []string{"a", "b"},
+			moved:   map[string]int{"b": 7708},
+			slots:   map[string]int{"a": 8192, "b": 8192},
+		},
+	}
+
+	for _, test := range tests {
+		// every node sees the others, the seed is the first one
+		seed := &clusterView{}
+		for _, view := range test.nodes {
+			seed.nodes = append(seed.nodes, view.nodes[0])
+		}
+
+		var targets []*clusterView
+		for _, id := range test.targets {
+			for _, view := range test.nodes {
+				if view.myself().ID == id {
+					targets = append(targets, view)
+				}
+			}
+		}
+
+		moves := planSlotMoves(seed, targets)
+
+		owners := slotOwners(seed)
+		moved := map[string]int{}
+		for _, move := range moves {
+			if move.from != owners[move.slot] {
+				t.Errorf("%s: slot %d moves from %q, owned by %q", test.name, move.slot, move.from, owners[move.slot])
+			}
+
+			if move.from == move.to {
+				t.Errorf("%s: slot %d moves to its owner %q", test.name, move.slot, move.to)
+			}
+
+			moved[move.from]++
+			owners[move.slot] = move.to
+		}
+
+		if !reflect.DeepEqual(moved, test.moved) {
+			t.Errorf("%s: got moves out of %v, want %v", test.name, moved, test.moved)
+		}
+
+		slots := map[string]int{}
+		for slot := 0; slot < redisclient.ClusterSlots; slot++ {
+			slots[owners[slot]]++
+		}
+
+		if !reflect.DeepEqual(slots, test.slots) {
+			t.Errorf("%s: got slots %v, want %v", test.name, slots, test.slots)
+		}
+
+		// the plan applied leaves nothing to move
+		for i, view := range test.nodes {
+			view.nodes[0].Slots = nil
+			for slot := 0; slot < redisclient.ClusterSlots; slot++ {
+				if owners[slot] == view.myself().ID {
+					view.nodes[0].Slots = append(view.nodes[0].Slots, redisclient.SlotRange{Start: slot, End: slot})
+				}
+			}
+			seed.nodes[i] = view.nodes[0]
+		}
+
+		if again := planSlotMoves(seed, targets); len(again) != 0 {
+			t.Errorf("%s: got %d more moves once balanced", test.name, len(again))
+		}
+	}
+}
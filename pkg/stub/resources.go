@@ -0,0 +1,152 @@
+package stub
+
+import (
+	"fmt"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/flexshopper/redis-operator/pkg/memory"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// minMemoryOverheadPercent is the least memory on top of maxmemory a redis
+// container gets away with, below it the kernel kills redis before it
+// evicts anything
+const minMemoryOverheadPercent = 10
+
+// getRedisResources are the resources of the redis container: spec.resources
+// when set, otherwise a memory request and limit derived from maxMemory. An
+// unlimited maxMemory derives nothing.
+func getRedisResources(redis *v1alpha2.Redis) corev1.ResourceRequirements {
+	if redis.Spec.Resources != nil {
+		return *redis.Spec.Resources.DeepCopy()
+	}
+
+	maxMemory, err := memory.Parse(redis.Spec.MaxMemory)
+	if err != nil || maxMemory == 0 {
+		return corev1.ResourceRequirements{}
+	}
+
+	quantity := withOverhead(maxMemory, redis.Spec.MemoryOverheadPercent)
+
+	// the request is the limit, redis grows up to maxmemory anyway
+	return corev1.ResourceRequirements{
+		Limits:   corev1.ResourceList{corev1.ResourceMemory: quantity},
+		Requests: corev1.ResourceList{corev1.ResourceMemory: quantity},
+	}
+}
+
+// keepDerivedMemory keeps the memory derived for the running redis container
+// while maxMemory, with its overhead, still fits in it. maxmemory is hot
+// applied, deriving the memory again would restart every pod for it. When
+// the pods restart for another change they get the memory derived anew.
+func keepDerivedMemory(redis *v1alpha2.Redis, template, live *corev1.PodTemplateSpec) {
+	if redis.Spec.Resources != nil {
+		return
+	}
+
+	current := findContainer(live, redis.Name)
+	if findContainer(template, redis.Name) == nil || current == nil {
+		return
+	}
+
+	limit, ok := current.Resources.Limits[corev1.ResourceMemory]
+	if !ok {
+		return
+	}
+
+	maxMemory, err := memory.Parse(redis.Spec.MaxMemory)
+	if err != nil || maxMemory == 0 {
+		return
+	}
+
+	if limit.Cmp(withOverhead(maxMemory, redis.Spec.MemoryOverheadPercent)) < 0 {
+		return
+	}
+
+	// the runtime settings are kept on their own, see keepRuntimeConfig
+	kept := withLiveRuntimeConfig(template, live)
+	findContainer(kept, redis.Name).Resources = corev1.ResourceRequirements{
+		Limits:   corev1.ResourceList{corev1.ResourceMemory: limit},
+		Requests: corev1.ResourceList{corev1.ResourceMemory: limit},
+	}
+
+	keptMap, err := toMap(kept)
+	if err != nil {
+		return
+	}
+
+	liveMap, err := toMap(live)
+	if err != nil {
+		return
+	}
+
+	var drifted []string
+	if len(diffMaps(nil, keptMap, liveMap, "", &drifted)) > 0 {
+		return
+	}
+
+	*template = *kept
+}
+
+func findContainer(template *corev1.PodTemplateSpec, name string) *corev1.Container {
+	for i := range template.Spec.Containers {
+		if template.Spec.Containers[i].Name == name {
+			return &template.Spec.Containers[i]
+		}
+	}
+
+	return nil
+}
+
+// validateResources makes sure a memory limit set in spec.resources leaves
+// room for the overhead
+func validateResources(r *v1alpha2.Redis) []string {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	var validationErrors []string
+
+	if redis.Spec.MemoryOverheadPercent < minMemoryOverheadPercent {
+		validationErrors = append(validationErrors, fmt.Sprintf(
+			"memoryOverheadPercent ( %d ) must be at least %d", redis.Spec.MemoryOverheadPercent, minMemoryOverheadPercent))
+	}
+
+	if redis.Spec.Resources == nil {
+		return validationErrors
+	}
+
+	limit, ok := redis.Spec.Resources.Limits[corev1.ResourceMemory]
+	if !ok {
+		return validationErrors
+	}
+
+	maxMemory, err := memory.Parse(redis.Spec.MaxMemory)
+	if err != nil {
+		// reported by validateMaxMemory
+		return validationErrors
+	}
+
+	if maxMemory == 0 {
+		validationErrors = append(validationErrors, fmt.Sprintf(
+			"memory limit ( %s ) requires a maxMemory, redis would grow until it's killed", limit.String()))
+		return validationErrors
+	}
+
+	needed := withOverhead(maxMemory, minMemoryOverheadPercent)
+	if limit.Cmp(needed) < 0 {
+		validationErrors = append(validationErrors, fmt.Sprintf(
+			"memory limit ( %s ) is below maxMemory ( %s ) plus %d%% overhead, at least %s",
+			limit.String(), redis.Spec.MaxMemory, minMemoryOverheadPercent, needed.String()))
+	}
+
+	return validationErrors
+}
+
+// withOverhead is maxMemory plus percent, rounded up to whole mebibytes so
+// that the live quantity reads the same as the desired one
+func withOverhead(maxMemory memory.Quantity, percent int32) resource.Quantity {
+	bytes := maxMemory.Bytes() + maxMemory.Bytes()*int64(percent)/100
+	mebibytes := (bytes + int64(memory.Mebibyte) - 1) / int64(memory.Mebibyte)
+	return *resource.NewQuantity(mebibytes*int64(memory.Mebibyte), resource.BinarySI)
+}
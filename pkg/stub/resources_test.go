@@ -0,0 +1,91 @@
+package stub
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestKeepDerivedMemory(t *testing.T) {
+	tests := []struct {
+		name      string
+		live      string
+		maxMemory string
+		image     string
+		resources *corev1.ResourceRequirements
+		want      string
+	}{
+		{name: "lowered", live: "200mb", maxMemory: "100mb", want: "300Mi"},
+		{name: "raised within the limit", live: "200mb", maxMemory: "150mb", want: "300Mi"},
+		{name: "raised past the limit", live: "100mb", maxMemory: "200mb", want: "300Mi"},
+		{name: "unchanged", live: "100mb", maxMemory: "100mb", want: "150Mi"},
+		{name: "rolled anyway", live: "200mb", maxMemory: "100mb", image: "redis:5-alpine", want: "150Mi"},
+		{
+			name:      "explicit resources",
+			live:      "200mb",
+			maxMemory: "100mb",
+			resources: &corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			},
+			want: "1Gi",
+		},
+	}
+
+	for _, test := range tests {
+		live := testRedis()
+		live.Spec.MaxMemory = test.live
+
+		redis := testRedis()
+		redis.Spec.MaxMemory = test.maxMemory
+		redis.Spec.Resources = test.resources
+		if test.image != "" {
+			redis.Spec.Image = test.image
+		}
+
+		liveTemplate, err := getPodTemplateDefinition(live)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		template, err := getPodTemplateDefinition(redis)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keepDerivedMemory(redis, template, liveTemplate)
+
+		limit := findContainer(template, redis.Name).Resources.Limits[corev1.ResourceMemory]
+		if limit.String() != test.want {
+			t.Errorf("%s: got memory limit %s, want %s", test.name, limit.String(), test.want)
+		}
+	}
+}
+
+func TestGetRedisResources(t *testing.T) {
+	redis := testRedis()
+	redis.Spec.MaxMemory = "1gb"
+	redis.Spec.MemoryOverheadPercent = 25
+
+	resources := getRedisResources(redis)
+	for _, list := range []corev1.ResourceList{resources.Limits, resources.Requests} {
+		if quantity := list[corev1.ResourceMemory]; quantity.String() != "1280Mi" {
+			t.Errorf("got memory %s, want 1280Mi", quantity.String())
+		}
+	}
+
+	redis.Spec.Resources = &corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+	}
+
+	resources = getRedisResources(redis)
+	if _, ok := resources.Limits[corev1.ResourceMemory]; ok {
+		t.Errorf("got a memory limit derived next to spec.resources")
+	}
+
+	redis.Spec.Resources = nil
+	redis.Spec.MaxMemory = "0"
+	if resources = getRedisResources(redis); len(resources.Limits) != 0 {
+		t.Errorf("got limits %v for an unlimited maxMemory", resources.Limits)
+	}
+}
@@ -0,0 +1,120 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+)
+
+// hostnameTopologyKey is the node label the default anti-affinity spreads over
+const hostnameTopologyKey = "kubernetes.io/hostname"
+
+// getRedisAffinity is spec.scheduling.affinity, with a preferred pod
+// anti-affinity when it sets none and there's more than one redis pod. It's
+// only preferred so that a cluster with more pods than nodes still schedules.
+func getRedisAffinity(redis *v1alpha2.Redis) *corev1.Affinity {
+	affinity := redis.Spec.Scheduling.Affinity.DeepCopy()
+
+	if !replicationEnabled(redis) && !clusterEnabled(redis) {
+		return affinity
+	}
+
+	if affinity == nil {
+		affinity = &corev1.Affinity{}
+	}
+
+	if affinity.PodAntiAffinity != nil {
+		return affinity
+	}
+
+	affinity.PodAntiAffinity = &corev1.PodAntiAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+			{
+				Weight: 100,
+				PodAffinityTerm: corev1.PodAffinityTerm{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: redisLabels(redis.Name),
+					},
+					TopologyKey: hostnameTopologyKey,
+				},
+			},
+		},
+	}
+
+	return affinity
+}
+
+// withTopologySpread adds spec.scheduling.topologySpreadConstraints to the
+// pod template of a workload. The vendored PodSpec has no room for them, the
+// workload is turned into an unstructured object when there are any.
+func withTopologySpread(redis *v1alpha2.Redis, workload sdk.Object) (sdk.Object, error) {
+	constraints := redis.Spec.Scheduling.TopologySpreadConstraints
+	if len(constraints) == 0 {
+		return workload, nil
+	}
+
+	constraints = append([]v1alpha2.TopologySpreadConstraint(nil), constraints...)
+	for i := range constraints {
+		if constraints[i].LabelSelector == nil {
+			constraints[i].LabelSelector = &metav1.LabelSelector{
+				MatchLabels: redisLabels(redis.Name),
+			}
+		}
+	}
+
+	raw, err := json.Marshal(constraints)
+	if err != nil {
+		return nil, err
+	}
+
+	var value []interface{}
+	err = utiljson.Unmarshal(raw, &value)
+	if err != nil {
+		return nil, err
+	}
+
+	desired, err := toMap(workload)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &unstructured.Unstructured{Object: desired}
+	err = unstructured.SetNestedSlice(u.Object, value, "spec", "template", "spec", "topologySpreadConstraints")
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// validateScheduling checks the topology spread constraints, the rest is
+// checked by the API server when the workload is written
+func validateScheduling(r *v1alpha2.Redis) []string {
+	var validationErrors []string
+
+	for _, constraint := range r.Spec.Scheduling.TopologySpreadConstraints {
+		if constraint.MaxSkew < 1 {
+			validationErrors = append(validationErrors,
+				fmt.Sprintf("topology spread maxSkew ( %d ) must be at least 1", constraint.MaxSkew))
+		}
+
+		if constraint.TopologyKey == "" {
+			validationErrors = append(validationErrors, "topology spread topologyKey is required")
+		}
+
+		switch constraint.WhenUnsatisfiable {
+		case "DoNotSchedule", "ScheduleAnyway":
+		default:
+			validationErrors = append(validationErrors, fmt.Sprintf(
+				"topology spread whenUnsatisfiable ( %s ) must be DoNotSchedule or ScheduleAnyway", constraint.WhenUnsatisfiable))
+		}
+	}
+
+	return validationErrors
+}
@@ -0,0 +1,172 @@
+package stub
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestWithTopologySpread(t *testing.T) {
+	zone := v1alpha2.TopologySpreadConstraint{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: "ScheduleAnyway"}
+	own := &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "cache"}}
+
+	tests := []struct {
+		name        string
+		constraints []v1alpha2.TopologySpreadConstraint
+		// selectors are the matchLabels each constraint ends up with
+		selectors []map[string]interface{}
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:        "selector defaults to the redis pods",
+			constraints: []v1alpha2.TopologySpreadConstraint{zone},
+			selectors:   []map[string]interface{}{{"lru-cache": "cache"}},
+		},
+		{
+			name: "own selector",
+			constraints: []v1alpha2.TopologySpreadConstraint{
+				{MaxSkew: 2, TopologyKey: hostnameTopologyKey, WhenUnsatisfiable: "DoNotSchedule", LabelSelector: own},
+				zone,
+			},
+			selectors: []map[string]interface{}{{"tier": "cache"}, {"lru-cache": "cache"}},
+		},
+	}
+
+	for _, test := range tests {
+		redis := testRedis()
+		redis.Spec.Scheduling.TopologySpreadConstraints = test.constraints
+
+		sts, err := getStatefulSetDefinition(redis)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		desired, err := withTopologySpread(redis, sts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(test.constraints) == 0 {
+			if desired != sts {
+				t.Errorf("%s: got %T, want the StatefulSet as it is", test.name, desired)
+			}
+			continue
+		}
+
+		u, ok := desired.(*unstructured.Unstructured)
+		if !ok {
+			t.Fatalf("%s: got %T", test.name, desired)
+		}
+
+		constraints, found, err := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "topologySpreadConstraints")
+		if err != nil || !found || len(constraints) != len(test.selectors) {
+			t.Fatalf("%s: got constraints %v, %v", test.name, constraints, err)
+		}
+
+		for i, constraint := range constraints {
+			matchLabels, _, _ := unstructured.NestedMap(constraint.(map[string]interface{}), "labelSelector", "matchLabels")
+			if !reflect.DeepEqual(matchLabels, test.selectors[i]) {
+				t.Errorf("%s: constraint %d got selector %v, want %v", test.name, i, matchLabels, test.selectors[i])
+			}
+		}
+
+		// the defaults are set on copies, the spec is left as it is
+		if test.constraints[len(test.constraints)-1].LabelSelector != nil {
+			t.Errorf("%s: the spec got a labelSelector", test.name)
+		}
+
+		// the rest of the StatefulSet is kept
+		if u.GetName() != sts.Name || u.GetKind() != "StatefulSet" {
+			t.Errorf("%s: got %s %s", test.name, u.GetKind(), u.GetName())
+		}
+	}
+}
+
+func TestGetRedisAffinity(t *testing.T) {
+	zoneAffinity := &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}},
+				}},
+			},
+		},
+	}
+
+	ownAntiAffinity := &corev1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{TopologyKey: "zone"}},
+	}
+
+	tests := []struct {
+		name     string
+		replicas int32
+		affinity *corev1.Affinity
+		// spread is whether the default anti-affinity is added
+		spread bool
+	}{
+		{name: "single instance"},
+		{name: "replicas", replicas: 2, spread: true},
+		{name: "replicas with a node affinity", replicas: 2, affinity: zoneAffinity, spread: true},
+		{name: "replicas with their own anti-affinity", replicas: 2, affinity: &corev1.Affinity{PodAntiAffinity: ownAntiAffinity}},
+	}
+
+	for _, test := range tests {
+		redis := testRedis()
+		redis.Spec.Topology.Replicas = test.replicas
+		redis.Spec.Scheduling.Affinity = test.affinity
+
+		affinity := getRedisAffinity(redis)
+
+		spread := affinity != nil && affinity.PodAntiAffinity != nil &&
+			len(affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution) == 1
+		if spread != test.spread {
+			t.Errorf("%s: got anti-affinity %+v", test.name, affinity)
+		}
+
+		if test.affinity != nil && !reflect.DeepEqual(affinity.NodeAffinity, test.affinity.NodeAffinity) {
+			t.Errorf("%s: the node affinity got lost", test.name)
+		}
+
+		// the spec is left as it is
+		if test.affinity == zoneAffinity && zoneAffinity.PodAntiAffinity != nil {
+			t.Errorf("%s: the default anti-affinity got into the spec", test.name)
+		}
+	}
+}
+
+func TestValidateScheduling(t *testing.T) {
+	tests := []struct {
+		name       string
+		constraint v1alpha2.TopologySpreadConstraint
+		want       []string
+	}{
+		{
+			name:       "valid",
+			constraint: v1alpha2.TopologySpreadConstraint{MaxSkew: 1, TopologyKey: hostnameTopologyKey, WhenUnsatisfiable: "DoNotSchedule"},
+		},
+		{
+			name:       "invalid",
+			constraint: v1alpha2.TopologySpreadConstraint{WhenUnsatisfiable: "Sometimes"},
+			want: []string{
+				"topology spread maxSkew ( 0 ) must be at least 1",
+				"topology spread topologyKey is required",
+				"topology spread whenUnsatisfiable ( Sometimes ) must be DoNotSchedule or ScheduleAnyway",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		redis := testRedis()
+		redis.Spec.Scheduling.TopologySpreadConstraints = []v1alpha2.TopologySpreadConstraint{test.constraint}
+
+		if got := validateScheduling(redis); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package stub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	rConfig "github.com/flexshopper/redis-operator/pkg/config"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// The probes and the exporter read the password from this env var
+	passwordEnvVar = "REDIS_PASSWORD"
+	// redis-server reads requirepass and masterauth from authConfigFile,
+	// rendered into a Secret of its own and mounted there
+	authVolumeName = "redis-auth"
+	authConfigDir  = "/usr/local/etc/redis-auth/"
+	authConfigKey  = "auth.conf"
+	authConfigFile = authConfigDir + authConfigKey
+	// the sentinels append sentinelAuthConfigKey of the auth Secret to
+	// their config, they can't include it: sentinel rewrites its config
+	sentinelAuthConfigKey  = "sentinel-auth.conf"
+	sentinelAuthConfigFile = authConfigDir + sentinelAuthConfigKey
+	// Pod template annotation used to roll the pods when the Secret changes
+	secretHashAnnotation = "secret/hash"
+)
+
+func getPasswordSecret(redis *v1alpha2.Redis) (*corev1.Secret, error) {
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redis.Spec.Security.PasswordSecret,
+			Namespace: redis.Namespace,
+		},
+	}
+
+	err := sdk.Get(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// validatePasswordSecret makes sure the referenced Secret and key exist,
+// otherwise the pod would be stuck in CreateContainerConfigError
+func validatePasswordSecret(redis *v1alpha2.Redis) []string {
+	if redis.Spec.Security.PasswordSecret == "" {
+		return nil
+	}
+
+	r := redis.DeepCopy()
+	r.SetDefaults()
+
+	secret, err := getPasswordSecret(r)
+	if errors.IsNotFound(err) {
+		return []string{fmt.Sprintf("passwordSecret ( %s ) not found", r.Spec.Security.PasswordSecret)}
+	}
+
+	if err != nil {
+		return []string{fmt.Sprintf("failed to read passwordSecret ( %s ): %v", r.Spec.Security.PasswordSecret, err)}
+	}
+
+	if len(secret.Data[r.Spec.Security.PasswordSecretKey]) == 0 {
+		return []string{fmt.Sprintf("passwordSecret ( %s ) has no key ( %s )",
+			r.Spec.Security.PasswordSecret,
+			r.Spec.Security.PasswordSecretKey)}
+	}
+
+	return nil
+}
+
+// getPasswordSecretHash changes with the password only, edits to the labels
+// or annotations of the Secret mustn't restart the pods. The password is
+// salted with the UID of the Secret so the hash can't be looked up.
+func getPasswordSecretHash(redis *v1alpha2.Redis) (string, error) {
+	secret, err := getPasswordSecret(redis)
+	if err != nil {
+		return "", err
+	}
+
+	return passwordHash(secret, redis.Spec.Security.PasswordSecretKey), nil
+}
+
+func passwordHash(secret *corev1.Secret, key string) string {
+	hash := sha256.Sum256(append([]byte(secret.UID+"/"), secret.Data[key]...))
+	return hex.EncodeToString(hash[:])
+}
+
+func passwordEnv(redis *v1alpha2.Redis) []corev1.EnvVar {
+	if redis.Spec.Security.PasswordSecret == "" {
+		return nil
+	}
+
+	return []corev1.EnvVar{
+		{
+			Name: passwordEnvVar,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: redis.Spec.Security.PasswordSecret,
+					},
+					Key: redis.Spec.Security.PasswordSecretKey,
+				},
+			},
+		},
+	}
+}
+
+// authArgs are appended to the redis-server command line, they name the
+// file holding the password rather than the password itself, which would
+// show in ps and /proc/*/cmdline
+func authArgs(redis *v1alpha2.Redis) []string {
+	if redis.Spec.Security.PasswordSecret == "" {
+		return nil
+	}
+
+	return []string{"--include", authConfigFile}
+}
+
+func authSecretName(redis *v1alpha2.Redis) string {
+	return redis.Name + "-auth"
+}
+
+// authVolumes mount the auth Secret in the redis container
+func authVolumes(redis *v1alpha2.Redis) ([]corev1.Volume, []corev1.VolumeMount) {
+	if redis.Spec.Security.PasswordSecret == "" {
+		return nil, nil
+	}
+
+	volumes := []corev1.Volume{
+		{
+			Name: authVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: authSecretName(redis),
+				},
+			},
+		},
+	}
+
+	volumeMounts := []corev1.VolumeMount{
+		{
+			Name:      authVolumeName,
+			MountPath: authConfigDir,
+			ReadOnly:  true,
+		},
+	}
+
+	return volumes, volumeMounts
+}
+
+// getAuthSecretDefinition is the redis.conf include with the password of
+// the password Secret
+func getAuthSecretDefinition(redis *v1alpha2.Redis) (*corev1.Secret, error) {
+	password, err := getPassword(redis)
+	if err != nil {
+		return nil, err
+	}
+
+	authConfig, err := rConfig.ParseAuthConfig(redis.Spec.DeepCopy(), password)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{
+		authConfigKey: []byte(authConfig),
+	}
+
+	if sentinelAuthEnabled(redis) {
+		sentinelAuthConfig, err := rConfig.ParseSentinelAuthConfig(redis.Spec.DeepCopy(), password)
+		if err != nil {
+			return nil, err
+		}
+
+		data[sentinelAuthConfigKey] = []byte(sentinelAuthConfig)
+	}
+
+	return &corev1.Secret{
+		TypeMeta: secretTypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            authSecretName(redis),
+			Namespace:       redis.Namespace,
+			Labels:          genericObjectDefinitionLabels(),
+			OwnerReferences: ownerReferences(redis),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}, nil
+}
+
+// createOrUpdateAuthSecret keeps the auth Secret in line with the password
+// Secret, it's removed once authentication is disabled. It's written with a
+// plain update: reconcileObject would copy the password into the
+// last-applied annotation.
+func createOrUpdateAuthSecret(r *v1alpha2.Redis) error {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	live := &corev1.Secret{TypeMeta: secretTypeMeta, ObjectMeta: childObjectMeta(redis, authSecretName(redis))}
+	if redis.Spec.Security.PasswordSecret == "" {
+		return deleteUnusedChild(live)
+	}
+
+	desired, err := getAuthSecretDefinition(redis)
+	if err != nil {
+		return err
+	}
+
+	err = sdk.Get(live)
+	if errors.IsNotFound(err) {
+		return createChild(desired)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(live.Data, desired.Data) {
+		return nil
+	}
+
+	live.Data = desired.Data
+	err = sdk.Update(live)
+	observeChildOperation(live, "update", err)
+	return err
+}
+
+// getPassword returns the password the operator uses to talk to the
+// instances, empty when authentication is disabled
+func getPassword(redis *v1alpha2.Redis) (string, error) {
+	if redis.Spec.Security.PasswordSecret == "" {
+		return "", nil
+	}
+
+	secret, err := getPasswordSecret(redis)
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret.Data[redis.Spec.Security.PasswordSecretKey]), nil
+}
+
+// setPasswordSecretHash stamps the Secret revision on the pod template so a
+// password change rolls the pods
+func setPasswordSecretHash(redis *v1alpha2.Redis, template *corev1.PodTemplateSpec) error {
+	if redis.Spec.Security.PasswordSecret == "" {
+		return nil
+	}
+
+	secretHash, err := getPasswordSecretHash(redis)
+	if err != nil {
+		return err
+	}
+
+	template.Annotations[secretHashAnnotation] = secretHash
+	return nil
+}
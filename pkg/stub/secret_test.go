@@ -0,0 +1,91 @@
+package stub
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestPasswordNotOnCommandLine(t *testing.T) {
+	for _, image := range []string{"redis:7.0", "redis:4.0"} {
+		redis := testRedis()
+		redis.Spec.Image = image
+		redis.Spec.Security.PasswordSecret = "cache-password"
+		redis.SetDefaults()
+
+		template, err := getPodTemplateDefinition(redis)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		container := template.Spec.Containers[0]
+		command := strings.Join(container.Command, " ")
+		if strings.Contains(command, passwordEnvVar) || strings.Contains(command, "requirepass") {
+			t.Errorf("%s: password on the command line: %s", image, command)
+		}
+
+		if !strings.HasSuffix(command, "--include "+authConfigFile) {
+			t.Errorf("%s: got command %s, want the auth config included", image, command)
+		}
+
+		mounted := false
+		for _, mount := range container.VolumeMounts {
+			mounted = mounted || mount.Name == authVolumeName && mount.MountPath == authConfigDir
+		}
+
+		var secretName string
+		for _, volume := range template.Spec.Volumes {
+			if volume.Name == authVolumeName && volume.Secret != nil {
+				secretName = volume.Secret.SecretName
+			}
+		}
+
+		if !mounted || secretName != authSecretName(redis) {
+			t.Errorf("%s: auth Secret %q mounted %v, want %s mounted", image, secretName, mounted, authSecretName(redis))
+		}
+	}
+
+	redis := testRedis()
+	template, err := getPodTemplateDefinition(redis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(authArgs(redis)) != 0 || len(template.Spec.Volumes) != 1 {
+		t.Errorf("without a password: got command %v and volumes %v", template.Spec.Containers[0].Command, template.Spec.Volumes)
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	secret := func(uid, resourceVersion, password string, labels map[string]string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{UID: types.UID(uid), ResourceVersion: resourceVersion, Labels: labels},
+			Data:       map[string][]byte{"password": []byte(password), "other": []byte(resourceVersion)},
+		}
+	}
+
+	current := passwordHash(secret("uid", "1", "s3cret", nil), "password")
+
+	tests := []struct {
+		name    string
+		secret  *corev1.Secret
+		changed bool
+	}{
+		{name: "labels and other keys edited", secret: secret("uid", "2", "s3cret", map[string]string{"team": "cache"})},
+		{name: "password changed", secret: secret("uid", "3", "other", nil), changed: true},
+		{name: "Secret recreated", secret: secret("uid2", "1", "s3cret", nil), changed: true},
+	}
+
+	for _, test := range tests {
+		if changed := passwordHash(test.secret, "password") != current; changed != test.changed {
+			t.Errorf("%s: hash changed %v, want %v", test.name, changed, test.changed)
+		}
+	}
+
+	if strings.Contains(current, "s3cret") || current == getMd5("s3cret") {
+		t.Errorf("hash %s gives the password away", current)
+	}
+}
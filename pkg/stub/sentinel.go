@@ -0,0 +1,705 @@
+package stub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	rConfig "github.com/flexshopper/redis-operator/pkg/config"
+	"github.com/flexshopper/redis-operator/pkg/redisclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// switchMasterChannel is where sentinel announces a completed failover as
+	// "<master name> <old ip> <old port> <new ip> <new port>"
+	switchMasterChannel = "+switch-master"
+	// sentinelAuthAnnotation is the hash of the auth-pass last set on the
+	// sentinel of the pod, sentinel never reports it back and rewrites its
+	// config on every SENTINEL SET
+	sentinelAuthAnnotation = "cache.flexshopper.com/sentinel-auth"
+)
+
+func sentinelEnabled(redis *v1alpha2.Redis) bool {
+	return redis.Spec.Topology.Sentinel != nil
+}
+
+// sentinelAuthEnabled is whether the sentinels ask for the password of the
+// instance. Sentinels before 5.0.1 take no password: anyone reaching them can
+// reconfigure the master they monitor.
+func sentinelAuthEnabled(redis *v1alpha2.Redis) bool {
+	if !sentinelEnabled(redis) || redis.Spec.Security.PasswordSecret == "" {
+		return false
+	}
+
+	supported, err := rConfig.SentinelAuthSupported(redis.Spec.DeepCopy())
+	return err == nil && supported
+}
+
+// sentinelPassword is the password the operator authenticates to the
+// sentinels with, empty when they take none
+func sentinelPassword(redis *v1alpha2.Redis, password string) string {
+	if !sentinelAuthEnabled(redis) {
+		return ""
+	}
+
+	return password
+}
+
+// dialSentinel falls back to no password for the sentinels started before
+// authentication got enabled, they refuse AUTH until they're rolled
+func dialSentinel(addr, password string) (*redisclient.Client, error) {
+	client, err := redisclient.Dial(addr, password)
+	if _, refused := err.(redisclient.Error); refused && password != "" {
+		return redisclient.Dial(addr, "")
+	}
+
+	return client, err
+}
+
+func sentinelName(redis *v1alpha2.Redis) string {
+	return redis.Name + "-sentinel"
+}
+
+// sentinelLabels must not include the lru-cache label, the redis
+// StatefulSet and Services select on it
+func sentinelLabels(name string) map[string]string {
+	labels := genericObjectDefinitionLabels()
+	labels["lru-cache-sentinel"] = name
+
+	return labels
+}
+
+func getSentinelConfigMapDefinition(redis *v1alpha2.Redis) (*corev1.ConfigMap, error) {
+	sentinelConfig, err := rConfig.ParseSentinelConfig(redis.Spec.DeepCopy())
+	if err != nil {
+		return nil, err
+	}
+
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            sentinelName(redis),
+			Namespace:       redis.Namespace,
+			Labels:          genericObjectDefinitionLabels(),
+			OwnerReferences: ownerReferences(redis),
+		},
+		Data: map[string]string{
+			"sentinel.conf": sentinelConfig,
+		},
+	}, nil
+}
+
+func getSentinelServiceDefinition(redis *v1alpha2.Redis) *corev1.Service {
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            sentinelName(redis),
+			Namespace:       redis.Namespace,
+			Labels:          genericObjectDefinitionLabels(),
+			OwnerReferences: ownerReferences(redis),
+		},
+		Spec: corev1.ServiceSpec{
+			Type:            "ClusterIP",
+			SessionAffinity: "None",
+			Selector:        sentinelLabels(redis.Name),
+			Ports: []corev1.ServicePort{
+				{
+					Name: "sentinel",
+					Port: rConfig.SentinelPort,
+					TargetPort: intstr.IntOrString{
+						IntVal: rConfig.SentinelPort,
+					},
+					Protocol: "TCP",
+				},
+			},
+		},
+	}
+}
+
+func getSentinelStatefulSetDefinition(redis *v1alpha2.Redis) (*v1.StatefulSet, error) {
+	sentinelConfig, err := rConfig.ParseSentinelConfig(redis.Spec.DeepCopy())
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := int32(0)
+	if redis.Spec.Topology.Sentinel != nil {
+		replicas = redis.Spec.Topology.Sentinel.Replicas
+	}
+
+	name := sentinelName(redis)
+	labels := sentinelLabels(redis.Name)
+
+	// sentinel rewrites its config, the ConfigMap mount is read only
+	command := "cp /usr/local/etc/redis/sentinel.conf /data/sentinel.conf && "
+	var volumes []corev1.Volume
+	var volumeMounts []corev1.VolumeMount
+	if sentinelAuthEnabled(redis) {
+		command += "cat " + sentinelAuthConfigFile + " >> /data/sentinel.conf && "
+		volumes, volumeMounts = authVolumes(redis)
+	}
+	command += "exec redis-server /data/sentinel.conf --sentinel"
+
+	return &v1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "apps/v1",
+			Kind:       "StatefulSet",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       redis.Namespace,
+			Labels:          labels,
+			OwnerReferences: ownerReferences(redis),
+		},
+		Spec: v1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: name,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					Annotations: map[string]string{
+						"configmap/hash": getMd5(sentinelConfig),
+					},
+				},
+				Spec: corev1.PodSpec{
+					Volumes: append([]corev1.Volume{
+						{
+							Name: "sentinel-config",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: name,
+									},
+								},
+							},
+						},
+						{
+							Name: "sentinel-data",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					}, volumes...),
+					Containers: []corev1.Container{
+						{
+							Image:   redis.Spec.Image,
+							Name:    "sentinel",
+							Command: []string{"sh", "-c", command},
+							Ports: []corev1.ContainerPort{
+								{
+									ContainerPort: rConfig.SentinelPort,
+									Name:          "sentinel",
+								},
+							},
+							VolumeMounts: append([]corev1.VolumeMount{
+								{
+									Name:      "sentinel-config",
+									MountPath: "/usr/local/etc/redis/",
+								},
+								{
+									Name:      "sentinel-data",
+									MountPath: "/data",
+								},
+							}, volumeMounts...),
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// createOrUpdateSentinel manages the sentinel ConfigMap, StatefulSet and
+// Service, and removes them when sentinel gets disabled
+func createOrUpdateSentinel(r *v1alpha2.Redis) error {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	if !sentinelEnabled(redis) {
+		for _, object := range []sdk.Object{
+			&corev1.Service{TypeMeta: serviceTypeMeta, ObjectMeta: childObjectMeta(redis, sentinelName(redis))},
+			&v1.StatefulSet{TypeMeta: statefulSetTypeMeta, ObjectMeta: childObjectMeta(redis, sentinelName(redis))},
+			&corev1.ConfigMap{TypeMeta: configMapTypeMeta, ObjectMeta: childObjectMeta(redis, sentinelName(redis))},
+		} {
+			err := deleteUnusedChild(object)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	cm, err := getSentinelConfigMapDefinition(redis)
+	if err != nil {
+		return err
+	}
+
+	sts, err := getSentinelStatefulSetDefinition(redis)
+	if err != nil {
+		return err
+	}
+
+	// sentinel reads requirepass at startup only
+	if sentinelAuthEnabled(redis) {
+		err = setPasswordSecretHash(redis, &sts.Spec.Template)
+		if err != nil {
+			return err
+		}
+	}
+
+	svc := getSentinelServiceDefinition(redis)
+
+	if redis.Spec.Security.PasswordSecret != "" && !sentinelAuthEnabled(redis) {
+		recorder.Eventf(redisReference(redis), corev1.EventTypeWarning, "SentinelUnauthenticated",
+			"the sentinels take no password before redis %s, the image ( %s ) runs an older release",
+			rConfig.SentinelAuthVersion, redis.Spec.Image)
+	}
+
+	for _, object := range []sdk.Object{cm, sts, svc} {
+		_, err = reconcileObject(object)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func listSentinelPods(redis *v1alpha2.Redis) ([]corev1.Pod, error) {
+	podList := &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+	}
+
+	selector := labels.SelectorFromSet(sentinelLabels(redis.Name)).String()
+	err := sdk.List(redis.Namespace, podList, sdk.WithListOptions(&metav1.ListOptions{LabelSelector: selector}))
+	if err != nil {
+		return nil, err
+	}
+
+	var running []corev1.Pod
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.Status.PodIP != "" && pod.DeletionTimestamp == nil {
+			running = append(running, pod)
+		}
+	}
+
+	return running, nil
+}
+
+func sentinelAddr(pod corev1.Pod) string {
+	return net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(rConfig.SentinelPort))
+}
+
+// getSentinelMaster asks every sentinel for the master address and returns
+// the one most of them agree on, empty when no sentinel monitors it yet
+func getSentinelMaster(redis *v1alpha2.Redis, password string) (string, error) {
+	pods, err := listSentinelPods(redis)
+	if err != nil {
+		return "", err
+	}
+
+	votes := map[string]int{}
+	master := ""
+
+	for _, pod := range pods {
+		client, err := dialSentinel(sentinelAddr(pod), sentinelPassword(redis, password))
+		if err != nil {
+			logrus.Warnf("failed to connect to sentinel %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+
+		reply, err := client.Do("SENTINEL", "get-master-addr-by-name", redis.Name)
+		client.Close()
+		if err != nil {
+			logrus.Warnf("failed to get master from sentinel %s/%s: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+
+		addr, ok := reply.([]interface{})
+		if !ok || len(addr) != 2 {
+			continue
+		}
+
+		ip, _ := addr[0].(string)
+		votes[ip]++
+		if votes[ip] > votes[master] {
+			master = ip
+		}
+	}
+
+	return master, nil
+}
+
+// ensureSentinelMonitor registers the master on the sentinels that don't
+// know it yet and keeps quorum, auth and timeouts in line with the spec
+func ensureSentinelMonitor(redis *v1alpha2.Redis, password string, master *redisNode) error {
+	pods, err := listSentinelPods(redis)
+	if err != nil {
+		return err
+	}
+
+	settings := rConfig.SentinelMonitorSettings(redis.Spec.DeepCopy())
+
+	for _, pod := range pods {
+		err = ensureSentinelPodMonitor(redis, pod, master, settings, password)
+		if err != nil {
+			return fmt.Errorf("failed to configure sentinel %s: %v", pod.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func ensureSentinelPodMonitor(redis *v1alpha2.Redis, pod corev1.Pod, master *redisNode, settings map[string]string, password string) error {
+	client, err := dialSentinel(sentinelAddr(pod), sentinelPassword(redis, password))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	registered := false
+	reply, err := client.Do("SENTINEL", "master", redis.Name)
+	if _, unknown := err.(redisclient.Error); unknown {
+		registered = true
+		logrus.Infof("registering master %s on sentinel %s/%s", master.pod.Name, pod.Namespace, pod.Name)
+		_, err = client.Do("SENTINEL", "monitor", redis.Name, master.pod.Status.PodIP,
+			strconv.Itoa(int(redis.Spec.Port)), settings["quorum"])
+		if err != nil {
+			return err
+		}
+
+		reply, err = client.Do("SENTINEL", "master", redis.Name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// the reply is a flat list of field, value pairs
+	current := map[string]string{}
+	fields, _ := reply.([]interface{})
+	for i := 0; i+1 < len(fields); i += 2 {
+		k, _ := fields[i].(string)
+		v, _ := fields[i+1].(string)
+		current[k] = v
+	}
+
+	authHash := sentinelAuthHash(redis, password)
+	changes := sentinelMonitorChanges(current, settings)
+	if authPassChanged(pod, authHash, registered) {
+		changes["auth-pass"] = password
+	}
+
+	names := make([]string, 0, len(changes))
+	for k := range changes {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		_, err = client.Do("SENTINEL", "set", redis.Name, k, changes[k])
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, ok := changes["auth-pass"]; ok {
+		return setSentinelAuthHash(&pod, authHash)
+	}
+
+	return nil
+}
+
+// sentinelMonitorChanges are the settings sentinel reports another value of
+func sentinelMonitorChanges(current, settings map[string]string) map[string]string {
+	changes := map[string]string{}
+	for k, v := range settings {
+		if current[k] != v {
+			changes[k] = v
+		}
+	}
+
+	return changes
+}
+
+// authPassChanged is whether auth-pass has to be set on the sentinel of a
+// pod: it just registered the master, or the pod doesn't carry the hash of
+// the password. A pod from before the annotation gets it set once.
+func authPassChanged(pod corev1.Pod, authHash string, registered bool) bool {
+	hash, ok := pod.Annotations[sentinelAuthAnnotation]
+	return registered || !ok || hash != authHash
+}
+
+// sentinelAuthHash is salted with the UID of the Redis so the hash can't be
+// looked up, it's empty without a password
+func sentinelAuthHash(redis *v1alpha2.Redis, password string) string {
+	if password == "" {
+		return ""
+	}
+
+	hash := sha256.Sum256([]byte(string(redis.UID) + "/" + password))
+	return hex.EncodeToString(hash[:])
+}
+
+func setSentinelAuthHash(pod *corev1.Pod, hash string) error {
+	pod.TypeMeta = metav1.TypeMeta{
+		APIVersion: "v1",
+		Kind:       "Pod",
+	}
+
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, sentinelAuthAnnotation, hash)
+	err := sdk.Patch(pod, types.MergePatchType, []byte(patch))
+	observeAPICall(pod, "patch", err)
+	return err
+}
+
+func validateSentinel(r *v1alpha2.Redis) []string {
+	if !sentinelEnabled(r) {
+		return nil
+	}
+
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	var validationErrors []string
+	sentinel := redis.Spec.Topology.Sentinel
+
+	if !replicationEnabled(redis) {
+		validationErrors = append(validationErrors, "sentinel requires at least one replica to fail over to")
+	}
+
+	if sentinel.Replicas < 1 {
+		validationErrors = append(validationErrors,
+			fmt.Sprintf("sentinel replicas ( %d ) must be at least 1", sentinel.Replicas))
+	}
+
+	if sentinel.Quorum < 1 || sentinel.Quorum > sentinel.Replicas {
+		validationErrors = append(validationErrors,
+			fmt.Sprintf("sentinel quorum ( %d ) must be between 1 and the number of sentinels ( %d )",
+				sentinel.Quorum, sentinel.Replicas))
+	}
+
+	for _, timing := range []struct {
+		name  string
+		value int32
+	}{
+		{"downAfterMilliseconds", sentinel.DownAfterMilliseconds},
+		{"failoverTimeout", sentinel.FailoverTimeout},
+		{"parallelSyncs", sentinel.ParallelSyncs},
+	} {
+		if timing.value < 1 {
+			validationErrors = append(validationErrors,
+				fmt.Sprintf("sentinel %s ( %d ) must be at least 1", timing.name, timing.value))
+		}
+	}
+
+	return validationErrors
+}
+
+// relabelMaster points the master Service at the pod with masterIP
+func relabelMaster(redis *v1alpha2.Redis, masterIP string) error {
+	pods, err := listRedisPods(redis)
+	if err != nil {
+		return err
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.PodIP == masterIP {
+			err = setPodRole(pod, roleMaster)
+		} else if pod.Labels[roleLabel] == roleMaster {
+			err = setPodRole(pod, roleReplica)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sentinelWatcher follows +switch-master on the sentinel Service so the
+// master Service is repointed as soon as a failover completes instead of on
+// the next resync
+type sentinelWatcher struct {
+	stop chan struct{}
+
+	mu     sync.Mutex
+	redis  *v1alpha2.Redis
+	client *redisclient.Client
+}
+
+func newSentinelWatcher(redis *v1alpha2.Redis) *sentinelWatcher {
+	w := &sentinelWatcher{stop: make(chan struct{})}
+	w.update(redis)
+
+	go w.run()
+	return w
+}
+
+// update hands the watcher the latest spec, the password is read again with
+// it on the next connection
+func (w *sentinelWatcher) update(redis *v1alpha2.Redis) {
+	r := redis.DeepCopy()
+	r.SetDefaults()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.redis = r
+}
+
+func (w *sentinelWatcher) current() *v1alpha2.Redis {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.redis
+}
+
+func (w *sentinelWatcher) Stop() {
+	close(w.stop)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.client != nil {
+		w.client.Close()
+	}
+}
+
+func (w *sentinelWatcher) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *sentinelWatcher) run() {
+	redis := w.current()
+	addr := net.JoinHostPort(
+		fmt.Sprintf("%s.%s.svc", sentinelName(redis), redis.Namespace),
+		strconv.Itoa(rConfig.SentinelPort))
+
+	for !w.stopped() {
+		err := w.watch(addr)
+		if err != nil && !w.stopped() {
+			logrus.Warnf("lost sentinel %s, retrying: %v", addr, err)
+		}
+
+		select {
+		case <-w.stop:
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (w *sentinelWatcher) watch(addr string) error {
+	redis := w.current()
+	password, err := getPassword(redis)
+	if err != nil {
+		return err
+	}
+
+	client, err := dialSentinel(addr, sentinelPassword(redis, password))
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	if w.stopped() {
+		w.mu.Unlock()
+		client.Close()
+		return nil
+	}
+	w.client = client
+	w.mu.Unlock()
+
+	defer client.Close()
+
+	err = client.Subscribe(switchMasterChannel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		_, payload, err := client.ReceiveMessage()
+		if err != nil {
+			return err
+		}
+
+		fields := strings.Fields(payload)
+		if len(fields) != 5 || fields[0] != redis.Name {
+			continue
+		}
+
+		logrus.Infof("sentinel switched master of %s/%s to %s", redis.Namespace, redis.Name, fields[3])
+		err = relabelMaster(w.current(), fields[3])
+		if err != nil {
+			logrus.Errorf("failed to relabel master of %s/%s: %v", redis.Namespace, redis.Name, err)
+		}
+	}
+}
+
+// syncSentinelWatcher starts or stops the watcher of a Redis to match its spec
+func (h *Handler) syncSentinelWatcher(redis *v1alpha2.Redis) {
+	key := redis.Namespace + "/" + redis.Name
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	watcher, running := h.sentinelWatchers[key]
+	if sentinelEnabled(redis) {
+		if !running {
+			h.sentinelWatchers[key] = newSentinelWatcher(redis)
+		} else {
+			watcher.update(redis)
+		}
+
+		return
+	}
+
+	if running {
+		watcher.Stop()
+		delete(h.sentinelWatchers, key)
+	}
+}
+
+func (h *Handler) stopSentinelWatcher(redis *v1alpha2.Redis) {
+	key := redis.Namespace + "/" + redis.Name
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if watcher, running := h.sentinelWatchers[key]; running {
+		watcher.Stop()
+		delete(h.sentinelWatchers, key)
+	}
+}
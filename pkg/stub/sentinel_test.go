@@ -0,0 +1,148 @@
+package stub
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testSentinelRedis(image, passwordSecret string) *v1alpha2.Redis {
+	redis := testRedis()
+	redis.Spec.Image = image
+	redis.Spec.Topology.Sentinel = &v1alpha2.RedisSentinel{}
+	redis.Spec.Security.PasswordSecret = passwordSecret
+	redis.SetDefaults()
+	return redis
+}
+
+func TestSentinelAuth(t *testing.T) {
+	tests := []struct {
+		name  string
+		redis *v1alpha2.Redis
+		want  bool
+	}{
+		{name: "password", redis: testSentinelRedis("redis:7.2", "cache-password"), want: true},
+		{name: "no password", redis: testSentinelRedis("redis:7.2", "")},
+		{name: "before 5.0.1", redis: testSentinelRedis("redis:5.0.0", "cache-password")},
+	}
+
+	for _, test := range tests {
+		if got := sentinelAuthEnabled(test.redis); got != test.want {
+			t.Errorf("%s: got auth %v, want %v", test.name, got, test.want)
+		}
+
+		sts, err := getSentinelStatefulSetDefinition(test.redis)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		container := sts.Spec.Template.Spec.Containers[0]
+		command := strings.Join(container.Command, " ")
+		if appended := strings.Contains(command, sentinelAuthConfigFile); appended != test.want {
+			t.Errorf("%s: got command %s", test.name, command)
+		}
+
+		if strings.Contains(command, passwordEnvVar) || strings.Contains(command, "requirepass") {
+			t.Errorf("%s: password on the command line: %s", test.name, command)
+		}
+
+		mounted := false
+		for _, mount := range container.VolumeMounts {
+			mounted = mounted || mount.Name == authVolumeName && mount.MountPath == authConfigDir
+		}
+
+		if mounted != test.want {
+			t.Errorf("%s: got the auth Secret mounted %v, want %v", test.name, mounted, test.want)
+		}
+
+		// the operator authenticates only to sentinels asking for it
+		if got := sentinelPassword(test.redis, "s3cret") != ""; got != test.want {
+			t.Errorf("%s: got a sentinel password %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSentinelMonitorChanges(t *testing.T) {
+	settings := map[string]string{"quorum": "2", "down-after-milliseconds": "5000"}
+
+	tests := []struct {
+		name    string
+		current map[string]string
+		want    map[string]string
+	}{
+		{
+			name:    "unchanged",
+			current: map[string]string{"quorum": "2", "down-after-milliseconds": "5000", "num-slaves": "2"},
+			want:    map[string]string{},
+		},
+		{
+			name:    "changed",
+			current: map[string]string{"quorum": "3", "down-after-milliseconds": "5000"},
+			want:    map[string]string{"quorum": "2"},
+		},
+		{
+			name: "just registered",
+			want: settings,
+		},
+	}
+
+	for _, test := range tests {
+		if got := sentinelMonitorChanges(test.current, settings); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAuthPassChanged(t *testing.T) {
+	redis := testSentinelRedis("redis:7.2", "cache-password")
+	hash := sentinelAuthHash(redis, "s3cret")
+
+	annotated := func(value string) corev1.Pod {
+		return corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{sentinelAuthAnnotation: value}}}
+	}
+
+	tests := []struct {
+		name       string
+		pod        corev1.Pod
+		hash       string
+		registered bool
+		want       bool
+	}{
+		{name: "same password", pod: annotated(hash), hash: hash},
+		{name: "other password", pod: annotated(sentinelAuthHash(redis, "other")), hash: hash, want: true},
+		{name: "password removed", pod: annotated(hash), want: true},
+		{name: "no password", pod: annotated("")},
+		{name: "unannotated pod", hash: hash, want: true},
+		{name: "unannotated pod without a password", want: true},
+		// the sentinel lost the master along with its auth-pass
+		{name: "just registered", pod: annotated(hash), hash: hash, registered: true, want: true},
+	}
+
+	for _, test := range tests {
+		if got := authPassChanged(test.pod, test.hash, test.registered); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSentinelAuthHash(t *testing.T) {
+	redis := testRedis()
+	if hash := sentinelAuthHash(redis, ""); hash != "" {
+		t.Errorf("got %s without a password", hash)
+	}
+
+	hash := sentinelAuthHash(redis, "s3cret")
+	if strings.Contains(hash, "s3cret") || hash != sentinelAuthHash(redis, "s3cret") {
+		t.Errorf("got %s", hash)
+	}
+
+	other := testRedis()
+	other.UID = "other"
+	if sentinelAuthHash(other, "s3cret") == hash {
+		t.Errorf("the hash isn't salted")
+	}
+}
@@ -0,0 +1,340 @@
+package stub
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/operator-framework/operator-sdk/pkg/util/k8sutil"
+	"k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+func getCondition(status *v1alpha2.RedisStatus, conditionType v1alpha2.RedisConditionType) *v1alpha2.RedisCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+func isConditionTrue(status *v1alpha2.RedisStatus, conditionType v1alpha2.RedisConditionType) bool {
+	condition := getCondition(status, conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// setCondition records a condition, LastTransitionTime is only bumped when
+// the condition status actually flips so resyncs don't make it flap
+func setCondition(status *v1alpha2.RedisStatus, generation int64, conditionType v1alpha2.RedisConditionType,
+	conditionStatus corev1.ConditionStatus, reason, message string) {
+
+	condition := getCondition(status, conditionType)
+	if condition == nil {
+		status.Conditions = append(status.Conditions, v1alpha2.RedisCondition{Type: conditionType})
+		condition = &status.Conditions[len(status.Conditions)-1]
+	}
+
+	if condition.Status != conditionStatus {
+		condition.Status = conditionStatus
+		condition.LastTransitionTime = metav1.Now()
+	}
+
+	condition.ObservedGeneration = generation
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// updateStatus only writes to the API server when something changed
+func updateStatus(redis *v1alpha2.Redis, status *v1alpha2.RedisStatus) error {
+	if reflect.DeepEqual(redis.Status, *status) {
+		return nil
+	}
+
+	redis.Status = *status
+	err := updateStatusSubresource(redis)
+	observeAPICall(redis, "update", err)
+	return err
+}
+
+// statusClient writes the status subresource of Redis objects, which sdk
+// can't address: once the CRD enables it the status sent along with the
+// object is ignored
+var statusClient struct {
+	sync.Mutex
+	client dynamic.Interface
+}
+
+func getStatusClient() (dynamic.Interface, error) {
+	statusClient.Lock()
+	defer statusClient.Unlock()
+
+	if statusClient.client != nil {
+		return statusClient.client, nil
+	}
+
+	config := *k8sclient.GetKubeConfig()
+	config.GroupVersion = &v1alpha2.SchemeGroupVersion
+	config.APIPath = "/apis"
+
+	client, err := dynamic.NewClient(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	statusClient.client = client
+	return client, nil
+}
+
+// updateStatusSubresource writes the status of a Redis and, like sdk.Update,
+// updates redis with the result
+func updateStatusSubresource(redis *v1alpha2.Redis) error {
+	client, err := getStatusClient()
+	if err != nil {
+		return err
+	}
+
+	object, err := k8sutil.UnstructuredFromRuntimeObject(redis)
+	if err != nil {
+		return err
+	}
+
+	resource := &metav1.APIResource{Name: "redises/status", Namespaced: true}
+	object, err = client.Resource(resource, redis.Namespace).Update(object)
+	if err != nil {
+		return err
+	}
+
+	return k8sutil.UnstructuredIntoRuntimeObject(object, redis)
+}
+
+// getChildrenStatus looks up the live children of a Redis and reports their readiness
+func getChildrenStatus(redis *v1alpha2.Redis) ([]v1alpha2.RedisChildStatus, error) {
+	r := redis.DeepCopy()
+	r.SetDefaults()
+
+	var children []v1alpha2.RedisChildStatus
+
+	cm, err := getConfigMapDefinition(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cmStatus := v1alpha2.RedisChildStatus{Name: cm.Name, Kind: cm.Kind}
+	err = sdk.Get(cm)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		cmStatus.ConfigHash = getMd5(cm.Data["redis.config"])
+		cmStatus.Ready = true
+	}
+
+	children = append(children, cmStatus)
+
+	workloadStatus, _, err := getWorkloadStatus(r)
+	if err != nil {
+		return nil, err
+	}
+
+	children = append(children, workloadStatus)
+
+	services := []*corev1.Service{getServiceDefinition(r)}
+	if replicationEnabled(r) {
+		services = append(services, getReadServiceDefinition(r))
+	}
+
+	if sentinelEnabled(r) {
+		sts, err := getSentinelStatefulSetDefinition(r)
+		if err != nil {
+			return nil, err
+		}
+
+		stsStatus := v1alpha2.RedisChildStatus{Name: sts.Name, Kind: sts.Kind}
+		err = sdk.Get(sts)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+
+		stsStatus.Ready = err == nil && isStatefulSetReady(sts)
+		children = append(children, stsStatus)
+		services = append(services, getSentinelServiceDefinition(r))
+	}
+
+	for _, svc := range services {
+		svcStatus := v1alpha2.RedisChildStatus{Name: svc.Name, Kind: svc.Kind}
+		err = sdk.Get(svc)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+
+		svcStatus.Ready = err == nil
+		children = append(children, svcStatus)
+	}
+
+	return children, nil
+}
+
+// workloadAvailability is what ends up in the DeploymentAvailable condition
+type workloadAvailability struct {
+	status  corev1.ConditionStatus
+	reason  string
+	message string
+}
+
+// getWorkloadStatus reports on the Deployment or StatefulSet running redis
+func getWorkloadStatus(redis *v1alpha2.Redis) (v1alpha2.RedisChildStatus, workloadAvailability, error) {
+	if usesStatefulSet(redis) {
+		sts, err := getStatefulSetDefinition(redis)
+		if err != nil {
+			return v1alpha2.RedisChildStatus{}, workloadAvailability{}, err
+		}
+
+		child := v1alpha2.RedisChildStatus{Name: sts.Name, Kind: sts.Kind}
+		err = sdk.Get(sts)
+		if errors.IsNotFound(err) {
+			return child, workloadAvailability{corev1.ConditionFalse, "StatefulSetNotFound",
+				"statefulset has not been created yet"}, nil
+		}
+
+		if err != nil {
+			return child, workloadAvailability{}, err
+		}
+
+		child.ConfigHash = sts.Spec.Template.Annotations["configmap/hash"]
+		child.Ready = isStatefulSetReady(sts)
+
+		if sts.Status.ReadyReplicas > 0 {
+			return child, workloadAvailability{corev1.ConditionTrue, "MinimumReplicasAvailable",
+				"statefulset has ready replicas"}, nil
+		}
+
+		return child, workloadAvailability{corev1.ConditionFalse, "MinimumReplicasUnavailable",
+			"statefulset has no ready replicas"}, nil
+	}
+
+	deploy, err := getDeploymentDefinition(redis)
+	if err != nil {
+		return v1alpha2.RedisChildStatus{}, workloadAvailability{}, err
+	}
+
+	child := v1alpha2.RedisChildStatus{Name: deploy.Name, Kind: deploy.Kind}
+	err = sdk.Get(deploy)
+	if errors.IsNotFound(err) {
+		return child, workloadAvailability{corev1.ConditionFalse, "DeploymentNotFound",
+			"deployment has not been created yet"}, nil
+	}
+
+	if err != nil {
+		return child, workloadAvailability{}, err
+	}
+
+	child.ConfigHash = deploy.Spec.Template.Annotations["configmap/hash"]
+	child.Ready = isDeploymentReady(deploy)
+
+	for _, c := range deploy.Status.Conditions {
+		if c.Type == v1.DeploymentAvailable {
+			return child, workloadAvailability{c.Status, c.Reason, c.Message}, nil
+		}
+	}
+
+	return child, workloadAvailability{corev1.ConditionUnknown, "DeploymentProgressing",
+		"deployment has not reported availability yet"}, nil
+}
+
+// isDeploymentReady is true once the rollout of the current template is done
+func isDeploymentReady(deploy *v1.Deployment) bool {
+	if deploy.Status.ObservedGeneration < deploy.Generation {
+		return false
+	}
+
+	replicas := int32(1)
+	if deploy.Spec.Replicas != nil {
+		replicas = *deploy.Spec.Replicas
+	}
+
+	return deploy.Status.UpdatedReplicas == replicas &&
+		deploy.Status.ReadyReplicas == replicas &&
+		deploy.Status.Replicas == replicas
+}
+
+// setDeploymentAvailableCondition mirrors the availability of the live workload
+func setDeploymentAvailableCondition(redis *v1alpha2.Redis, status *v1alpha2.RedisStatus) error {
+	r := redis.DeepCopy()
+	r.SetDefaults()
+
+	_, availability, err := getWorkloadStatus(r)
+	if err != nil {
+		return err
+	}
+
+	setCondition(status, redis.Generation, v1alpha2.RedisDeploymentAvailable,
+		availability.status, availability.reason, availability.message)
+	return nil
+}
+
+// setReadyCondition summarizes the other conditions and the children
+func setReadyCondition(redis *v1alpha2.Redis, status *v1alpha2.RedisStatus) {
+	defer setPhase(status)
+
+	for _, conditionType := range []v1alpha2.RedisConditionType{
+		v1alpha2.RedisConfigValid,
+		v1alpha2.RedisPolicyCompliant,
+		v1alpha2.RedisResourcesCreated,
+		v1alpha2.RedisDeploymentAvailable,
+	} {
+		if !isConditionTrue(status, conditionType) {
+			setCondition(status, redis.Generation, v1alpha2.RedisReady, corev1.ConditionFalse,
+				string(conditionType)+"NotTrue", "waiting for "+string(conditionType))
+			return
+		}
+	}
+
+	for _, child := range status.Children {
+		if !child.Ready {
+			setCondition(status, redis.Generation, v1alpha2.RedisReady, corev1.ConditionFalse,
+				"ChildNotReady", child.Kind+" "+child.Name+" is not ready")
+			return
+		}
+	}
+
+	for _, node := range status.Nodes {
+		if node.Role == roleSlave && node.MasterLinkStatus != "up" {
+			setCondition(status, redis.Generation, v1alpha2.RedisReady, corev1.ConditionFalse,
+				"ReplicaLinkDown", "replica "+node.Name+" lost its link to the master")
+			return
+		}
+	}
+
+	if clusterEnabled(redis) && (status.Cluster == nil || status.Cluster.State != "ok") {
+		setCondition(status, redis.Generation, v1alpha2.RedisReady, corev1.ConditionFalse,
+			"ClusterNotOk", "not every cluster slot is served")
+		return
+	}
+
+	setCondition(status, redis.Generation, v1alpha2.RedisReady, corev1.ConditionTrue, "Ready", "")
+}
+
+// setPhase sums the conditions up for kubectl get
+func setPhase(status *v1alpha2.RedisStatus) {
+	switch {
+	case isConditionTrue(status, v1alpha2.RedisReady):
+		status.Phase = v1alpha2.RedisPhaseRunning
+	case conditionFalse(status, v1alpha2.RedisConfigValid), conditionFalse(status, v1alpha2.RedisPolicyCompliant):
+		status.Phase = v1alpha2.RedisPhaseErred
+	default:
+		status.Phase = v1alpha2.RedisPhasePending
+	}
+}
+
+func conditionFalse(status *v1alpha2.RedisStatus, conditionType v1alpha2.RedisConditionType) bool {
+	condition := getCondition(status, conditionType)
+	return condition != nil && condition.Status == corev1.ConditionFalse
+}
@@ -0,0 +1,193 @@
+package stub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	status := &v1alpha2.RedisStatus{}
+
+	setCondition(status, 1, v1alpha2.RedisConfigValid, corev1.ConditionTrue, "Valid", "")
+	condition := getCondition(status, v1alpha2.RedisConfigValid)
+	if condition == nil || condition.Status != corev1.ConditionTrue || condition.LastTransitionTime.IsZero() {
+		t.Fatalf("got condition %+v", condition)
+	}
+
+	// resyncs leave the transition time alone
+	transition := metav1.NewTime(time.Now().Add(-time.Hour))
+	condition.LastTransitionTime = transition
+	setCondition(status, 2, v1alpha2.RedisConfigValid, corev1.ConditionTrue, "StillValid", "")
+
+	condition = getCondition(status, v1alpha2.RedisConfigValid)
+	if !condition.LastTransitionTime.Equal(&transition) {
+		t.Errorf("an unchanged status bumped the transition time to %v", condition.LastTransitionTime)
+	}
+
+	if condition.ObservedGeneration != 2 || condition.Reason != "StillValid" {
+		t.Errorf("got generation %d and reason %s, want 2 and StillValid", condition.ObservedGeneration, condition.Reason)
+	}
+
+	setCondition(status, 3, v1alpha2.RedisConfigValid, corev1.ConditionFalse, "Invalid", "maxMemory")
+	condition = getCondition(status, v1alpha2.RedisConfigValid)
+	if condition.LastTransitionTime.Equal(&transition) || condition.Message != "maxMemory" {
+		t.Errorf("got condition %+v after a flip", condition)
+	}
+
+	if len(status.Conditions) != 1 {
+		t.Errorf("got %d conditions, want 1", len(status.Conditions))
+	}
+}
+
+func TestSetReadyCondition(t *testing.T) {
+	allTrue := []v1alpha2.RedisConditionType{
+		v1alpha2.RedisConfigValid,
+		v1alpha2.RedisPolicyCompliant,
+		v1alpha2.RedisResourcesCreated,
+		v1alpha2.RedisDeploymentAvailable,
+	}
+
+	tests := []struct {
+		name string
+		// notTrue is the condition set to false, the others are true
+		notTrue v1alpha2.RedisConditionType
+		mutate  func(*v1alpha2.Redis, *v1alpha2.RedisStatus)
+		ready   corev1.ConditionStatus
+		reason  string
+		phase   v1alpha2.RedisPhase
+	}{
+		{
+			name:   "ready",
+			ready:  corev1.ConditionTrue,
+			reason: "Ready",
+			phase:  v1alpha2.RedisPhaseRunning,
+		},
+		{
+			name:    "invalid config",
+			notTrue: v1alpha2.RedisConfigValid,
+			ready:   corev1.ConditionFalse,
+			reason:  "ConfigValidNotTrue",
+			phase:   v1alpha2.RedisPhaseErred,
+		},
+		{
+			name:    "policy violation",
+			notTrue: v1alpha2.RedisPolicyCompliant,
+			ready:   corev1.ConditionFalse,
+			reason:  "PolicyCompliantNotTrue",
+			phase:   v1alpha2.RedisPhaseErred,
+		},
+		{
+			name:    "workload unavailable",
+			notTrue: v1alpha2.RedisDeploymentAvailable,
+			ready:   corev1.ConditionFalse,
+			reason:  "DeploymentAvailableNotTrue",
+			phase:   v1alpha2.RedisPhasePending,
+		},
+		{
+			name: "child not ready",
+			mutate: func(redis *v1alpha2.Redis, status *v1alpha2.RedisStatus) {
+				status.Children = []v1alpha2.RedisChildStatus{{Kind: "StatefulSet", Name: "cache"}}
+			},
+			ready:  corev1.ConditionFalse,
+			reason: "ChildNotReady",
+			phase:  v1alpha2.RedisPhasePending,
+		},
+		{
+			name: "replica link down",
+			mutate: func(redis *v1alpha2.Redis, status *v1alpha2.RedisStatus) {
+				status.Nodes = []v1alpha2.RedisNodeStatus{
+					{Name: "cache-0", Role: roleMaster},
+					{Name: "cache-1", Role: roleSlave, MasterLinkStatus: "down"},
+				}
+			},
+			ready:  corev1.ConditionFalse,
+			reason: "ReplicaLinkDown",
+			phase:  v1alpha2.RedisPhasePending,
+		},
+		{
+			name: "cluster slots not served",
+			mutate: func(redis *v1alpha2.Redis, status *v1alpha2.RedisStatus) {
+				redis.Spec.Topology.Mode = v1alpha2.RedisModeCluster
+				status.Cluster = &v1alpha2.RedisClusterStatus{State: "fail"}
+			},
+			ready:  corev1.ConditionFalse,
+			reason: "ClusterNotOk",
+			phase:  v1alpha2.RedisPhasePending,
+		},
+	}
+
+	for _, test := range tests {
+		redis := testRedis()
+		status := &v1alpha2.RedisStatus{}
+		for _, conditionType := range allTrue {
+			conditionStatus := corev1.ConditionTrue
+			if conditionType == test.notTrue {
+				conditionStatus = corev1.ConditionFalse
+			}
+
+			setCondition(status, redis.Generation, conditionType, conditionStatus, "", "")
+		}
+
+		if test.mutate != nil {
+			test.mutate(redis, status)
+		}
+
+		setReadyCondition(redis, status)
+
+		ready := getCondition(status, v1alpha2.RedisReady)
+		if ready == nil || ready.Status != test.ready || ready.Reason != test.reason {
+			t.Errorf("%s: got Ready %+v, want %s with reason %s", test.name, ready, test.ready, test.reason)
+		}
+
+		if status.Phase != test.phase {
+			t.Errorf("%s: got phase %s, want %s", test.name, status.Phase, test.phase)
+		}
+	}
+}
+
+func TestIsDeploymentReady(t *testing.T) {
+	replicas := int32(1)
+
+	tests := []struct {
+		name   string
+		deploy v1.Deployment
+		want   bool
+	}{
+		{
+			name: "rolled out",
+			deploy: v1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       v1.DeploymentSpec{Replicas: &replicas},
+				Status:     v1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1},
+			},
+			want: true,
+		},
+		{
+			name: "new generation not observed",
+			deploy: v1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       v1.DeploymentSpec{Replicas: &replicas},
+				Status:     v1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1},
+			},
+		},
+		{
+			// the old pod still runs next to the new one
+			name: "rolling",
+			deploy: v1.Deployment{
+				Spec:   v1.DeploymentSpec{Replicas: &replicas},
+				Status: v1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 1, ReadyReplicas: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if got := isDeploymentReady(&test.deploy); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
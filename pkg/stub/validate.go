@@ -2,60 +2,149 @@ package stub
 
 import (
 	"fmt"
-	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha1"
-	"regexp"
-	"strconv"
-	"strings"
-	"errors"
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	rConfig "github.com/flexshopper/redis-operator/pkg/config"
+	"github.com/flexshopper/redis-operator/pkg/memory"
+	"github.com/flexshopper/redis-operator/pkg/policy"
 )
 
-// Effective Go is your friend
-// https://golang.org/doc/effective_go.html#constants
-const (
-	maxMemory = "5gb"
-	BYTE = 1 << (10 * iota)
-	KILOBYTE
-	MEGABYTE
-	GIGABYTE
-	TERABYTE
-)
+// validationRules are the checks run on a spec, the names label the
+// validation failures metric and field is the part of the spec a rule looks
+// at. Rules that depend on other objects are skipped at admission, those may
+// well be created after the Redis.
+var validationRules = []struct {
+	name      string
+	field     string
+	admission bool
+	check     func(*v1alpha2.Redis) []string
+}{
+	{"maxMemory", "spec.maxMemory", true, validateMaxMemory},
+	{"passwordSecret", "spec.security.passwordSecret", false, validatePasswordSecret},
+	{"persistence", "spec.persistence", true, validatePersistence},
+	{"workload", "spec.persistence", false, validateWorkload},
+	{"sentinel", "spec.topology.sentinel", true, validateSentinel},
+	{"cluster", "spec.topology", true, validateCluster},
+	{"config", "spec.config", true, validateConfig},
+	{"monitoring", "spec.monitoring", true, validateMonitoring},
+	{"resources", "spec.resources", true, validateResources},
+	{"probes", "spec.probes", true, validateProbes},
+	{"scheduling", "spec.scheduling", true, validateScheduling},
+}
 
-func convertMemoryToBytes(memory string) (int64, error) {
-	r, _ := regexp.Compile("(\\d+)(\\w+)")
+// ValidationError is a validation failure of one field of a Redis
+type ValidationError struct {
+	Field   string
+	Message string
+}
 
-	matches := r.FindStringSubmatch(memory)
-	amount, _ := strconv.ParseInt(matches[1], 10, 64)
+// Validate runs the checks that don't depend on other objects and the
+// policy, for the admission webhook
+func Validate(redis *v1alpha2.Redis) []ValidationError {
+	var validationErrors []ValidationError
 
-	switch unit := strings.ToLower(matches[2]); unit {
-	case "b":
-		return int64(amount * BYTE), nil
-	case "kb":
-		return int64(amount * KILOBYTE), nil
-	case "mb":
-		return int64(amount * MEGABYTE), nil
-	case "gb":
-		return int64(amount * GIGABYTE), nil
-	case "tb":
-		return int64(amount * TERABYTE), nil
-	default:
-		return 0, errors.New("unsupported type")
+	for _, rule := range validationRules {
+		if !rule.admission {
+			continue
+		}
+
+		for _, message := range rule.check(redis) {
+			validationErrors = append(validationErrors, ValidationError{Field: rule.field, Message: message})
+		}
 	}
+
+	r := redis.DeepCopy()
+	r.SetDefaults()
+
+	for _, message := range policy.Current().Check(r) {
+		validationErrors = append(validationErrors, ValidationError{Field: "spec", Message: message})
+	}
+
+	return validationErrors
 }
 
-func validate(redis *v1alpha1.Redis) []string {
+// ValidateUpdate checks that the workload can take the changes from old to
+// redis, for the admission webhook. The operator checks them against the
+// running workload in validateWorkload.
+func ValidateUpdate(old, redis *v1alpha2.Redis) []ValidationError {
+	o := old.DeepCopy()
+	o.SetDefaults()
+	r := redis.DeepCopy()
+	r.SetDefaults()
 
-	var validationErrors []string
+	switch {
+	case usesStatefulSet(o) && !usesStatefulSet(r):
+		return []ValidationError{{Field: "spec", Message: statefulSetDroppedMessage(r)}}
+	case !usesStatefulSet(o) && clusterEnabled(r):
+		return []ValidationError{{Field: "spec.topology.mode", Message: clusterTakeoverMessage(r)}}
+	case !usesStatefulSet(o):
+		return nil
+	}
+
+	current, err := getVolumeClaimTemplates(o)
+	if err != nil {
+		return nil
+	}
+
+	desired, err := getVolumeClaimTemplates(r)
+	if err != nil {
+		// reported by validatePersistence
+		return nil
+	}
+
+	var validationErrors []ValidationError
+	for _, message := range claimTemplateChanges(current, desired) {
+		validationErrors = append(validationErrors, ValidationError{Field: "spec.persistence", Message: message})
+	}
+
+	return validationErrors
+}
 
-	maxMemoryBytes, _ := convertMemoryToBytes(maxMemory)
-	requestedMemoryBytes, _ := convertMemoryToBytes(redis.Spec.MaxMemory)
+func validate(redis *v1alpha2.Redis) []string {
 
-	if requestedMemoryBytes > maxMemoryBytes {
-		validationErrors = append(
-			validationErrors,
-			fmt.Sprintf("maxMemory setting ( %s ) greater than allowed maxMemory ( %s )",
-				maxMemory,
-				redis.Spec.MaxMemory))
+	var validationErrors []string
+
+	for _, rule := range validationRules {
+		ruleErrors := rule.check(redis)
+		observeValidationFailures(redis, rule.name, len(ruleErrors))
+		validationErrors = append(validationErrors, ruleErrors...)
 	}
 
 	return validationErrors
 }
+
+// validateMaxMemory only checks the notation, the limit is up to the policy
+func validateMaxMemory(r *v1alpha2.Redis) []string {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	_, err := memory.Parse(redis.Spec.MaxMemory)
+	if err != nil {
+		return []string{fmt.Sprintf("maxMemory setting ( %s ) is invalid: %v", redis.Spec.MaxMemory, err)}
+	}
+
+	return nil
+}
+
+// checkPolicy returns how a Redis breaks the policy currently loaded
+func checkPolicy(r *v1alpha2.Redis) []string {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	violations := policy.Current().Check(redis)
+	observeValidationFailures(r, "policy", len(violations))
+
+	return violations
+}
+
+// validateConfig checks spec.config against the redis version the image runs
+func validateConfig(r *v1alpha2.Redis) []string {
+	redis := r.DeepCopy()
+	redis.SetDefaults()
+
+	version, err := rConfig.ResolveVersion(&redis.Spec)
+	if err != nil {
+		return []string{fmt.Sprintf("redis version of image ( %s ) can't be used: %v", redis.Spec.Image, err)}
+	}
+
+	return rConfig.ValidateConfig(redis.Spec.Config, version)
+}
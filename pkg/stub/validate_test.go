@@ -0,0 +1,59 @@
+package stub
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*v1alpha2.Redis)
+		fields []string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "invalid maxMemory",
+			mutate: func(redis *v1alpha2.Redis) {
+				redis.Spec.MaxMemory = "lots"
+			},
+			fields: []string{"spec.maxMemory"},
+		},
+		{
+			name: "sentinel without replicas",
+			mutate: func(redis *v1alpha2.Redis) {
+				redis.Spec.Topology.Replicas = 0
+				redis.Spec.Topology.Sentinel = &v1alpha2.RedisSentinel{}
+			},
+			fields: []string{"spec.topology.sentinel"},
+		},
+		{
+			// the Secret may well be created after the Redis, the operator
+			// checks it when reconciling
+			name: "passwordSecret is left to the operator",
+			mutate: func(redis *v1alpha2.Redis) {
+				redis.Spec.Security.PasswordSecret = "created-later"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		redis := testRedis()
+		if test.mutate != nil {
+			test.mutate(redis)
+		}
+
+		var fields []string
+		for _, validationError := range Validate(redis) {
+			fields = append(fields, validationError.Field)
+		}
+
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("%s: got errors on %v, want %v", test.name, fields, test.fields)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+// Package webhook serves the admission webhooks of Redis objects: a mutating
+// one storing the defaults on the object, so it shows what actually runs,
+// and a validating one, so a bad spec is refused by kubectl apply instead of
+// only flipping the Redis to Erred on the next resync.
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha1"
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/flexshopper/redis-operator/pkg/stub"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The admission API isn't in the vendored tree, these are the parts of
+// admission.k8s.io/v1beta1 the webhook uses
+
+// AdmissionReview is what the API server posts and expects back
+type AdmissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *AdmissionRequest  `json:"request,omitempty"`
+	Response        *AdmissionResponse `json:"response,omitempty"`
+}
+
+type AdmissionRequest struct {
+	UID         types.UID                   `json:"uid"`
+	Kind        metav1.GroupVersionKind     `json:"kind"`
+	Resource    metav1.GroupVersionResource `json:"resource"`
+	SubResource string                      `json:"subResource,omitempty"`
+	Name        string                      `json:"name,omitempty"`
+	Namespace   string                      `json:"namespace,omitempty"`
+	Operation   string                      `json:"operation"`
+	Object      runtime.RawExtension        `json:"object,omitempty"`
+	OldObject   runtime.RawExtension        `json:"oldObject,omitempty"`
+}
+
+type AdmissionResponse struct {
+	UID       types.UID      `json:"uid"`
+	Allowed   bool           `json:"allowed"`
+	Result    *metav1.Status `json:"status,omitempty"`
+	Patch     []byte         `json:"patch,omitempty"`
+	PatchType *string        `json:"patchType,omitempty"`
+}
+
+// admitFunc decides on a request, the response UID is filled in by serve
+type admitFunc func(*AdmissionRequest) *AdmissionResponse
+
+// serve decodes an AdmissionReview, hands the request to admit and writes
+// the review back with the response
+func serve(admit admitFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+			http.Error(w, fmt.Sprintf("content type %s is not supported, expected application/json", contentType),
+				http.StatusUnsupportedMediaType)
+			return
+		}
+
+		review := &AdmissionReview{}
+		err = json.Unmarshal(body, review)
+		if err != nil || review.Request == nil {
+			http.Error(w, fmt.Sprintf("failed to decode admission review: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		response := admit(review.Request)
+		response.UID = review.Request.UID
+
+		out, err := json.Marshal(&AdmissionReview{
+			TypeMeta: review.TypeMeta,
+			Response: response,
+		})
+		if err != nil {
+			logrus.Errorf("failed to encode admission review with error : %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+	}
+}
+
+// validator admits the Redis objects of the namespace the operator watches,
+// all namespaces when it is empty
+type validator struct {
+	namespace string
+}
+
+func (v *validator) admit(request *AdmissionRequest) *AdmissionResponse {
+	// another operator instance looks after the other namespaces
+	if v.namespace != "" && request.Namespace != v.namespace {
+		return allowed()
+	}
+
+	if request.Operation != "CREATE" && request.Operation != "UPDATE" {
+		return allowed()
+	}
+
+	redis, err := decodeRedis(request.Kind.Version, request.Object.Raw)
+	if err != nil {
+		return denied(&metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: fmt.Sprintf("failed to decode Redis: %v", err),
+			Reason:  metav1.StatusReasonBadRequest,
+			Code:    http.StatusBadRequest,
+		})
+	}
+
+	// the operator writes status and finalizers, an update leaving the spec
+	// alone must go through even when the policy got stricter since
+	var old *v1alpha2.Redis
+	if request.Operation == "UPDATE" {
+		old, err = decodeRedis(request.Kind.Version, request.OldObject.Raw)
+		if err != nil {
+			old = nil
+		} else if reflect.DeepEqual(old.Spec, redis.Spec) {
+			return allowed()
+		}
+	}
+
+	// names are empty for generateName until the API server fills them in
+	if redis.Namespace == "" {
+		redis.Namespace = request.Namespace
+	}
+
+	validationErrors := stub.Validate(redis)
+	if old != nil {
+		validationErrors = append(validationErrors, stub.ValidateUpdate(old, redis)...)
+	}
+
+	if len(validationErrors) == 0 {
+		return allowed()
+	}
+
+	return denied(invalid(redis, validationErrors))
+}
+
+// defaulter stores the defaults of SetDefaults on the Redis objects of the
+// namespace the operator watches. Once stored, a default changed by a new
+// release of the operator doesn't alter the existing Redis objects.
+type defaulter struct {
+	namespace string
+}
+
+func (d *defaulter) admit(request *AdmissionRequest) *AdmissionResponse {
+	if d.namespace != "" && request.Namespace != d.namespace {
+		return allowed()
+	}
+
+	if request.Operation != "CREATE" && request.Operation != "UPDATE" {
+		return allowed()
+	}
+
+	// the defaults are written in the version of the request
+	var spec interface{}
+	var changed bool
+	switch request.Kind.Version {
+	case v1alpha1.SchemeGroupVersion.Version:
+		redis := &v1alpha1.Redis{}
+		err := json.Unmarshal(request.Object.Raw, redis)
+		if err != nil {
+			// the validating webhook reports it
+			return allowed()
+		}
+
+		changed = redis.SetDefaults()
+		spec = &redis.Spec
+	default:
+		redis := &v1alpha2.Redis{}
+		err := json.Unmarshal(request.Object.Raw, redis)
+		if err != nil {
+			return allowed()
+		}
+
+		changed = redis.SetDefaults()
+		spec = &redis.Spec
+	}
+
+	if !changed {
+		return allowed()
+	}
+
+	patch, err := specPatch(request.Object.Raw, spec)
+	if err != nil {
+		logrus.Errorf("failed to build defaults patch for %s/%s with error : %v", request.Namespace, request.Name, err)
+		return allowed()
+	}
+
+	if patch == nil {
+		return allowed()
+	}
+
+	patchType := "JSONPatch"
+	response := allowed()
+	response.Patch = patch
+	response.PatchType = &patchType
+	return response
+}
+
+// specPatch is the JSON patch adding the fields of spec missing from, or
+// different in, the spec of the raw object. Only the fields of spec the
+// operator knows are touched, others are left as they are.
+func specPatch(raw []byte, spec interface{}) ([]byte, error) {
+	var object struct {
+		Spec map[string]json.RawMessage `json:"spec"`
+	}
+
+	err := json.Unmarshal(raw, &object)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var desired map[string]json.RawMessage
+	err = json.Unmarshal(data, &desired)
+	if err != nil {
+		return nil, err
+	}
+
+	type operation struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+
+	var operations []operation
+
+	if object.Spec == nil {
+		operations = append(operations, operation{Op: "add", Path: "/spec", Value: data})
+	} else {
+		keys := make([]string, 0, len(desired))
+		for key := range desired {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if current, ok := object.Spec[key]; ok && jsonEqual(current, desired[key]) {
+				continue
+			}
+
+			// add replaces a member already there
+			operations = append(operations, operation{Op: "add", Path: "/spec/" + escapePointer(key), Value: desired[key]})
+		}
+	}
+
+	if len(operations) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(operations)
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(x, y)
+}
+
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// decodeRedis decodes a Redis of either version as the v1alpha2 the
+// operator works with
+func decodeRedis(version string, raw []byte) (*v1alpha2.Redis, error) {
+	if version == v1alpha1.SchemeGroupVersion.Version {
+		old := &v1alpha1.Redis{}
+		err := json.Unmarshal(raw, old)
+		if err != nil {
+			return nil, err
+		}
+
+		redis := &v1alpha2.Redis{}
+		err = old.ConvertTo(redis)
+		if err != nil {
+			return nil, err
+		}
+
+		return redis, nil
+	}
+
+	redis := &v1alpha2.Redis{}
+	err := json.Unmarshal(raw, redis)
+	if err != nil {
+		return nil, err
+	}
+
+	return redis, nil
+}
+
+func allowed() *AdmissionResponse {
+	return &AdmissionResponse{Allowed: true}
+}
+
+func denied(status *metav1.Status) *AdmissionResponse {
+	return &AdmissionResponse{
+		Allowed: false,
+		Result:  status,
+	}
+}
+
+// invalid is the status the API server answers kubectl with, the same shape
+// as its own validation errors
+func invalid(redis *v1alpha2.Redis, validationErrors []stub.ValidationError) *metav1.Status {
+	details := &metav1.StatusDetails{
+		Name:  redis.Name,
+		Group: v1alpha2.SchemeGroupVersion.Group,
+		Kind:  "Redis",
+	}
+
+	message := fmt.Sprintf("Redis %q is invalid:", redis.Name)
+	for i, validationError := range validationErrors {
+		if i > 0 {
+			message += ","
+		}
+
+		message += fmt.Sprintf(" %s: %s", validationError.Field, validationError.Message)
+		details.Causes = append(details.Causes, metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: validationError.Message,
+			Field:   validationError.Field,
+		})
+	}
+
+	return &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Message: message,
+		Reason:  metav1.StatusReasonInvalid,
+		Details: details,
+		Code:    http.StatusUnprocessableEntity,
+	}
+}
@@ -0,0 +1,337 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha1"
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func redisRequest(operation, version, object, oldObject string) *AdmissionRequest {
+	request := &AdmissionRequest{
+		UID:       "uid",
+		Kind:      metav1.GroupVersionKind{Group: v1alpha2.SchemeGroupVersion.Group, Version: version, Kind: "Redis"},
+		Name:      "cache",
+		Namespace: "default",
+		Operation: operation,
+		Object:    runtime.RawExtension{Raw: []byte(object)},
+	}
+
+	if oldObject != "" {
+		request.OldObject = runtime.RawExtension{Raw: []byte(oldObject)}
+	}
+
+	return request
+}
+
+// applyPatch applies the add operations of a JSON patch, the only ones the
+// defaulter sends
+func applyPatch(t *testing.T, object string, patch []byte) map[string]interface{} {
+	var target map[string]interface{}
+	err := json.Unmarshal([]byte(object), &target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var operations []struct {
+		Op    string
+		Path  string
+		Value interface{}
+	}
+	err = json.Unmarshal(patch, &operations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, operation := range operations {
+		if operation.Op != "add" {
+			t.Fatalf("got operation %s", operation.Op)
+		}
+
+		tokens := strings.Split(strings.TrimPrefix(operation.Path, "/"), "/")
+		parent := target
+		for _, token := range tokens[:len(tokens)-1] {
+			parent = parent[token].(map[string]interface{})
+		}
+
+		last := strings.Replace(strings.Replace(tokens[len(tokens)-1], "~1", "/", -1), "~0", "~", -1)
+		parent[last] = operation.Value
+	}
+
+	return target
+}
+
+func TestDefaulter(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation string
+		version   string
+		namespace string
+		object    string
+		// patched is whether a patch is sent back
+		patched bool
+		// kept are spec fields the patch must leave as they are
+		kept map[string]interface{}
+	}{
+		{
+			name:      "no spec",
+			operation: "CREATE",
+			object:    `{"metadata": {"name": "cache"}}`,
+			patched:   true,
+		},
+		{
+			name:      "some fields set",
+			operation: "CREATE",
+			object:    `{"metadata": {"name": "cache"}, "spec": {"maxMemory": "1gb", "unknown": "field"}}`,
+			patched:   true,
+			kept:      map[string]interface{}{"maxMemory": "1gb", "unknown": "field"},
+		},
+		{
+			name:      "update",
+			operation: "UPDATE",
+			object:    `{"metadata": {"name": "cache"}, "spec": {"port": 6380}}`,
+			patched:   true,
+			kept:      map[string]interface{}{"port": float64(6380)},
+		},
+		{
+			name:      "v1alpha1",
+			operation: "CREATE",
+			version:   v1alpha1.SchemeGroupVersion.Version,
+			object:    `{"metadata": {"name": "cache"}, "spec": {}}`,
+			patched:   true,
+		},
+		{
+			name:      "delete",
+			operation: "DELETE",
+			object:    `{"metadata": {"name": "cache"}}`,
+		},
+		{
+			name:      "another namespace",
+			operation: "CREATE",
+			namespace: "elsewhere",
+			object:    `{"metadata": {"name": "cache"}}`,
+		},
+		{
+			name:      "not a Redis",
+			operation: "CREATE",
+			object:    `{"spec": []}`,
+		},
+	}
+
+	for _, test := range tests {
+		version := test.version
+		if version == "" {
+			version = v1alpha2.SchemeGroupVersion.Version
+		}
+
+		request := redisRequest(test.operation, version, test.object, "")
+		if test.namespace != "" {
+			request.Namespace = test.namespace
+		}
+
+		d := &defaulter{namespace: "default"}
+		response := d.admit(request)
+		if !response.Allowed {
+			t.Errorf("%s: denied", test.name)
+			continue
+		}
+
+		if patched := response.Patch != nil; patched != test.patched {
+			t.Errorf("%s: got a patch %v, want %v", test.name, patched, test.patched)
+			continue
+		}
+
+		if !test.patched {
+			continue
+		}
+
+		if response.PatchType == nil || *response.PatchType != "JSONPatch" {
+			t.Errorf("%s: got patch type %v", test.name, response.PatchType)
+		}
+
+		spec := applyPatch(t, test.object, response.Patch)["spec"].(map[string]interface{})
+		for key, value := range test.kept {
+			if !reflect.DeepEqual(spec[key], value) {
+				t.Errorf("%s: got %s %v, want %v", test.name, key, spec[key], value)
+			}
+		}
+
+		if version != v1alpha2.SchemeGroupVersion.Version {
+			continue
+		}
+
+		// the patched object is defaulted, patching it again changes nothing
+		raw, _ := json.Marshal(map[string]interface{}{"spec": spec})
+		redis := &v1alpha2.Redis{}
+		if err := json.Unmarshal(raw, redis); err != nil {
+			t.Fatal(err)
+		}
+
+		if redis.SetDefaults() {
+			t.Errorf("%s: the patched spec misses defaults: %s", test.name, raw)
+		}
+
+		if again := d.admit(redisRequest(test.operation, version, string(raw), "")); again.Patch != nil {
+			t.Errorf("%s: patched again with %s", test.name, again.Patch)
+		}
+	}
+}
+
+func TestSpecPatchEscapes(t *testing.T) {
+	patch, err := specPatch([]byte(`{"spec": {}}`), map[string]string{"a/b~c": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[{"op":"add","path":"/spec/a~1b~0c","value":"x"}]`
+	if string(patch) != want {
+		t.Errorf("got %s, want %s", patch, want)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	valid := `{"metadata": {"name": "cache", "namespace": "default"}, "spec": {"maxMemory": "1gb"}}`
+	invalid := `{"metadata": {"name": "cache", "namespace": "default"}, "spec": {"maxMemory": "lots"}}`
+
+	tests := []struct {
+		name      string
+		request   *AdmissionRequest
+		allowed   bool
+		code      int32
+		field     string
+		namespace string
+	}{
+		{
+			name:    "valid",
+			request: redisRequest("CREATE", "v1alpha2", valid, ""),
+			allowed: true,
+		},
+		{
+			name:    "invalid",
+			request: redisRequest("CREATE", "v1alpha2", invalid, ""),
+			code:    http.StatusUnprocessableEntity,
+			field:   "spec.maxMemory",
+		},
+		{
+			name:    "invalid v1alpha1",
+			request: redisRequest("CREATE", "v1alpha1", invalid, ""),
+			code:    http.StatusUnprocessableEntity,
+			field:   "spec.maxMemory",
+		},
+		{
+			name:    "update of the spec",
+			request: redisRequest("UPDATE", "v1alpha2", invalid, valid),
+			code:    http.StatusUnprocessableEntity,
+			field:   "spec.maxMemory",
+		},
+		{
+			name:    "update leaving the spec alone",
+			request: redisRequest("UPDATE", "v1alpha2", invalid, invalid),
+			allowed: true,
+		},
+		{
+			name:    "delete",
+			request: redisRequest("DELETE", "v1alpha2", invalid, ""),
+			allowed: true,
+		},
+		{
+			name:    "undecodable",
+			request: redisRequest("CREATE", "v1alpha2", `{"spec": []}`, ""),
+			code:    http.StatusBadRequest,
+		},
+		{
+			name:      "another namespace",
+			request:   redisRequest("CREATE", "v1alpha2", invalid, ""),
+			namespace: "elsewhere",
+			allowed:   true,
+		},
+	}
+
+	for _, test := range tests {
+		if test.namespace != "" {
+			test.request.Namespace = test.namespace
+		}
+
+		v := &validator{namespace: "default"}
+		response := v.admit(test.request)
+		if response.Allowed != test.allowed {
+			t.Errorf("%s: got allowed %v, want %v", test.name, response.Allowed, test.allowed)
+			continue
+		}
+
+		if test.allowed {
+			continue
+		}
+
+		if response.Result == nil || response.Result.Code != test.code {
+			t.Errorf("%s: got status %+v, want code %d", test.name, response.Result, test.code)
+			continue
+		}
+
+		if test.field == "" {
+			continue
+		}
+
+		details := response.Result.Details
+		if details == nil || len(details.Causes) == 0 || details.Causes[0].Field != test.field {
+			t.Errorf("%s: got details %+v, want a cause on %s", test.name, details, test.field)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	handler := serve((&validator{}).admit)
+
+	review, err := json.Marshal(&AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1beta1", Kind: "AdmissionReview"},
+		Request:  redisRequest("CREATE", "v1alpha2", `{"metadata": {"name": "cache"}}`, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		code        int
+	}{
+		{name: "review", contentType: "application/json", body: review, code: http.StatusOK},
+		{name: "content type", contentType: "text/plain", body: review, code: http.StatusUnsupportedMediaType},
+		{name: "no request", contentType: "application/json", body: []byte(`{}`), code: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("POST", "/validate", bytes.NewReader(test.body))
+		request.Header.Set("Content-Type", test.contentType)
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s: got code %d, want %d", test.name, recorder.Code, test.code)
+			continue
+		}
+
+		if test.code != http.StatusOK {
+			continue
+		}
+
+		response := &AdmissionReview{}
+		err := json.Unmarshal(recorder.Body.Bytes(), response)
+		if err != nil || response.Response == nil || response.Response.UID != "uid" || !response.Response.Allowed {
+			t.Errorf("%s: got %s, %v", test.name, recorder.Body.String(), err)
+		}
+
+		if response.Kind != "AdmissionReview" {
+			t.Errorf("%s: got kind %q", test.name, response.Kind)
+		}
+	}
+}
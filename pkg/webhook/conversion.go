@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha1"
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ConversionReview is what the API server posts to convert Redis objects
+// between versions, from apiextensions.k8s.io/v1beta1 which isn't in the
+// vendored tree
+type ConversionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *ConversionRequest  `json:"request,omitempty"`
+	Response        *ConversionResponse `json:"response,omitempty"`
+}
+
+type ConversionRequest struct {
+	UID               types.UID              `json:"uid"`
+	DesiredAPIVersion string                 `json:"desiredAPIVersion"`
+	Objects           []runtime.RawExtension `json:"objects"`
+}
+
+type ConversionResponse struct {
+	UID              types.UID              `json:"uid"`
+	ConvertedObjects []runtime.RawExtension `json:"convertedObjects"`
+	Result           metav1.Status          `json:"result"`
+}
+
+// serveConversion converts the objects of a ConversionReview, the objects
+// are all converted or the review fails
+func serveConversion(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review := &ConversionReview{}
+	err = json.Unmarshal(body, review)
+	if err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("failed to decode conversion review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response := &ConversionResponse{
+		UID:    review.Request.UID,
+		Result: metav1.Status{Status: metav1.StatusSuccess},
+	}
+
+	for _, object := range review.Request.Objects {
+		converted, err := convert(object.Raw, review.Request.DesiredAPIVersion)
+		if err != nil {
+			logrus.Errorf("failed to convert Redis to %s with error : %v", review.Request.DesiredAPIVersion, err)
+			response.ConvertedObjects = nil
+			response.Result = metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: err.Error(),
+			}
+			break
+		}
+
+		response.ConvertedObjects = append(response.ConvertedObjects, runtime.RawExtension{Raw: converted})
+	}
+
+	out, err := json.Marshal(&ConversionReview{
+		TypeMeta: review.TypeMeta,
+		Response: response,
+	})
+	if err != nil {
+		logrus.Errorf("failed to encode conversion review with error : %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// convert converts a Redis to apiVersion, through v1alpha2 which has room
+// for everything
+func convert(raw []byte, apiVersion string) ([]byte, error) {
+	var typeMeta metav1.TypeMeta
+	err := json.Unmarshal(raw, &typeMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	if typeMeta.Kind != "Redis" {
+		return nil, fmt.Errorf("can't convert a %s", typeMeta.Kind)
+	}
+
+	if typeMeta.APIVersion == apiVersion {
+		return raw, nil
+	}
+
+	hub := &v1alpha2.Redis{}
+	switch typeMeta.APIVersion {
+	case v1alpha1.SchemeGroupVersion.String():
+		redis := &v1alpha1.Redis{}
+		err = json.Unmarshal(raw, redis)
+		if err != nil {
+			return nil, err
+		}
+
+		err = redis.ConvertTo(hub)
+	case v1alpha2.SchemeGroupVersion.String():
+		err = json.Unmarshal(raw, hub)
+	default:
+		return nil, fmt.Errorf("can't convert from %s", typeMeta.APIVersion)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch apiVersion {
+	case v1alpha1.SchemeGroupVersion.String():
+		redis := &v1alpha1.Redis{}
+		err = redis.ConvertFrom(hub)
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(redis)
+	case v1alpha2.SchemeGroupVersion.String():
+		return json.Marshal(hub)
+	}
+
+	return nil, fmt.Errorf("can't convert to %s", apiVersion)
+}
@@ -0,0 +1,377 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sclient"
+	"github.com/operator-framework/operator-sdk/pkg/sdk"
+	"github.com/sirupsen/logrus"
+	admissionv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+const (
+	validatePath      = "/validate"
+	defaultPath       = "/default"
+	convertPath       = "/convert"
+	crdName           = "redises.cache.flexshopper.com"
+	validatingWebhook = "redis.validate.cache.flexshopper.com"
+	mutatingWebhook   = "redis.default.cache.flexshopper.com"
+
+	// the serving certificate is valid for a year, it is replaced well
+	// before that and the configuration is checked at the same pace
+	certRenewBefore = 30 * 24 * time.Hour
+	refreshInterval = time.Hour
+)
+
+// Options are the command line flags of the webhook
+type Options struct {
+	Port int
+	// Service is the Service in front of the operator pod, the name the
+	// certificate is issued for
+	Service string
+	// ConfigName is the name of the Validating and the
+	// MutatingWebhookConfiguration the operator owns
+	ConfigName string
+}
+
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.Port, "webhook-port", 8443, "port of the admission webhook, 0 disables it")
+	fs.StringVar(&o.Service, "webhook-service", "redis-operator-webhook", "Service the API server reaches the admission webhook through")
+	fs.StringVar(&o.ConfigName, "webhook-config-name", "redis-operator", "name of the webhook configurations registering the webhooks, the namespace is appended")
+}
+
+// Server serves the admission webhooks with a certificate of its own and
+// keeps the webhook configurations trusting it, no cert-manager needed
+type Server struct {
+	port       int
+	service    string
+	namespace  string
+	configName string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	caBundle []byte
+	notAfter time.Time
+}
+
+// NewServer serves the webhook for the Redis objects of namespace, the one
+// the operator runs and watches in
+func NewServer(o *Options, namespace string) (*Server, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("the admission webhook needs the namespace of the operator")
+	}
+
+	return &Server{
+		port:       o.Port,
+		service:    o.Service,
+		namespace:  namespace,
+		configName: o.ConfigName + "-" + namespace,
+	}, nil
+}
+
+// Run registers the webhooks and serves them until the server fails
+func (s *Server) Run(stop <-chan struct{}) error {
+	err := s.refresh()
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(validatePath, serve((&validator{namespace: s.namespace}).admit))
+	mux.Handle(defaultPath, serve((&defaulter{namespace: s.namespace}).admit))
+	mux.HandleFunc(convertPath, serveConversion)
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.port),
+		Handler: mux,
+		TLSConfig: &tls.Config{
+			GetCertificate: s.getCertificate,
+		},
+	}
+
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				server.Close()
+				return
+			case <-ticker.C:
+			}
+
+			err := s.refresh()
+			if err != nil {
+				logrus.Errorf("failed to refresh admission webhook with error : %v", err)
+			}
+		}
+	}()
+
+	logrus.Infof("serving admission webhook on %s", server.Addr)
+	err = server.ListenAndServeTLS("", "")
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cert, nil
+}
+
+// refresh renews the certificate when it gets close to expiring and puts
+// the webhook configurations and the conversion of the CRD back in line,
+// whoever changed them
+func (s *Server) refresh() error {
+	s.mu.RLock()
+	renew := s.cert == nil || time.Until(s.notAfter) < certRenewBefore
+	s.mu.RUnlock()
+
+	if renew {
+		err := s.generateCertificate()
+		if err != nil {
+			return fmt.Errorf("failed to generate serving certificate: %v", err)
+		}
+	}
+
+	err := s.registerValidating()
+	if err != nil {
+		return err
+	}
+
+	err = s.registerMutating()
+	if err != nil {
+		return err
+	}
+
+	return s.registerConversion()
+}
+
+// generateCertificate issues a certificate for the Service from a CA of its
+// own, the CA goes into the caBundle
+func (s *Server) generateCertificate() error {
+	host := fmt.Sprintf("%s.%s.svc", s.service, s.namespace)
+	certPEM, keyPEM, err := certutil.GenerateSelfSignedCertKey(host, nil, []string{
+		s.service,
+		fmt.Sprintf("%s.%s", s.service, s.namespace),
+		host + ".cluster.local",
+	})
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	// the serving certificate is followed by the CA that signed it
+	var caBundle []byte
+	for rest := certPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		caBundle = pem.EncodeToMemory(block)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cert = &cert
+	s.caBundle = caBundle
+	s.notAfter = leaf.NotAfter
+	return nil
+}
+
+// webhook is the registration of the webhook served on path, with the
+// current caBundle
+func (s *Server) webhook(name, path string) admissionv1beta1.Webhook {
+	s.mu.RLock()
+	caBundle := s.caBundle
+	s.mu.RUnlock()
+
+	// the Redis is defaulted and validated again on every resync, an
+	// operator that is down mustn't keep anybody from editing Redis objects
+	failurePolicy := admissionv1beta1.Ignore
+
+	return admissionv1beta1.Webhook{
+		Name: name,
+		ClientConfig: admissionv1beta1.WebhookClientConfig{
+			Service: &admissionv1beta1.ServiceReference{
+				Namespace: s.namespace,
+				Name:      s.service,
+				Path:      &path,
+			},
+			CABundle: caBundle,
+		},
+		Rules: []admissionv1beta1.RuleWithOperations{{
+			Operations: []admissionv1beta1.OperationType{admissionv1beta1.Create, admissionv1beta1.Update},
+			Rule: admissionv1beta1.Rule{
+				APIGroups:   []string{"cache.flexshopper.com"},
+				APIVersions: []string{"*"},
+				Resources:   []string{"redises"},
+			},
+		}},
+		FailurePolicy: &failurePolicy,
+	}
+}
+
+// webhooksEqual compares registered webhooks with the ones of the operator,
+// leaving out the fields the API server defaults
+func webhooksEqual(current, desired []admissionv1beta1.Webhook) bool {
+	current = append([]admissionv1beta1.Webhook(nil), current...)
+	for i := range current {
+		current[i].NamespaceSelector = nil
+	}
+
+	return reflect.DeepEqual(current, desired)
+}
+
+// registerValidating creates or updates the ValidatingWebhookConfiguration
+// pointing the API server at the validating webhook
+func (s *Server) registerValidating() error {
+	webhooks := []admissionv1beta1.Webhook{s.webhook(validatingWebhook, validatePath)}
+	client := k8sclient.GetKubeClient().AdmissionregistrationV1beta1().ValidatingWebhookConfigurations()
+
+	config, err := client.Get(s.configName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.Create(&admissionv1beta1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: s.configName,
+			},
+			Webhooks: webhooks,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create ValidatingWebhookConfiguration %s: %v", s.configName, err)
+		}
+
+		logrus.Infof("registered validating webhook %s", s.configName)
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get ValidatingWebhookConfiguration %s: %v", s.configName, err)
+	}
+
+	if webhooksEqual(config.Webhooks, webhooks) {
+		return nil
+	}
+
+	config.Webhooks = webhooks
+	_, err = client.Update(config)
+	if err != nil {
+		return fmt.Errorf("failed to update ValidatingWebhookConfiguration %s: %v", s.configName, err)
+	}
+
+	logrus.Infof("updated validating webhook %s", s.configName)
+	return nil
+}
+
+// registerMutating creates or updates the MutatingWebhookConfiguration
+// pointing the API server at the defaulting webhook
+func (s *Server) registerMutating() error {
+	webhooks := []admissionv1beta1.Webhook{s.webhook(mutatingWebhook, defaultPath)}
+	client := k8sclient.GetKubeClient().AdmissionregistrationV1beta1().MutatingWebhookConfigurations()
+
+	config, err := client.Get(s.configName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.Create(&admissionv1beta1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: s.configName,
+			},
+			Webhooks: webhooks,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create MutatingWebhookConfiguration %s: %v", s.configName, err)
+		}
+
+		logrus.Infof("registered defaulting webhook %s", s.configName)
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get MutatingWebhookConfiguration %s: %v", s.configName, err)
+	}
+
+	if webhooksEqual(config.Webhooks, webhooks) {
+		return nil
+	}
+
+	config.Webhooks = webhooks
+	_, err = client.Update(config)
+	if err != nil {
+		return fmt.Errorf("failed to update MutatingWebhookConfiguration %s: %v", s.configName, err)
+	}
+
+	logrus.Infof("updated defaulting webhook %s", s.configName)
+	return nil
+}
+
+// registerConversion points the CRD conversion at the webhook with the
+// current caBundle. The CRD is shared by every operator instance, the
+// last one to start converts for all of them.
+func (s *Server) registerConversion() error {
+	s.mu.RLock()
+	caBundle := s.caBundle
+	s.mu.RUnlock()
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"conversion": map[string]interface{}{
+				"strategy":                 "Webhook",
+				"conversionReviewVersions": []string{"v1beta1"},
+				"webhookClientConfig": map[string]interface{}{
+					"service": map[string]interface{}{
+						"namespace": s.namespace,
+						"name":      s.service,
+						"path":      convertPath,
+					},
+					"caBundle": caBundle,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1beta1")
+	crd.SetKind("CustomResourceDefinition")
+	crd.SetName(crdName)
+
+	// the API server doesn't write an unchanged CRD
+	err = sdk.Patch(crd, types.MergePatchType, patch)
+	if err != nil {
+		return fmt.Errorf("failed to patch conversion of CustomResourceDefinition %s: %v", crdName, err)
+	}
+
+	return nil
+}
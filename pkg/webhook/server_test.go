@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testServer(t *testing.T) *Server {
+	s, err := NewServer(&Options{Port: 8443, Service: "redis-operator-webhook", ConfigName: "redis-operator"}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestNewServer(t *testing.T) {
+	if _, err := NewServer(&Options{}, ""); err == nil {
+		t.Errorf("got a server without a namespace")
+	}
+
+	if s := testServer(t); s.configName != "redis-operator-default" {
+		t.Errorf("got config name %s", s.configName)
+	}
+}
+
+func TestGenerateCertificate(t *testing.T) {
+	s := testServer(t)
+	err := s.generateCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := s.getCertificate(nil)
+	if err != nil || cert == nil {
+		t.Fatalf("got certificate %v, %v", cert, err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(s.caBundle)
+	if block == nil {
+		t.Fatalf("got caBundle %s", s.caBundle)
+	}
+
+	ca, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	// the API server dials the Service by its namespaced name
+	for _, name := range []string{"redis-operator-webhook.default.svc", "redis-operator-webhook.default"} {
+		_, err = leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots})
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	if !s.notAfter.Equal(leaf.NotAfter) {
+		t.Errorf("got notAfter %v, want %v", s.notAfter, leaf.NotAfter)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	s := testServer(t)
+	s.caBundle = []byte("ca")
+
+	webhook := s.webhook(validatingWebhook, validatePath)
+	service := webhook.ClientConfig.Service
+	if service == nil || service.Namespace != "default" || service.Name != "redis-operator-webhook" ||
+		service.Path == nil || *service.Path != validatePath {
+		t.Errorf("got service %+v", service)
+	}
+
+	if string(webhook.ClientConfig.CABundle) != "ca" {
+		t.Errorf("got caBundle %s", webhook.ClientConfig.CABundle)
+	}
+
+	// an operator that is down mustn't block edits
+	if webhook.FailurePolicy == nil || *webhook.FailurePolicy != admissionv1beta1.Ignore {
+		t.Errorf("got failure policy %v", webhook.FailurePolicy)
+	}
+}
+
+func TestWebhooksEqual(t *testing.T) {
+	s := testServer(t)
+	s.caBundle = []byte("ca")
+	desired := []admissionv1beta1.Webhook{s.webhook(validatingWebhook, validatePath)}
+
+	defaulted := s.webhook(validatingWebhook, validatePath)
+	defaulted.NamespaceSelector = &metav1.LabelSelector{}
+	if !webhooksEqual([]admissionv1beta1.Webhook{defaulted}, desired) {
+		t.Errorf("a namespaceSelector defaulted by the API server counts as a change")
+	}
+
+	if defaulted.NamespaceSelector == nil {
+		t.Errorf("webhooksEqual changed the registered webhook")
+	}
+
+	s.caBundle = []byte("renewed")
+	renewed := []admissionv1beta1.Webhook{s.webhook(validatingWebhook, validatePath)}
+	if webhooksEqual(desired, renewed) {
+		t.Errorf("a renewed caBundle doesn't count as a change")
+	}
+
+	if webhooksEqual(nil, desired) {
+		t.Errorf("a missing webhook doesn't count as a change")
+	}
+}
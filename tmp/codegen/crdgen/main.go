@@ -0,0 +1,216 @@
+// crdgen writes deploy/crd.yaml, the Redis CRD with an OpenAPI schema
+// generated from the Go types. The schema is structural so that fields
+// unknown to the operator, typos included, are pruned by the API server.
+//
+//	go run tmp/codegen/crdgen/main.go > deploy/crd.yaml
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha1"
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type schema map[string]interface{}
+
+// memoryPattern accepts redis.conf sizes (100mb, 1g) and kubernetes
+// quantities (512Mi), the operator parses the value for good
+const memoryPattern = `^[0-9]+(\.[0-9]+)?([eE][0-9]+|[bBkKmMgGtTpPeE]|[kKmMgG][bB]|[KMGTPE]i)?$`
+
+var port = schema{"minimum": 1, "maximum": 65535}
+
+var modes = schema{"enum": []string{string(v1alpha2.RedisModeStandalone), string(v1alpha2.RedisModeCluster)}}
+
+// constraints are added to the schema of the fields at these paths, what
+// the Go types can't tell. The paths of every version are listed.
+var constraints = map[string]schema{
+	"spec.port":      port,
+	"spec.maxMemory": {"pattern": memoryPattern},
+	"spec.maxMemoryEvictionPolicy": {"enum": []string{
+		"volatile-lru", "allkeys-lru", "volatile-lfu", "allkeys-lfu",
+		"volatile-random", "allkeys-random", "volatile-ttl", "noeviction",
+	}},
+	"spec.mode":                       modes,
+	"spec.replicas":                   {"minimum": 0},
+	"spec.shards":                     {"minimum": 0},
+	"spec.replicasPerShard":           {"minimum": 0},
+	"spec.sentinel.replicas":          {"minimum": 0},
+	"spec.sentinel.quorum":            {"minimum": 0},
+	"spec.topology.mode":              modes,
+	"spec.topology.replicas":          {"minimum": 0},
+	"spec.topology.shards":            {"minimum": 0},
+	"spec.topology.replicasPerShard":  {"minimum": 0},
+	"spec.topology.sentinel.replicas": {"minimum": 0},
+	"spec.topology.sentinel.quorum":   {"minimum": 0},
+	"spec.monitoring.port":            port,
+	"spec.memoryOverheadPercent":      {"minimum": 0},
+	"spec.persistence.accessModes.":   {"enum": []string{"ReadWriteOnce", "ReadOnlyMany", "ReadWriteMany"}},
+
+	"spec.topology.sentinel.downAfterMilliseconds": {"minimum": 0},
+	"spec.topology.sentinel.failoverTimeout":       {"minimum": 0},
+	"spec.topology.sentinel.parallelSyncs":         {"minimum": 0},
+
+	"spec.scheduling.topologySpreadConstraints..maxSkew":           {"minimum": 1},
+	"spec.scheduling.topologySpreadConstraints..whenUnsatisfiable": {"enum": []string{"DoNotSchedule", "ScheduleAnyway"}},
+}
+
+var (
+	timeType     = reflect.TypeOf(metav1.Time{})
+	quantityType = reflect.TypeOf(resource.Quantity{})
+)
+
+// typeSchema is the schema of the values of t, path is the JSON path of
+// the field with a trailing dot for the items of arrays
+func typeSchema(t reflect.Type, path string) schema {
+	s := schema{}
+
+	switch {
+	case t == timeType:
+		// a zero time is written as null
+		s["type"] = "string"
+		s["format"] = "date-time"
+		s["nullable"] = true
+	case t == quantityType:
+		s["anyOf"] = []schema{{"type": "integer"}, {"type": "string"}}
+		s["x-kubernetes-int-or-string"] = true
+	case t.Kind() == reflect.Ptr:
+		s = typeSchema(t.Elem(), path)
+		s["nullable"] = true
+		return s
+	case t.Kind() == reflect.Struct:
+		s["type"] = "object"
+		properties := schema{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+
+			properties[name] = typeSchema(field.Type, strings.TrimPrefix(path+"."+name, "."))
+		}
+		s["properties"] = properties
+	case t.Kind() == reflect.Slice:
+		s["type"] = "array"
+		s["items"] = typeSchema(t.Elem(), path+".")
+	case t.Kind() == reflect.Map:
+		s["type"] = "object"
+		s["additionalProperties"] = typeSchema(t.Elem(), path+".")
+	case t.Kind() == reflect.String:
+		s["type"] = "string"
+	case t.Kind() == reflect.Bool:
+		s["type"] = "boolean"
+	case t.Kind() == reflect.Int32:
+		s["type"] = "integer"
+		s["format"] = "int32"
+	case t.Kind() == reflect.Int64:
+		s["type"] = "integer"
+		s["format"] = "int64"
+	default:
+		panic(fmt.Sprintf("no schema for %s at %s", t, path))
+	}
+
+	for key, value := range constraints[path] {
+		s[key] = value
+	}
+
+	return s
+}
+
+// redisSchema is the schema of a Redis of one version, metadata is left to
+// the API server
+func redisSchema(spec, status interface{}) schema {
+	return schema{
+		"type": "object",
+		"properties": schema{
+			"apiVersion": schema{"type": "string"},
+			"kind":       schema{"type": "string"},
+			"metadata":   schema{"type": "object"},
+			"spec":       typeSchema(reflect.TypeOf(spec), "spec"),
+			"status":     typeSchema(reflect.TypeOf(status), "status"),
+		},
+	}
+}
+
+// crd is the Redis CustomResourceDefinition
+func crd() schema {
+	return schema{
+		"apiVersion": "apiextensions.k8s.io/v1beta1",
+		"kind":       "CustomResourceDefinition",
+		"metadata": schema{
+			"name": "redises.cache.flexshopper.com",
+		},
+		"spec": schema{
+			"group": v1alpha1.SchemeGroupVersion.Group,
+			"names": schema{
+				"kind":     "Redis",
+				"listKind": "RedisList",
+				"plural":   "redises",
+				"singular": "redis",
+			},
+			"scope":                 "Namespaced",
+			"preserveUnknownFields": false,
+			// v1alpha2 is stored, v1alpha1 objects are still served
+			"versions": []schema{
+				{
+					"name":    v1alpha1.SchemeGroupVersion.Version,
+					"served":  true,
+					"storage": false,
+					"schema": schema{
+						"openAPIV3Schema": redisSchema(v1alpha1.RedisSpec{}, v1alpha1.RedisStatus{}),
+					},
+				},
+				{
+					"name":    v1alpha2.SchemeGroupVersion.Version,
+					"served":  true,
+					"storage": true,
+					"schema": schema{
+						"openAPIV3Schema": redisSchema(v1alpha2.RedisSpec{}, v1alpha2.RedisStatus{}),
+					},
+				},
+			},
+			// the operator points the webhook at its own namespace and
+			// fills the caBundle in when it starts
+			"conversion": schema{
+				"strategy":                 "Webhook",
+				"conversionReviewVersions": []string{"v1beta1"},
+				"webhookClientConfig": schema{
+					"service": schema{
+						"namespace": "default",
+						"name":      "redis-operator-webhook",
+						"path":      "/convert",
+					},
+				},
+			},
+			// status is written through its own endpoint, so the operator
+			// updating it doesn't bump metadata.generation
+			"subresources": schema{
+				"status": schema{},
+			},
+			"additionalPrinterColumns": []schema{
+				{"name": "Phase", "type": "string", "JSONPath": ".status.phase"},
+				{"name": "Port", "type": "integer", "JSONPath": ".spec.port"},
+				{"name": "MaxMemory", "type": "string", "JSONPath": ".spec.maxMemory"},
+				{"name": "Age", "type": "date", "JSONPath": ".metadata.creationTimestamp"},
+			},
+		},
+	}
+}
+
+func main() {
+	data, err := yaml.Marshal(crd())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println("# generated by tmp/codegen/crdgen, do not edit")
+	os.Stdout.Write(data)
+}
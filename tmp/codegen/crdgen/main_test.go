@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha1"
+	"github.com/flexshopper/redis-operator/pkg/apis/cache/v1alpha2"
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// schemaAt is the schema of the field at path, an empty segment stands for
+// the items of an array or the values of a map
+func schemaAt(s schema, path string) schema {
+	for _, name := range strings.Split(path, ".") {
+		var next interface{}
+		if name == "" {
+			next = s["items"]
+			if next == nil {
+				next = s["additionalProperties"]
+			}
+		} else if properties, ok := s["properties"].(schema); ok {
+			next = properties[name]
+		}
+
+		child, ok := next.(schema)
+		if !ok {
+			return nil
+		}
+		s = child
+	}
+
+	return s
+}
+
+func TestTypeSchema(t *testing.T) {
+	type fields struct {
+		Name     string            `json:"name"`
+		Count    int32             `json:"count,omitempty"`
+		Enabled  *bool             `json:"enabled,omitempty"`
+		Labels   map[string]string `json:"labels,omitempty"`
+		Hosts    []string          `json:"hosts"`
+		Started  metav1.Time       `json:"started"`
+		Internal string            `json:"-"`
+		untagged string
+	}
+
+	s := typeSchema(reflect.TypeOf(fields{}), "")
+
+	tests := []struct {
+		path string
+		want schema
+	}{
+		{path: "name", want: schema{"type": "string"}},
+		{path: "count", want: schema{"type": "integer", "format": "int32"}},
+		{path: "enabled", want: schema{"type": "boolean", "nullable": true}},
+		{path: "labels.", want: schema{"type": "string"}},
+		{path: "hosts.", want: schema{"type": "string"}},
+		{path: "started", want: schema{"type": "string", "format": "date-time", "nullable": true}},
+	}
+
+	for _, test := range tests {
+		if got := schemaAt(s, test.path); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.path, got, test.want)
+		}
+	}
+
+	if properties := s["properties"].(schema); len(properties) != len(tests) {
+		t.Errorf("got properties %v, want the JSON fields only", properties)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	schemas := []schema{
+		redisSchema(v1alpha1.RedisSpec{}, v1alpha1.RedisStatus{}),
+		redisSchema(v1alpha2.RedisSpec{}, v1alpha2.RedisStatus{}),
+	}
+
+	// a constraint at a path no version has is a typo or a field renamed
+	for path, constraint := range constraints {
+		found := false
+		for _, s := range schemas {
+			field := schemaAt(s, path)
+			if field == nil {
+				continue
+			}
+
+			found = true
+			for key, value := range constraint {
+				if !reflect.DeepEqual(field[key], value) {
+					t.Errorf("%s: got %s %v, want %v", path, key, field[key], value)
+				}
+			}
+		}
+
+		if !found {
+			t.Errorf("%s: no such field in any version", path)
+		}
+	}
+}
+
+func TestCRDUpToDate(t *testing.T) {
+	data, err := yaml.Marshal(crd())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := ioutil.ReadFile("../../../deploy/crd.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "# generated by tmp/codegen/crdgen, do not edit\n" + string(data); string(current) != want {
+		t.Errorf("deploy/crd.yaml is out of date, run tmp/codegen/update-generated.sh")
+	}
+}
@@ -8,5 +8,7 @@ vendor/k8s.io/code-generator/generate-groups.sh \
 deepcopy \
 github.com/flexshopper/redis-operator/pkg/generated \
 github.com/flexshopper/redis-operator/pkg/apis \
-cache:v1alpha1 \
+cache:v1alpha1,v1alpha2 \
 --go-header-file "./tmp/codegen/boilerplate.go.txt"
+
+go run tmp/codegen/crdgen/main.go > deploy/crd.yaml